@@ -0,0 +1,265 @@
+package gcjob
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+	"sync"
+	"test_project/Chapter06/linkgraph/graph"
+	"time"
+)
+
+var (
+	minUUID = uuid.Nil
+	maxUUID = uuid.MustParse("ffffffff-ffff-ffff-ffff-ffffffffffff")
+
+	// The graph iterators only return entries older than the provided
+	// timestamp; we use a far-future one to scan the entire graph.
+	scanBefore = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+)
+
+// Reason describes why a link was selected for collection.
+type Reason uint8
+
+const (
+	// ReasonUnreachable indicates that the link cannot be reached from
+	// any of the configured seed links.
+	ReasonUnreachable Reason = 1 << iota
+
+	// ReasonOrphaned indicates that the link has no inbound edges and has
+	// not been retrieved within the configured TTL. Links that were never
+	// retrieved are only collected once the TTL has passed since a
+	// collection pass first encountered them.
+	ReasonOrphaned
+)
+
+// Candidate describes a link that was selected for collection.
+type Candidate struct {
+	LinkID      uuid.UUID
+	URL         string
+	RetrievedAt time.Time
+	Reason      Reason
+}
+
+// Report summarizes the outcome of a collection pass.
+type Report struct {
+	StartedAt   time.Time
+	CompletedAt time.Time
+	DryRun      bool
+
+	// The number of links and edges that were scanned.
+	LinksScanned int
+	EdgesScanned int
+
+	// The links selected for collection.
+	Candidates []Candidate
+
+	// The number of links that were removed and the number of batches
+	// used to remove them. Both values are zero for dry runs.
+	LinksRemoved int
+	Batches      int
+}
+
+// Collector removes unreachable and orphaned links from a link graph.
+type Collector struct {
+	cfg Config
+	mu  sync.Mutex
+}
+
+// NewCollector returns a new Collector instance using the specified config.
+func NewCollector(cfg Config) (*Collector, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, xerrors.Errorf("gc config validation failed: %w", err)
+	}
+	return &Collector{cfg: cfg}, nil
+}
+
+// Run performs a single collection pass over the graph. If an error occurs
+// while removing links or saving the first-seen times, Run returns the
+// partially populated report together with the error.
+func (c *Collector) Run(ctx context.Context) (*Report, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := &Report{
+		StartedAt: c.cfg.Clock(),
+		DryRun:    c.cfg.DryRun,
+	}
+
+	links, err := c.scanLinks(report)
+	if err != nil {
+		return nil, xerrors.Errorf("gc: %w", err)
+	}
+	adjacency, inDegree, err := c.scanEdges(report)
+	if err != nil {
+		return nil, xerrors.Errorf("gc: %w", err)
+	}
+
+	var reachable map[uuid.UUID]bool
+	if len(c.cfg.SeedLinkIDs) != 0 {
+		reachable = reachableFrom(c.cfg.SeedLinkIDs, adjacency)
+	}
+	isSeed := make(map[uuid.UUID]bool, len(c.cfg.SeedLinkIDs))
+	for _, seedID := range c.cfg.SeedLinkIDs {
+		isSeed[seedID] = true
+	}
+
+	var prevFirstSeen, firstSeen map[uuid.UUID]time.Time
+	if c.cfg.FirstSeen != nil {
+		if prevFirstSeen, err = c.cfg.FirstSeen.LoadFirstSeen(); err != nil {
+			return nil, xerrors.Errorf("gc: %w", err)
+		}
+		firstSeen = make(map[uuid.UUID]time.Time)
+	}
+
+	orphanCutoff := report.StartedAt.Add(-c.cfg.OrphanTTL)
+	for _, link := range links {
+		lastSeen := link.RetrievedAt
+		if lastSeen.IsZero() && firstSeen != nil {
+			if lastSeen = prevFirstSeen[link.ID]; lastSeen.IsZero() {
+				lastSeen = report.StartedAt
+			}
+			firstSeen[link.ID] = lastSeen
+		}
+		if isSeed[link.ID] {
+			continue
+		}
+
+		var reason Reason
+		if reachable != nil && !reachable[link.ID] {
+			reason |= ReasonUnreachable
+		}
+		if c.cfg.OrphanTTL > 0 && inDegree[link.ID] == 0 && lastSeen.Before(orphanCutoff) {
+			reason |= ReasonOrphaned
+		}
+		if reason != 0 {
+			report.Candidates = append(report.Candidates, Candidate{
+				LinkID:      link.ID,
+				URL:         link.URL,
+				RetrievedAt: link.RetrievedAt,
+				Reason:      reason,
+			})
+		}
+	}
+	if !c.cfg.DryRun {
+		err = c.removeCandidates(ctx, report)
+	}
+	if firstSeen != nil {
+		// Only retain the links that still exist and were never
+		// retrieved. The times are saved even if removing the links
+		// failed so the next pass does not restart their TTL.
+		for _, candidate := range report.Candidates[:report.LinksRemoved] {
+			delete(firstSeen, candidate.LinkID)
+		}
+		if saveErr := c.cfg.FirstSeen.SaveFirstSeen(firstSeen); saveErr != nil {
+			err = multierror.Append(err, saveErr)
+		}
+	}
+
+	report.CompletedAt = c.cfg.Clock()
+	if err != nil {
+		return report, xerrors.Errorf("gc: %w", err)
+	}
+	return report, nil
+}
+
+func (c *Collector) scanLinks(report *Report) ([]*graph.Link, error) {
+	it, err := c.cfg.Graph.Links(minUUID, maxUUID, scanBefore)
+	if err != nil {
+		return nil, xerrors.Errorf("scan links: %w", err)
+	}
+
+	var links []*graph.Link
+	for it.Next() {
+		links = append(links, it.Link())
+	}
+	if err = it.Error(); err != nil {
+		_ = it.Close()
+		return nil, xerrors.Errorf("scan links: %w", err)
+	}
+	if err = it.Close(); err != nil {
+		return nil, xerrors.Errorf("scan links: %w", err)
+	}
+
+	report.LinksScanned = len(links)
+	return links, nil
+}
+
+func (c *Collector) scanEdges(report *Report) (map[uuid.UUID][]uuid.UUID, map[uuid.UUID]int, error) {
+	it, err := c.cfg.Graph.Edges(minUUID, maxUUID, scanBefore)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("scan edges: %w", err)
+	}
+
+	adjacency := make(map[uuid.UUID][]uuid.UUID)
+	inDegree := make(map[uuid.UUID]int)
+	for it.Next() {
+		edge := it.Edge()
+		report.EdgesScanned++
+		adjacency[edge.Src] = append(adjacency[edge.Src], edge.Dst)
+
+		// Self-loops do not keep a link alive.
+		if edge.Src != edge.Dst {
+			inDegree[edge.Dst]++
+		}
+	}
+	if err = it.Error(); err != nil {
+		_ = it.Close()
+		return nil, nil, xerrors.Errorf("scan edges: %w", err)
+	}
+	if err = it.Close(); err != nil {
+		return nil, nil, xerrors.Errorf("scan edges: %w", err)
+	}
+
+	return adjacency, inDegree, nil
+}
+
+func (c *Collector) removeCandidates(ctx context.Context, report *Report) error {
+	for start := 0; start < len(report.Candidates); start += c.cfg.BatchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := start + c.cfg.BatchSize
+		if end > len(report.Candidates) {
+			end = len(report.Candidates)
+		}
+		batch := make([]uuid.UUID, 0, end-start)
+		for _, candidate := range report.Candidates[start:end] {
+			batch = append(batch, candidate.LinkID)
+		}
+
+		if err := c.cfg.Graph.RemoveLinks(batch); err != nil {
+			return xerrors.Errorf("remove batch %d: %w", report.Batches, err)
+		}
+		report.Batches++
+		report.LinksRemoved += len(batch)
+	}
+	return nil
+}
+
+// reachableFrom returns the set of link IDs that can be reached by
+// traversing the graph edges starting from the seed links.
+func reachableFrom(seeds []uuid.UUID, adjacency map[uuid.UUID][]uuid.UUID) map[uuid.UUID]bool {
+	visited := make(map[uuid.UUID]bool)
+	queue := make([]uuid.UUID, 0, len(seeds))
+	for _, seedID := range seeds {
+		if !visited[seedID] {
+			visited[seedID] = true
+			queue = append(queue, seedID)
+		}
+	}
+
+	for len(queue) != 0 {
+		linkID := queue[0]
+		queue = queue[1:]
+		for _, dstID := range adjacency[linkID] {
+			if !visited[dstID] {
+				visited[dstID] = true
+				queue = append(queue, dstID)
+			}
+		}
+	}
+	return visited
+}
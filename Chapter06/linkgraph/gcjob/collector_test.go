@@ -0,0 +1,196 @@
+package gcjob
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	gc "gopkg.in/check.v1"
+	"path/filepath"
+	"sort"
+	"test_project/Chapter06/linkgraph/graph"
+	"test_project/Chapter06/linkgraph/store/memory"
+	"testing"
+	"time"
+)
+
+var _ = gc.Suite(new(CollectorTestSuite))
+
+func Test(t *testing.T) { gc.TestingT(t) }
+
+type CollectorTestSuite struct {
+	g         *memory.InMemoryGraph
+	firstSeen *FileFirstSeenStore
+	links     []uuid.UUID
+	now       time.Time
+}
+
+// SetUpTest creates the following graph:
+//
+//	0 -> 1 -> 2     3 -> 4     5
+//
+// Link 5 was retrieved recently while all other links were never retrieved.
+func (s *CollectorTestSuite) SetUpTest(c *gc.C) {
+	s.g = memory.NewInMemoryGraph()
+	s.firstSeen = NewFileFirstSeenStore(filepath.Join(c.MkDir(), "first-seen.json"))
+	s.now = time.Now().UTC()
+	s.links = make([]uuid.UUID, 6)
+	for i := 0; i < len(s.links); i++ {
+		link := &graph.Link{URL: fmt.Sprintf("https://example.com/%d", i)}
+		if i == 5 {
+			link.RetrievedAt = s.now.Add(-time.Minute)
+		}
+		c.Assert(s.g.UpsertLink(link), gc.IsNil)
+		s.links[i] = link.ID
+	}
+	for _, e := range [][2]int{{0, 1}, {1, 2}, {3, 4}} {
+		c.Assert(s.g.UpsertEdge(&graph.Edge{Src: s.links[e[0]], Dst: s.links[e[1]]}), gc.IsNil)
+	}
+}
+
+func (s *CollectorTestSuite) TestInvalidConfig(c *gc.C) {
+	_, err := NewCollector(Config{})
+	c.Assert(err, gc.ErrorMatches, "(?ms).*graph not specified.*")
+
+	_, err = NewCollector(Config{Graph: s.g})
+	c.Assert(err, gc.ErrorMatches, "(?ms).*at least one of seed link IDs or orphan TTL must be specified.*")
+
+	_, err = NewCollector(Config{Graph: s.g, OrphanTTL: time.Hour})
+	c.Assert(err, gc.ErrorMatches, "(?ms).*first-seen store must be specified when orphan TTL is enabled.*")
+}
+
+func (s *CollectorTestSuite) TestUnreachableLinks(c *gc.C) {
+	report := s.run(c, Config{SeedLinkIDs: []uuid.UUID{s.links[0]}})
+	c.Assert(report.LinksScanned, gc.Equals, 6)
+	c.Assert(report.EdgesScanned, gc.Equals, 3)
+	s.assertCandidates(c, report, map[int]Reason{
+		3: ReasonUnreachable,
+		4: ReasonUnreachable,
+		5: ReasonUnreachable,
+	})
+	c.Assert(report.LinksRemoved, gc.Equals, 3)
+	s.assertRemaining(c, 0, 1, 2)
+}
+
+func (s *CollectorTestSuite) TestOrphanedLinks(c *gc.C) {
+	// Links that were never retrieved are kept until they have been
+	// orphaned for longer than the TTL. Each pass uses a new collector
+	// instance, as would be the case when running the collector as a
+	// periodic job.
+	start := s.now
+	for _, elapsed := range []time.Duration{0, 30 * time.Minute, 59 * time.Minute} {
+		s.now = start.Add(elapsed)
+		report := s.run(c, Config{OrphanTTL: time.Hour})
+		s.assertCandidates(c, report, map[int]Reason{})
+		s.assertRemaining(c, 0, 1, 2, 3, 4, 5)
+	}
+
+	// Link 5 has no inbound edges but was retrieved within the TTL.
+	s.now = start.Add(61 * time.Minute)
+	c.Assert(s.g.UpsertLink(&graph.Link{URL: "https://example.com/5", RetrievedAt: s.now.Add(-time.Minute)}), gc.IsNil)
+	report := s.run(c, Config{OrphanTTL: time.Hour})
+	s.assertCandidates(c, report, map[int]Reason{
+		0: ReasonOrphaned,
+		3: ReasonOrphaned,
+	})
+	s.assertRemaining(c, 1, 2, 4, 5)
+
+	// Only the links that still exist and were never retrieved are
+	// remembered.
+	firstSeen, err := s.firstSeen.LoadFirstSeen()
+	c.Assert(err, gc.IsNil)
+	c.Assert(firstSeen, gc.DeepEquals, map[uuid.UUID]time.Time{
+		s.links[1]: start,
+		s.links[2]: start,
+		s.links[4]: start,
+	})
+}
+
+func (s *CollectorTestSuite) TestCombinedReasonsAndBatching(c *gc.C) {
+	report := s.run(c, Config{
+		SeedLinkIDs: []uuid.UUID{s.links[0]},
+		OrphanTTL:   time.Hour,
+		BatchSize:   2,
+	})
+	s.assertCandidates(c, report, map[int]Reason{
+		3: ReasonUnreachable,
+		4: ReasonUnreachable,
+		5: ReasonUnreachable,
+	})
+	c.Assert(report.Batches, gc.Equals, 2)
+	c.Assert(report.LinksRemoved, gc.Equals, 3)
+	s.assertRemaining(c, 0, 1, 2)
+}
+
+func (s *CollectorTestSuite) TestDryRun(c *gc.C) {
+	report := s.run(c, Config{
+		SeedLinkIDs: []uuid.UUID{s.links[0]},
+		DryRun:      true,
+	})
+	c.Assert(report.DryRun, gc.Equals, true)
+	c.Assert(report.Candidates, gc.HasLen, 3)
+	c.Assert(report.LinksRemoved, gc.Equals, 0)
+	c.Assert(report.Batches, gc.Equals, 0)
+	s.assertRemaining(c, 0, 1, 2, 3, 4, 5)
+}
+
+func (s *CollectorTestSuite) TestCancelledContext(c *gc.C) {
+	coll, err := NewCollector(Config{
+		Graph:       s.g,
+		SeedLinkIDs: []uuid.UUID{s.links[0]},
+		Clock:       func() time.Time { return s.now },
+	})
+	c.Assert(err, gc.IsNil)
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	cancelFn()
+	report, err := coll.Run(ctx)
+	c.Assert(err, gc.ErrorMatches, ".*context canceled")
+	c.Assert(report.Candidates, gc.HasLen, 3)
+	c.Assert(report.LinksRemoved, gc.Equals, 0)
+	s.assertRemaining(c, 0, 1, 2, 3, 4, 5)
+}
+
+func (s *CollectorTestSuite) run(c *gc.C, cfg Config) *Report {
+	cfg.Graph = s.g
+	cfg.FirstSeen = s.firstSeen
+	cfg.Clock = func() time.Time { return s.now }
+	coll, err := NewCollector(cfg)
+	c.Assert(err, gc.IsNil)
+
+	report, err := coll.Run(context.TODO())
+	c.Assert(err, gc.IsNil)
+	return report
+}
+
+func (s *CollectorTestSuite) assertCandidates(c *gc.C, report *Report, exp map[int]Reason) {
+	got := make(map[uuid.UUID]Reason)
+	for _, candidate := range report.Candidates {
+		got[candidate.LinkID] = candidate.Reason
+	}
+
+	want := make(map[uuid.UUID]Reason)
+	for linkIndex, reason := range exp {
+		want[s.links[linkIndex]] = reason
+	}
+	c.Assert(got, gc.DeepEquals, want)
+}
+
+func (s *CollectorTestSuite) assertRemaining(c *gc.C, linkIndices ...int) {
+	it, err := s.g.Links(minUUID, maxUUID, scanBefore)
+	c.Assert(err, gc.IsNil)
+
+	var got []string
+	for it.Next() {
+		got = append(got, it.Link().ID.String())
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+
+	var exp []string
+	for _, linkIndex := range linkIndices {
+		exp = append(exp, s.links[linkIndex].String())
+	}
+	sort.Strings(got)
+	sort.Strings(exp)
+	c.Assert(got, gc.DeepEquals, exp)
+}
@@ -0,0 +1,77 @@
+package gcjob
+
+import (
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+	"test_project/Chapter06/linkgraph/graph"
+	"time"
+)
+
+// Graph is implemented by graph stores that the collector can scan and prune.
+type Graph interface {
+	Links(fromID, toID uuid.UUID, retrievedBefore time.Time) (graph.LinkIterator, error)
+	Edges(fromID, toID uuid.UUID, updatedBefore time.Time) (graph.EdgeIterator, error)
+	RemoveLinks(linkIDs []uuid.UUID) error
+}
+
+// Config encapsulates the configuration options for the link garbage
+// collector.
+type Config struct {
+	// Graph is the link graph to scan for garbage links. A valid graph
+	// instance is required for the config to be valid.
+	Graph Graph
+
+	// SeedLinkIDs, if specified, enables reachability-based collection.
+	// Any link that cannot be reached by following edges from one of the
+	// seed links will be collected. Seed links are never collected.
+	SeedLinkIDs []uuid.UUID
+
+	// OrphanTTL, if specified, enables the collection of orphaned links:
+	// links without any inbound edges whose last successful retrieval
+	// happened more than OrphanTTL ago. Links that were never retrieved
+	// are collected once they have been orphaned for more than OrphanTTL
+	// since the collector first encountered them.
+	OrphanTTL time.Duration
+
+	// FirstSeen persists the times at which the collector first
+	// encountered links that were never retrieved. It is required when
+	// OrphanTTL is specified.
+	FirstSeen FirstSeenStore
+
+	// BatchSize specifies the maximum number of links to remove with a
+	// single call to the graph's RemoveLinks method. If not specified, a
+	// default value of 100 will be used.
+	BatchSize int
+
+	// DryRun, if set, causes the collector to report the links that it
+	// would remove without actually removing them.
+	DryRun bool
+
+	// Clock is used to obtain the current time. If not specified, the
+	// collector will use time.Now.
+	Clock func() time.Time
+}
+
+// validate checks whether a collector configuration is valid and sets the
+// default values where required.
+func (cfg *Config) validate() error {
+	var err error
+	if cfg.Graph == nil {
+		err = multierror.Append(err, xerrors.New("graph not specified"))
+	}
+	if len(cfg.SeedLinkIDs) == 0 && cfg.OrphanTTL <= 0 {
+		err = multierror.Append(err, xerrors.New("at least one of seed link IDs or orphan TTL must be specified"))
+	}
+	if cfg.OrphanTTL > 0 && cfg.FirstSeen == nil {
+		err = multierror.Append(err, xerrors.New("first-seen store must be specified when orphan TTL is enabled"))
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+
+	return err
+}
@@ -0,0 +1,82 @@
+package gcjob
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FirstSeenStore persists the times at which links that were never retrieved
+// were first encountered by a collection pass. The graph does not track when
+// links were inserted, so the orphan TTL of such links is measured from these
+// times; persisting them allows the TTL to span collector instances and
+// process restarts.
+type FirstSeenStore interface {
+	// LoadFirstSeen returns the first-seen times recorded by the last
+	// call to SaveFirstSeen.
+	LoadFirstSeen() (map[uuid.UUID]time.Time, error)
+
+	// SaveFirstSeen replaces the recorded first-seen times.
+	SaveFirstSeen(firstSeen map[uuid.UUID]time.Time) error
+}
+
+// FileFirstSeenStore is a FirstSeenStore that keeps the first-seen times in a
+// JSON file.
+type FileFirstSeenStore struct {
+	path string
+}
+
+// NewFileFirstSeenStore returns a FirstSeenStore that keeps the first-seen
+// times in the file at path. The file is created by the first call to
+// SaveFirstSeen.
+func NewFileFirstSeenStore(path string) *FileFirstSeenStore {
+	return &FileFirstSeenStore{path: path}
+}
+
+// LoadFirstSeen implements FirstSeenStore. If the file does not exist yet,
+// an empty set of first-seen times is returned.
+func (s *FileFirstSeenStore) LoadFirstSeen() (map[uuid.UUID]time.Time, error) {
+	firstSeen := make(map[uuid.UUID]time.Time)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return firstSeen, nil
+	} else if err != nil {
+		return nil, xerrors.Errorf("load first-seen times: %w", err)
+	}
+	if err = json.Unmarshal(data, &firstSeen); err != nil {
+		return nil, xerrors.Errorf("load first-seen times: %w", err)
+	}
+	return firstSeen, nil
+}
+
+// SaveFirstSeen implements FirstSeenStore. The file is replaced atomically so
+// that an interrupted save does not lose the previously recorded times.
+func (s *FileFirstSeenStore) SaveFirstSeen(firstSeen map[uuid.UUID]time.Time) error {
+	data, err := json.Marshal(firstSeen)
+	if err != nil {
+		return xerrors.Errorf("save first-seen times: %w", err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return xerrors.Errorf("save first-seen times: %w", err)
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return xerrors.Errorf("save first-seen times: %w", err)
+	}
+	return nil
+}
@@ -12,6 +12,11 @@ type Graph interface {
 	UpsertEdge(edge *Edge) error
 	RemoveStaleEdges(fromID uuid.UUID, updatedBefore time.Time) error
 
+	// RemoveLinks deletes the links with the specified IDs together with
+	// any edges that originate from or point to them. Unknown IDs are
+	// silently ignored.
+	RemoveLinks(linkIDs []uuid.UUID) error
+
 	Links(fromID, toID uuid.UUID, retrievedBefore time.Time) (LinkIterator, error)
 	Edges(fromID, toID uuid.UUID, updatedBefore time.Time) (EdgeIterator, error)
 }
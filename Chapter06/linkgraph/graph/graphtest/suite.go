@@ -156,6 +156,39 @@ func (s *SuiteBase) TestRemoveStaleEdges(c *gc.C) {
 	c.Assert(seen, gc.Equals, numEdges)
 }
 
+func (s *SuiteBase) TestRemoveLinks(c *gc.C) {
+	linkUUIDs := make([]uuid.UUID, 4)
+	for i := 0; i < len(linkUUIDs); i++ {
+		link := &graph.Link{URL: fmt.Sprint(i)}
+		c.Assert(s.g.UpsertLink(link), gc.IsNil)
+		linkUUIDs[i] = link.ID
+	}
+
+	// 0 -> 1, 1 -> 2, 2 -> 3, 3 -> 1
+	var keptEdgeIDs []uuid.UUID
+	for i, dst := range []int{1, 2, 3, 1} {
+		edge := &graph.Edge{Src: linkUUIDs[i], Dst: linkUUIDs[dst]}
+		c.Assert(s.g.UpsertEdge(edge), gc.IsNil)
+		if i == 2 {
+			keptEdgeIDs = append(keptEdgeIDs, edge.ID)
+		}
+	}
+
+	c.Assert(s.g.RemoveLinks([]uuid.UUID{linkUUIDs[0], linkUUIDs[1], uuid.New()}), gc.IsNil)
+
+	for _, linkID := range linkUUIDs[:2] {
+		_, err := s.g.FindLink(linkID)
+		c.Assert(xerrors.Is(err, graph.ErrNotFound), gc.Equals, true, gc.Commentf("expected link %s to be removed", linkID))
+	}
+	s.assertIteratedLinkIDsMatch(c, time.Now(), linkUUIDs[2:])
+	s.assertIteratedEdgeIDsMatch(c, time.Now(), keptEdgeIDs)
+
+	// Re-inserting a removed URL should yield a brand new link.
+	link := &graph.Link{URL: "0"}
+	c.Assert(s.g.UpsertLink(link), gc.IsNil)
+	c.Assert(link.ID, gc.Not(gc.Equals), linkUUIDs[0])
+}
+
 func (s *SuiteBase) TestConcurrentLinkIterators(c *gc.C) {
 	var (
 		wg           sync.WaitGroup
@@ -30,6 +30,9 @@ SELECT id, src, dst, updated_at FROM edges WHERE src >= $1 AND src < $2 AND upda
 `
 	removeStaleEdgesQuery = `
 DELETE FROM edges WHERE src=$1 AND updated_at < $2
+`
+	removeLinksQuery = `
+DELETE FROM links WHERE id = ANY($1::UUID[])
 `
 )
 
@@ -70,6 +73,22 @@ func (c CockroachDBGraph) RemoveStaleEdges(fromID uuid.UUID, updatedBefore time.
 	return nil
 }
 
+func (c CockroachDBGraph) RemoveLinks(linkIDs []uuid.UUID) error {
+	if len(linkIDs) == 0 {
+		return nil
+	}
+	ids := make(pq.StringArray, len(linkIDs))
+	for i, linkID := range linkIDs {
+		ids[i] = linkID.String()
+	}
+	// Edges referencing the removed links are dropped by the ON DELETE
+	// CASCADE constraints of the edges table.
+	if _, err := c.db.Exec(removeLinksQuery, ids); err != nil {
+		return xerrors.Errorf("remove links: %w", err)
+	}
+	return nil
+}
+
 func (c CockroachDBGraph) Links(fromID, toID uuid.UUID, retrievedBefore time.Time) (graph.LinkIterator, error) {
 	rows, err := c.db.Query(linksQuery, fromID, toID, retrievedBefore.UTC())
 	if err != nil {
@@ -2,8 +2,10 @@ package memory
 
 import "test_project/Chapter06/linkgraph/graph"
 
+// Links and edges stored by InMemoryGraph are never modified in place, so
+// iterators can hand out copies of them without holding the graph lock.
+
 type linkIterator struct {
-	s        *InMemoryGraph
 	links    []*graph.Link
 	curIndex int
 }
@@ -17,9 +19,6 @@ func (l *linkIterator) Next() bool {
 }
 
 func (l *linkIterator) Link() *graph.Link {
-	l.s.mu.RLock()
-	defer l.s.mu.RUnlock()
-
 	link := l.links[l.curIndex-1]
 	lCopy := new(graph.Link)
 	*lCopy = *link
@@ -37,7 +36,6 @@ func (i *linkIterator) Close() error {
 }
 
 type edgeIterator struct {
-	s        *InMemoryGraph
 	edges    []*graph.Edge
 	curIndex int
 }
@@ -51,9 +49,6 @@ func (e *edgeIterator) Next() bool {
 }
 
 func (e *edgeIterator) Edge() *graph.Edge {
-	e.s.mu.RLock()
-	defer e.s.mu.RUnlock()
-
 	edge := e.edges[e.curIndex-1]
 	eCopy := new(graph.Edge)
 	*eCopy = *edge
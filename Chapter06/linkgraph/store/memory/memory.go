@@ -21,6 +21,10 @@ type InMemoryGraph struct {
 
 	linkURLIndex map[string]*graph.Link
 	linkEdgeMap  map[uuid.UUID]edgeList
+
+	// shared is set when the maps above are referenced by a snapshot. The
+	// next write operation must then clone them before modifying them.
+	shared bool
 }
 
 func NewInMemoryGraph() *InMemoryGraph {
@@ -35,14 +39,17 @@ func NewInMemoryGraph() *InMemoryGraph {
 func (s *InMemoryGraph) UpsertLink(link *graph.Link) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.ensureWritable()
 
 	if existing := s.linkURLIndex[link.URL]; existing != nil {
 		link.ID = existing.ID
-		origTs := existing.RetrievedAt
-		*existing = *link
-		if origTs.After(existing.RetrievedAt) {
-			existing.RetrievedAt = origTs
+		lCopy := new(graph.Link)
+		*lCopy = *link
+		if existing.RetrievedAt.After(lCopy.RetrievedAt) {
+			lCopy.RetrievedAt = existing.RetrievedAt
 		}
+		s.linkURLIndex[lCopy.URL] = lCopy
+		s.links[lCopy.ID] = lCopy
 		return nil
 	}
 	for {
@@ -62,14 +69,7 @@ func (s *InMemoryGraph) FindLink(id uuid.UUID) (*graph.Link, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	result, exist := s.links[id]
-	if !exist {
-		return nil, xerrors.Errorf("find link: %w", graph.ErrNotFound)
-	}
-
-	lCopy := new(graph.Link)
-	*lCopy = *result
-	return lCopy, nil
+	return findLink(s.links, id)
 }
 
 func (s *InMemoryGraph) UpsertEdge(edge *graph.Edge) error {
@@ -80,12 +80,16 @@ func (s *InMemoryGraph) UpsertEdge(edge *graph.Edge) error {
 	if !srcExists || !dstExists {
 		return xerrors.Errorf("upsert edge: %w", graph.ErrUnknownEdgeLinks)
 	}
+	s.ensureWritable()
 
 	for _, edgeID := range s.linkEdgeMap[edge.Src] {
 		existingEdge := s.edges[edgeID]
 		if existingEdge.Src == edge.Src && existingEdge.Dst == edge.Dst {
-			existingEdge.UpdatedAt = time.Now()
-			*edge = *existingEdge
+			eCopy := new(graph.Edge)
+			*eCopy = *existingEdge
+			eCopy.UpdatedAt = time.Now()
+			s.edges[edgeID] = eCopy
+			*edge = *eCopy
 			return nil
 		}
 	}
@@ -108,6 +112,7 @@ func (s *InMemoryGraph) UpsertEdge(edge *graph.Edge) error {
 func (s *InMemoryGraph) RemoveStaleEdges(fromID uuid.UUID, updatedBefore time.Time) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.ensureWritable()
 
 	var retain edgeList
 	for _, edgeID := range s.linkEdgeMap[fromID] {
@@ -122,34 +127,136 @@ func (s *InMemoryGraph) RemoveStaleEdges(fromID uuid.UUID, updatedBefore time.Ti
 	return nil
 }
 
+func (s *InMemoryGraph) RemoveLinks(linkIDs []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ensureWritable()
+
+	removed := make(map[uuid.UUID]struct{}, len(linkIDs))
+	for _, linkID := range linkIDs {
+		link, exists := s.links[linkID]
+		if !exists {
+			continue
+		}
+		for _, edgeID := range s.linkEdgeMap[linkID] {
+			delete(s.edges, edgeID)
+		}
+		delete(s.linkEdgeMap, linkID)
+		delete(s.linkURLIndex, link.URL)
+		delete(s.links, linkID)
+		removed[linkID] = struct{}{}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	// Drop any edges from the remaining links that point to a removed link.
+	for srcID, edgeIDs := range s.linkEdgeMap {
+		var retain edgeList
+		for _, edgeID := range edgeIDs {
+			if _, gone := removed[s.edges[edgeID].Dst]; gone {
+				delete(s.edges, edgeID)
+			} else {
+				retain = append(retain, edgeID)
+			}
+		}
+		s.linkEdgeMap[srcID] = retain
+	}
+	return nil
+}
+
 func (s *InMemoryGraph) Links(fromID, toID uuid.UUID, retrievedBefore time.Time) (graph.LinkIterator, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	return filterLinks(s.links, fromID, toID, retrievedBefore), nil
+}
+
+func (s *InMemoryGraph) Edges(fromID, toID uuid.UUID, updatedBefore time.Time) (graph.EdgeIterator, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return filterEdges(s.links, s.edges, s.linkEdgeMap, fromID, toID, updatedBefore), nil
+}
+
+// Snapshot returns an immutable, point-in-time view of the graph. Taking a
+// snapshot is a constant-time operation; the cost of copying the graph
+// state is paid by the first write that follows it.
+func (s *InMemoryGraph) Snapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shared = true
+	return &Snapshot{
+		takenAt:     time.Now(),
+		links:       s.links,
+		edges:       s.edges,
+		linkEdgeMap: s.linkEdgeMap,
+	}
+}
+
+// ensureWritable clones the graph maps if they are currently referenced by
+// a snapshot. Callers must hold the write lock.
+func (s *InMemoryGraph) ensureWritable() {
+	if !s.shared {
+		return
+	}
+
+	links := make(map[uuid.UUID]*graph.Link, len(s.links))
+	linkURLIndex := make(map[string]*graph.Link, len(s.linkURLIndex))
+	for id, link := range s.links {
+		links[id] = link
+		linkURLIndex[link.URL] = link
+	}
+	edges := make(map[uuid.UUID]*graph.Edge, len(s.edges))
+	for id, edge := range s.edges {
+		edges[id] = edge
+	}
+	linkEdgeMap := make(map[uuid.UUID]edgeList, len(s.linkEdgeMap))
+	for id, list := range s.linkEdgeMap {
+		// Limit the capacity so that appends never write to the
+		// backing array shared with the snapshot.
+		linkEdgeMap[id] = list[:len(list):len(list)]
+	}
+
+	s.links, s.linkURLIndex, s.edges, s.linkEdgeMap = links, linkURLIndex, edges, linkEdgeMap
+	s.shared = false
+}
+
+func findLink(links map[uuid.UUID]*graph.Link, id uuid.UUID) (*graph.Link, error) {
+	result, exist := links[id]
+	if !exist {
+		return nil, xerrors.Errorf("find link: %w", graph.ErrNotFound)
+	}
+
+	lCopy := new(graph.Link)
+	*lCopy = *result
+	return lCopy, nil
+}
+
+func filterLinks(links map[uuid.UUID]*graph.Link, fromID, toID uuid.UUID, retrievedBefore time.Time) *linkIterator {
 	from, to := fromID.String(), toID.String()
 	var list []*graph.Link
-	for linkID, link := range s.links {
+	for linkID, link := range links {
 		if id := linkID.String(); id < to && id >= from && link.RetrievedAt.Before(retrievedBefore) {
 			list = append(list, link)
 		}
 	}
-	return &linkIterator{s: s, links: list}, nil
+	return &linkIterator{links: list}
 }
 
-func (s *InMemoryGraph) Edges(fromID, toID uuid.UUID, updatedBefore time.Time) (graph.EdgeIterator, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func filterEdges(links map[uuid.UUID]*graph.Link, edges map[uuid.UUID]*graph.Edge, linkEdgeMap map[uuid.UUID]edgeList, fromID, toID uuid.UUID, updatedBefore time.Time) *edgeIterator {
 	from, to := fromID.String(), toID.String()
 	var list []*graph.Edge
-	for linkID := range s.links {
+	for linkID := range links {
 		if id := linkID.String(); id >= to || id < from {
 			continue
 		}
-		for _, edgeID := range s.linkEdgeMap[linkID] {
-			if edge := s.edges[edgeID]; edge.UpdatedAt.Before(updatedBefore) {
+		for _, edgeID := range linkEdgeMap[linkID] {
+			if edge := edges[edgeID]; edge.UpdatedAt.Before(updatedBefore) {
 				list = append(list, edge)
 			}
 		}
 	}
-	return &edgeIterator{s: s, edges: list}, nil
+	return &edgeIterator{edges: list}
 }
@@ -1,9 +1,15 @@
 package memory
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/google/uuid"
 	gc "gopkg.in/check.v1"
+	"sync"
+	"test_project/Chapter06/linkgraph/graph"
 	"test_project/Chapter06/linkgraph/graph/graphtest"
 	"testing"
+	"time"
 )
 
 var _ = gc.Suite(new(InMemoryGraphTestSuite))
@@ -12,8 +18,158 @@ func Test(t *testing.T) { gc.TestingT(t) }
 
 type InMemoryGraphTestSuite struct {
 	graphtest.SuiteBase
+	g *InMemoryGraph
 }
 
 func (s *InMemoryGraphTestSuite) SetUpTest(c *gc.C) {
-	s.SetGraph(NewInMemoryGraph())
+	s.g = NewInMemoryGraph()
+	s.SetGraph(s.g)
+}
+
+func (s *InMemoryGraphTestSuite) TestSnapshotIsolation(c *gc.C) {
+	src := &graph.Link{URL: "https://example.com"}
+	dst := &graph.Link{URL: "https://example.com/about"}
+	c.Assert(s.g.UpsertLink(src), gc.IsNil)
+	c.Assert(s.g.UpsertLink(dst), gc.IsNil)
+	edge := &graph.Edge{Src: src.ID, Dst: dst.ID}
+	c.Assert(s.g.UpsertEdge(edge), gc.IsNil)
+
+	snap := s.g.Snapshot()
+
+	// Mutate the graph after taking the snapshot.
+	retrievedAt := time.Now().UTC()
+	c.Assert(s.g.UpsertLink(&graph.Link{URL: src.URL, RetrievedAt: retrievedAt}), gc.IsNil)
+	c.Assert(s.g.UpsertEdge(&graph.Edge{Src: src.ID, Dst: dst.ID}), gc.IsNil)
+	c.Assert(s.g.UpsertLink(&graph.Link{URL: "https://example.com/new"}), gc.IsNil)
+	c.Assert(s.g.RemoveLinks([]uuid.UUID{dst.ID}), gc.IsNil)
+
+	got, err := snap.FindLink(src.ID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.RetrievedAt.IsZero(), gc.Equals, true, gc.Commentf("snapshot observed a link update"))
+	_, err = snap.FindLink(dst.ID)
+	c.Assert(err, gc.IsNil, gc.Commentf("snapshot observed a link removal"))
+
+	c.Assert(countLinks(c, snap), gc.Equals, 2)
+	edges := collectEdges(c, snap)
+	c.Assert(edges, gc.HasLen, 1)
+	c.Assert(edges[0], gc.DeepEquals, edge, gc.Commentf("snapshot observed an edge update"))
+
+	// The live graph reflects all writes.
+	got, err = s.g.FindLink(src.ID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.RetrievedAt, gc.Equals, retrievedAt)
+	c.Assert(countLinks(c, s.g), gc.Equals, 2)
+	c.Assert(collectEdges(c, s.g), gc.HasLen, 0)
+}
+
+func (s *InMemoryGraphTestSuite) TestSnapshotWithConcurrentWriters(c *gc.C) {
+	var linkIDs []uuid.UUID
+	for i := 0; i < 100; i++ {
+		link := &graph.Link{URL: fmt.Sprint(i)}
+		c.Assert(s.g.UpsertLink(link), gc.IsNil)
+		linkIDs = append(linkIDs, link.ID)
+	}
+	for i := 1; i < len(linkIDs); i++ {
+		c.Assert(s.g.UpsertEdge(&graph.Edge{Src: linkIDs[0], Dst: linkIDs[i]}), gc.IsNil)
+	}
+
+	var wg sync.WaitGroup
+	stopCh := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+			link := &graph.Link{URL: fmt.Sprintf("new-%d", i)}
+			_ = s.g.UpsertLink(link)
+			_ = s.g.UpsertEdge(&graph.Edge{Src: linkIDs[0], Dst: link.ID})
+			_ = s.g.RemoveStaleEdges(linkIDs[0], time.Now().Add(-time.Hour))
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		snap := s.g.Snapshot()
+		links := countLinks(c, snap)
+		edges := collectEdges(c, snap)
+		c.Assert(countLinks(c, snap), gc.Equals, links, gc.Commentf("snapshot link count changed while iterating"))
+		c.Assert(collectEdges(c, snap), gc.HasLen, len(edges), gc.Commentf("snapshot edge count changed while iterating"))
+	}
+	close(stopCh)
+	wg.Wait()
+}
+
+func (s *InMemoryGraphTestSuite) TestSnapshotSerialization(c *gc.C) {
+	var linkIDs []uuid.UUID
+	for i := 0; i < 10; i++ {
+		link := &graph.Link{URL: fmt.Sprint(i), RetrievedAt: time.Now().Add(-time.Duration(i) * time.Hour).UTC()}
+		c.Assert(s.g.UpsertLink(link), gc.IsNil)
+		linkIDs = append(linkIDs, link.ID)
+	}
+	for i := 1; i < len(linkIDs); i++ {
+		c.Assert(s.g.UpsertEdge(&graph.Edge{Src: linkIDs[i-1], Dst: linkIDs[i]}), gc.IsNil)
+	}
+
+	snap := s.g.Snapshot()
+	var buf bytes.Buffer
+	n, err := snap.WriteTo(&buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, int64(buf.Len()))
+
+	loaded, err := LoadSnapshot(&buf)
+	c.Assert(err, gc.IsNil)
+	for _, linkID := range linkIDs {
+		exp, err := snap.FindLink(linkID)
+		c.Assert(err, gc.IsNil)
+		got, err := loaded.FindLink(linkID)
+		c.Assert(err, gc.IsNil)
+		c.Assert(got.URL, gc.Equals, exp.URL)
+		c.Assert(got.RetrievedAt.Equal(exp.RetrievedAt), gc.Equals, true)
+	}
+	c.Assert(collectEdges(c, loaded), gc.HasLen, len(linkIDs)-1)
+
+	// The loaded graph must be fully functional.
+	dup := &graph.Link{URL: "0"}
+	c.Assert(loaded.UpsertLink(dup), gc.IsNil)
+	c.Assert(dup.ID, gc.Equals, linkIDs[0])
+	edge := &graph.Edge{Src: linkIDs[0], Dst: linkIDs[1]}
+	c.Assert(loaded.UpsertEdge(edge), gc.IsNil)
+	c.Assert(collectEdges(c, loaded), gc.HasLen, len(linkIDs)-1)
+
+	_, err = LoadSnapshot(bytes.NewBufferString(`{"Version":42}`))
+	c.Assert(err, gc.ErrorMatches, ".*unsupported format version 42")
+}
+
+type linkEdgeLister interface {
+	Links(fromID, toID uuid.UUID, retrievedBefore time.Time) (graph.LinkIterator, error)
+	Edges(fromID, toID uuid.UUID, updatedBefore time.Time) (graph.EdgeIterator, error)
+}
+
+var maxUUID = uuid.MustParse("ffffffff-ffff-ffff-ffff-ffffffffffff")
+
+func countLinks(c *gc.C, g linkEdgeLister) int {
+	it, err := g.Links(uuid.Nil, maxUUID, time.Now())
+	c.Assert(err, gc.IsNil)
+	var count int
+	for it.Next() {
+		count++
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+	return count
+}
+
+func collectEdges(c *gc.C, g linkEdgeLister) []*graph.Edge {
+	it, err := g.Edges(uuid.Nil, maxUUID, time.Now().Add(time.Minute))
+	c.Assert(err, gc.IsNil)
+	var edges []*graph.Edge
+	for it.Next() {
+		edges = append(edges, it.Edge())
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+	return edges
 }
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"io"
+	"test_project/Chapter06/linkgraph/graph"
+	"time"
+)
+
+// The version of the serialized snapshot format.
+const snapshotFormatVersion = 1
+
+// Snapshot is an immutable, point-in-time view of an InMemoryGraph. It is
+// safe for concurrent use and is not affected by writes to the graph it was
+// taken from.
+type Snapshot struct {
+	takenAt time.Time
+
+	links       map[uuid.UUID]*graph.Link
+	edges       map[uuid.UUID]*graph.Edge
+	linkEdgeMap map[uuid.UUID]edgeList
+}
+
+// serializedSnapshot describes the on-disk representation of a snapshot.
+type serializedSnapshot struct {
+	Version int
+	TakenAt time.Time
+	Links   []*graph.Link
+	Edges   []*graph.Edge
+}
+
+// TakenAt returns the time when the snapshot was taken.
+func (s *Snapshot) TakenAt() time.Time {
+	return s.takenAt
+}
+
+// FindLink looks up a link by its ID.
+func (s *Snapshot) FindLink(id uuid.UUID) (*graph.Link, error) {
+	return findLink(s.links, id)
+}
+
+// Links returns an iterator for the set of links whose IDs belong to the
+// [fromID, toID) range and were retrieved before the provided timestamp.
+func (s *Snapshot) Links(fromID, toID uuid.UUID, retrievedBefore time.Time) (graph.LinkIterator, error) {
+	return filterLinks(s.links, fromID, toID, retrievedBefore), nil
+}
+
+// Edges returns an iterator for the set of edges whose source vertex IDs
+// belong to the [fromID, toID) range and were updated before the provided
+// timestamp.
+func (s *Snapshot) Edges(fromID, toID uuid.UUID, updatedBefore time.Time) (graph.EdgeIterator, error) {
+	return filterEdges(s.links, s.edges, s.linkEdgeMap, fromID, toID, updatedBefore), nil
+}
+
+// WriteTo serializes the snapshot contents to w. It implements io.WriterTo.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	out := serializedSnapshot{
+		Version: snapshotFormatVersion,
+		TakenAt: s.takenAt.UTC(),
+		Links:   make([]*graph.Link, 0, len(s.links)),
+		Edges:   make([]*graph.Edge, 0, len(s.edges)),
+	}
+	for _, link := range s.links {
+		out.Links = append(out.Links, link)
+	}
+	for _, edge := range s.edges {
+		out.Edges = append(out.Edges, edge)
+	}
+
+	cw := &countingWriter{w: w}
+	if err := json.NewEncoder(cw).Encode(out); err != nil {
+		return cw.n, xerrors.Errorf("write snapshot: %w", err)
+	}
+	return cw.n, nil
+}
+
+// LoadSnapshot reads a snapshot previously serialized via Snapshot.WriteTo
+// and returns a new InMemoryGraph populated with its contents.
+func LoadSnapshot(r io.Reader) (*InMemoryGraph, error) {
+	var in serializedSnapshot
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, xerrors.Errorf("load snapshot: %w", err)
+	}
+	if in.Version != snapshotFormatVersion {
+		return nil, xerrors.Errorf("load snapshot: unsupported format version %d", in.Version)
+	}
+
+	g := NewInMemoryGraph()
+	for _, link := range in.Links {
+		if link == nil || link.ID == uuid.Nil {
+			return nil, xerrors.New("load snapshot: link with missing ID")
+		}
+		link.RetrievedAt = link.RetrievedAt.UTC()
+		g.links[link.ID] = link
+		g.linkURLIndex[link.URL] = link
+	}
+	for _, edge := range in.Edges {
+		if edge == nil || edge.ID == uuid.Nil {
+			return nil, xerrors.New("load snapshot: edge with missing ID")
+		}
+		if g.links[edge.Src] == nil || g.links[edge.Dst] == nil {
+			return nil, xerrors.Errorf("load snapshot: edge %s: %w", edge.ID, graph.ErrUnknownEdgeLinks)
+		}
+		edge.UpdatedAt = edge.UpdatedAt.UTC()
+		g.edges[edge.ID] = edge
+		g.linkEdgeMap[edge.Src] = append(g.linkEdgeMap[edge.Src], edge.ID)
+	}
+	return g, nil
+}
+
+// countingWriter wraps an io.Writer and keeps track of the number of bytes
+// written to it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
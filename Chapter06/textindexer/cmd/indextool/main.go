@@ -0,0 +1,173 @@
+// Command indextool exports, imports and migrates the documents of text
+// indexers while preserving their PageRank and IndexedAt values.
+//
+// Usage:
+//
+//	indextool export  -src SPEC [-out FILE]
+//	indextool import  -dst SPEC [-in FILE] [-batch N]
+//	indextool migrate -src SPEC -dst SPEC [-batch N]
+//
+// Indexers are specified as "disk:PATH" for an on-disk bleve index or as
+// "es:NODE[,NODE...]" for an elasticsearch cluster. Exported documents are
+// written as JSON Lines; "-" denotes stdin or stdout.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"golang.org/x/xerrors"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/store/disk"
+	"test_project/Chapter06/textindexer/store/es"
+	"test_project/Chapter06/textindexer/transfer"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "indextool: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return xerrors.New("expected one of the export, import or migrate commands")
+	}
+
+	var (
+		fs        = flag.NewFlagSet(args[0], flag.ContinueOnError)
+		srcSpec   = fs.String("src", "", "the indexer to read documents from")
+		dstSpec   = fs.String("dst", "", "the indexer to write documents to")
+		inFile    = fs.String("in", "-", "the JSON Lines file to import")
+		outFile   = fs.String("out", "-", "the JSON Lines file to export to")
+		batchSize = fs.Int("batch", transfer.DefaultBatchSize, "the number of documents to write per request")
+	)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		select {
+		case <-sigCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var (
+		n   int
+		err error
+	)
+	switch args[0] {
+	case "export":
+		n, err = runExport(ctx, *srcSpec, *outFile)
+	case "import":
+		n, err = runImport(ctx, *dstSpec, *inFile, *batchSize)
+	case "migrate":
+		n, err = runMigrate(ctx, *srcSpec, *dstSpec, *batchSize)
+	default:
+		return xerrors.Errorf("unknown command %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: processed %d documents\n", args[0], n)
+	return nil
+}
+
+func runExport(ctx context.Context, srcSpec, outFile string) (int, error) {
+	src, closeSrc, err := openIndexer(srcSpec)
+	if err != nil {
+		return 0, err
+	}
+	defer closeSrc()
+
+	var w io.Writer = os.Stdout
+	if outFile != "-" {
+		f, err := os.Create(outFile)
+		if err != nil {
+			return 0, err
+		}
+		defer func() { _ = f.Close() }()
+		w = f
+	}
+	return transfer.Export(ctx, src, w)
+}
+
+func runImport(ctx context.Context, dstSpec, inFile string, batchSize int) (int, error) {
+	dst, closeDst, err := openIndexer(dstSpec)
+	if err != nil {
+		return 0, err
+	}
+	defer closeDst()
+
+	var r io.Reader = os.Stdin
+	if inFile != "-" {
+		f, err := os.Open(inFile)
+		if err != nil {
+			return 0, err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	return transfer.Import(ctx, dst, r, batchSize)
+}
+
+func runMigrate(ctx context.Context, srcSpec, dstSpec string, batchSize int) (int, error) {
+	src, closeSrc, err := openIndexer(srcSpec)
+	if err != nil {
+		return 0, err
+	}
+	defer closeSrc()
+	dst, closeDst, err := openIndexer(dstSpec)
+	if err != nil {
+		return 0, err
+	}
+	defer closeDst()
+	return transfer.Migrate(ctx, src, dst, batchSize)
+}
+
+// transferIndexer is implemented by the indexers that documents can be
+// exported from and imported into.
+type transferIndexer interface {
+	index.Scanner
+	index.Restorer
+}
+
+// openIndexer creates the indexer described by spec and returns it together
+// with a function for releasing its resources.
+func openIndexer(spec string) (transferIndexer, func(), error) {
+	kind, target := spec, ""
+	if sep := strings.IndexByte(spec, ':'); sep != -1 {
+		kind, target = spec[:sep], spec[sep+1:]
+	}
+	if target == "" {
+		return nil, nil, xerrors.Errorf("invalid indexer %q: expected disk:PATH or es:NODE[,NODE...]", spec)
+	}
+
+	switch kind {
+	case "disk":
+		idx, err := disk.NewPersistentBleveIndexer(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		return idx, func() { _ = idx.Close() }, nil
+	case "es":
+		idx, err := es.NewElasticSearchIndexer(strings.Split(target, ","), true)
+		if err != nil {
+			return nil, nil, err
+		}
+		return idx, func() {}, nil
+	default:
+		return nil, nil, xerrors.Errorf("invalid indexer %q: unknown kind %q", spec, kind)
+	}
+}
@@ -0,0 +1,157 @@
+package index
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// languageNames maps the ISO 639-1 codes of the languages for which stemmers
+// and stop word lists are available to their English names.
+var languageNames = map[string]string{
+	"da": "danish",
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fi": "finnish",
+	"fr": "french",
+	"hu": "hungarian",
+	"it": "italian",
+	"nl": "dutch",
+	"no": "norwegian",
+	"ro": "romanian",
+	"ru": "russian",
+	"sv": "swedish",
+	"tr": "turkish",
+}
+
+// SupportedLanguages returns the sorted list of ISO 639-1 codes of the
+// languages that can be used for text analysis.
+func SupportedLanguages() []string {
+	codes := make([]string, 0, len(languageNames))
+	for code := range languageNames {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// LanguageName returns the lowercase English name of the language with the
+// specified ISO 639-1 code or an empty string if the language is not
+// supported.
+func LanguageName(code string) string {
+	return languageNames[code]
+}
+
+// AnalysisConfig controls how the Title and Content of documents and the
+// text of search queries are split into terms. The zero value retains the
+// default analyzer of each indexer backend.
+//
+// Terms are always lowercased. Stop words are removed next, synonyms are
+// expanded and finally the terms are reduced to their stems.
+type AnalysisConfig struct {
+	// Language is the ISO 639-1 code of the language whose stemmer and
+	// stop word list are used. It must be one of the codes returned by
+	// SupportedLanguages.
+	Language string
+
+	// Stemming, if true, reduces terms to their stem so that e.g.
+	// "running" matches "run".
+	Stemming bool
+
+	// RemoveStopWords, if true, excludes stop words from the indexed
+	// terms. If StopWords is empty, the stop word list of Language is
+	// used.
+	RemoveStopWords bool
+
+	// StopWords overrides the stop word list of Language.
+	StopWords []string
+
+	// Synonyms is a list of groups of single-word terms that are treated
+	// as equivalent to each other.
+	Synonyms [][]string
+}
+
+// IsZero returns true if the configuration does not customize the text
+// analysis.
+func (cfg AnalysisConfig) IsZero() bool {
+	return cfg.Language == "" && !cfg.Stemming && !cfg.RemoveStopWords && len(cfg.StopWords) == 0 && len(cfg.Synonyms) == 0
+}
+
+// ForLanguage returns the configuration for analyzing text written in the
+// specified supported language. The returned configuration stems terms and
+// removes the stop words of the language while retaining the synonyms of
+// cfg.
+func (cfg AnalysisConfig) ForLanguage(language string) AnalysisConfig {
+	return AnalysisConfig{
+		Language:        language,
+		Stemming:        true,
+		RemoveStopWords: true,
+		Synonyms:        cfg.Synonyms,
+	}
+}
+
+// Validate returns an error if the configuration is not valid.
+func (cfg AnalysisConfig) Validate() error {
+	var err error
+	if cfg.Language != "" && LanguageName(cfg.Language) == "" {
+		err = multierror.Append(err, xerrors.Errorf("unsupported analysis language %q", cfg.Language))
+	}
+	if cfg.Language == "" && cfg.Stemming {
+		err = multierror.Append(err, xerrors.New("stemming requires an analysis language"))
+	}
+	if cfg.Language == "" && cfg.RemoveStopWords && len(cfg.StopWords) == 0 {
+		err = multierror.Append(err, xerrors.New("stop word removal requires an analysis language or a list of stop words"))
+	}
+	for _, word := range cfg.StopWords {
+		if !isSingleTerm(word) {
+			err = multierror.Append(err, xerrors.Errorf("stop word %q is not a single term", word))
+		}
+	}
+	for i, group := range cfg.Synonyms {
+		if len(group) < 2 {
+			err = multierror.Append(err, xerrors.Errorf("synonym group %d must contain at least two terms", i))
+		}
+		for _, term := range group {
+			if !isSingleTerm(term) {
+				err = multierror.Append(err, xerrors.Errorf("synonym %q in group %d is not a single term", term, i))
+			}
+		}
+	}
+	return err
+}
+
+// LowercaseStopWords returns the custom stop words in lowercase.
+func (cfg AnalysisConfig) LowercaseStopWords() []string {
+	words := make([]string, len(cfg.StopWords))
+	for i, word := range cfg.StopWords {
+		words[i] = strings.ToLower(word)
+	}
+	return words
+}
+
+// SynonymRules returns the synonym groups as lowercase, comma-separated lists
+// of equivalent terms.
+func (cfg AnalysisConfig) SynonymRules() []string {
+	rules := make([]string, len(cfg.Synonyms))
+	for i, group := range cfg.Synonyms {
+		rules[i] = strings.ToLower(strings.Join(group, ", "))
+	}
+	return rules
+}
+
+// isSingleTerm returns true if s consists of a single run of letters and
+// digits.
+func isSingleTerm(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package index
+
+import (
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(AnalysisTestSuite))
+
+type AnalysisTestSuite struct{}
+
+func (s *AnalysisTestSuite) TestValidate(c *gc.C) {
+	valid := []AnalysisConfig{
+		{},
+		{Language: "en", Stemming: true, RemoveStopWords: true},
+		{RemoveStopWords: true, StopWords: []string{"the", "a"}},
+		{Synonyms: [][]string{{"car", "automobile", "Auto"}}},
+	}
+	for _, cfg := range valid {
+		c.Assert(cfg.Validate(), gc.IsNil, gc.Commentf("%+v", cfg))
+	}
+
+	invalid := []AnalysisConfig{
+		{Language: "xx"},
+		{Stemming: true},
+		{RemoveStopWords: true},
+		{StopWords: []string{"stop word"}},
+		{Synonyms: [][]string{{"car"}}},
+		{Synonyms: [][]string{{"car", "motor vehicle"}}},
+	}
+	for _, cfg := range invalid {
+		c.Assert(cfg.Validate(), gc.NotNil, gc.Commentf("%+v", cfg))
+	}
+}
+
+func (s *AnalysisTestSuite) TestSynonymRules(c *gc.C) {
+	cfg := AnalysisConfig{Synonyms: [][]string{{"Car", "automobile"}, {"tv", "television", "telly"}}}
+	c.Assert(cfg.SynonymRules(), gc.DeepEquals, []string{"car, automobile", "tv, television, telly"})
+}
@@ -0,0 +1,142 @@
+package index
+
+import (
+	"github.com/google/uuid"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultCompletionLimit is the number of completions that are returned if
+// no limit is specified.
+const DefaultCompletionLimit = 10
+
+// MaxCompletionCandidates is the maximum number of documents whose titles
+// are examined when completing a query prefix.
+const MaxCompletionCandidates = 100
+
+// MaxCompletionWordLength is the maximum number of leading characters of
+// each title word that are indexed for completion. Longer query words only
+// need to match the leading characters of title words.
+const MaxCompletionWordLength = 20
+
+// MinCompletionWordLength is the number of characters that at least one
+// word of a query prefix must have for the prefix to be completed. Shorter
+// prefixes match the titles of a large fraction of the indexed documents,
+// all of which would have to be ranked by PageRank.
+const MinCompletionWordLength = 2
+
+// CompletionType describes what a completion is derived from.
+type CompletionType uint8
+
+const (
+	// CompletionTypeTitle completions are the title of a document.
+	CompletionTypeTitle CompletionType = iota
+
+	// CompletionTypeTerm completions replace the last, partially typed
+	// word of a query prefix with a complete word from a document title.
+	CompletionTypeTerm
+)
+
+// Completion is a suggested completion of a partially typed query.
+type Completion struct {
+	Type CompletionType
+	Text string
+
+	// LinkID and PageRank identify the document that the completion was
+	// derived from. Completions are ranked by the PageRank of their
+	// documents.
+	LinkID   uuid.UUID
+	PageRank float64
+}
+
+// CompletionWords returns the lowercase words of a query prefix that the
+// words of a document title must start with for the title to be a candidate
+// for completing the prefix. Words are truncated to MaxCompletionWordLength
+// characters. It returns nil if no word has at least MinCompletionWordLength
+// characters.
+func CompletionWords(prefix string) []string {
+	var (
+		words    = completionWords(prefix)
+		selected bool
+	)
+	for i, word := range words {
+		n := utf8.RuneCountInString(word)
+		if n > MaxCompletionWordLength {
+			words[i] = string([]rune(word)[:MaxCompletionWordLength])
+		}
+		selected = selected || n >= MinCompletionWordLength
+	}
+	if !selected {
+		return nil
+	}
+	return words
+}
+
+// MakeCompletions returns up to limit completions for prefix or
+// DefaultCompletionLimit completions if limit is not positive. The
+// candidates are the documents whose title contains a word starting with
+// each of the CompletionWords of prefix, ordered by descending PageRank.
+//
+// Each candidate contributes its title, unless an earlier candidate has the
+// same title, followed by the title words that complete the last word of
+// prefix and have not been suggested yet. If prefix ends with a separator,
+// its last word is considered complete and only titles are returned.
+func MakeCompletions(prefix string, candidates []*Document, limit int) []Completion {
+	if limit <= 0 {
+		limit = DefaultCompletionLimit
+	}
+	var (
+		head, lastWord = splitLastWord(prefix)
+		seenTitles     = make(map[string]bool)
+		seenTerms      = make(map[string]bool)
+		completions    []Completion
+	)
+	for _, doc := range candidates {
+		if len(completions) >= limit {
+			break
+		}
+		title := strings.Join(strings.Fields(doc.Title), " ")
+		if key := strings.ToLower(title); title != "" && !seenTitles[key] {
+			seenTitles[key] = true
+			completions = append(completions, Completion{Type: CompletionTypeTitle, Text: title, LinkID: doc.LinkID, PageRank: doc.PageRank})
+		}
+		if lastWord == "" {
+			continue
+		}
+		for _, word := range completionWords(doc.Title) {
+			if word == lastWord || !strings.HasPrefix(word, lastWord) || seenTerms[word] {
+				continue
+			}
+			seenTerms[word] = true
+			completions = append(completions, Completion{Type: CompletionTypeTerm, Text: head + word, LinkID: doc.LinkID, PageRank: doc.PageRank})
+		}
+	}
+	if len(completions) > limit {
+		completions = completions[:limit]
+	}
+	return completions
+}
+
+// splitLastWord splits prefix into the text preceding its last word and the
+// lowercase last word. If prefix does not end with a word, the returned word
+// is empty.
+func splitLastWord(prefix string) (string, string) {
+	start := strings.LastIndexFunc(prefix, isWordSeparator)
+	if start < 0 {
+		start = 0
+	} else {
+		_, size := utf8.DecodeRuneInString(prefix[start:])
+		start += size
+	}
+	return prefix[:start], strings.ToLower(prefix[start:])
+}
+
+// completionWords returns the lowercase words of text.
+func completionWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isWordSeparator)
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+}
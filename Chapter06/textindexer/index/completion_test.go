@@ -0,0 +1,46 @@
+package index
+
+import (
+	"github.com/google/uuid"
+	gc "gopkg.in/check.v1"
+	"strings"
+)
+
+var _ = gc.Suite(new(CompletionTestSuite))
+
+type CompletionTestSuite struct{}
+
+func (s *CompletionTestSuite) TestCompletionWords(c *gc.C) {
+	c.Assert(CompletionWords("  Quick, BROWN fo"), gc.DeepEquals, []string{"quick", "brown", "fo"})
+	c.Assert(CompletionWords(strings.Repeat("a", 30)), gc.DeepEquals, []string{strings.Repeat("a", MaxCompletionWordLength)})
+	c.Assert(CompletionWords(" ,. "), gc.HasLen, 0)
+
+	// At least one word must be long enough to narrow down the titles.
+	c.Assert(CompletionWords("a b"), gc.HasLen, 0)
+	c.Assert(CompletionWords("a go"), gc.DeepEquals, []string{"a", "go"})
+}
+
+func (s *CompletionTestSuite) TestMakeCompletions(c *gc.C) {
+	candidates := []*Document{
+		{LinkID: uuid.New(), Title: "Go  programming", PageRank: 0.9},
+		{LinkID: uuid.New(), Title: "Gophers and goroutines", PageRank: 0.5},
+		{LinkID: uuid.New(), Title: "go programming", PageRank: 0.4},
+		{LinkID: uuid.New(), Title: "Go gophers", PageRank: 0.1},
+	}
+
+	got := MakeCompletions("learn Go", candidates, 0)
+	c.Assert(got, gc.DeepEquals, []Completion{
+		{Type: CompletionTypeTitle, Text: "Go programming", LinkID: candidates[0].LinkID, PageRank: 0.9},
+		{Type: CompletionTypeTitle, Text: "Gophers and goroutines", LinkID: candidates[1].LinkID, PageRank: 0.5},
+		{Type: CompletionTypeTerm, Text: "learn gophers", LinkID: candidates[1].LinkID, PageRank: 0.5},
+		{Type: CompletionTypeTerm, Text: "learn goroutines", LinkID: candidates[1].LinkID, PageRank: 0.5},
+		{Type: CompletionTypeTitle, Text: "Go gophers", LinkID: candidates[3].LinkID, PageRank: 0.1},
+	})
+
+	// A trailing separator completes the last word.
+	got = MakeCompletions("go ", candidates, 2)
+	c.Assert(got, gc.HasLen, 2)
+	for _, completion := range got {
+		c.Assert(completion.Type, gc.Equals, CompletionTypeTitle)
+	}
+}
@@ -0,0 +1,110 @@
+package index
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"math"
+)
+
+// DefaultPageSize is the number of results that iterators fetch per request
+// when the query does not specify a page size.
+const DefaultPageSize = 10
+
+const (
+	// The encoded length of a cursor: a float64 score followed by a link
+	// ID.
+	cursorLen = 8 + 16
+
+	// The encoded length of a group cursor: a uint64 group offset
+	// followed by a uint32 hit offset and, optionally, the cursor of the
+	// group's leading document.
+	groupCursorLen     = 8 + 4
+	groupLeadCursorLen = groupCursorLen + cursorLen
+)
+
+// Cursor identifies the position of a document within the results of a
+// search query. Results are ordered by descending score with ties broken by
+// ascending link ID so each position is unique and stable.
+type Cursor struct {
+	Score  float64
+	LinkID uuid.UUID
+}
+
+// Encode returns the cursor as an opaque token that can be used as the Cursor
+// of a Query.
+func (c Cursor) Encode() string {
+	var buf [cursorLen]byte
+	binary.BigEndian.PutUint64(buf[:8], math.Float64bits(c.Score))
+	copy(buf[8:], c.LinkID[:])
+	return base64.RawURLEncoding.EncodeToString(buf[:])
+}
+
+// DecodeCursor parses a token returned by Cursor.Encode.
+func DecodeCursor(token string) (Cursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(buf) != cursorLen {
+		return Cursor{}, xerrors.Errorf("decode cursor: %w", ErrInvalidCursor)
+	}
+
+	var c Cursor
+	c.Score = math.Float64frombits(binary.BigEndian.Uint64(buf[:8]))
+	copy(c.LinkID[:], buf[8:])
+	return c, nil
+}
+
+// GroupCursor identifies the position of a document within the results of a
+// search query that collapses results by host. Group is the number of host
+// groups that precede the document's group and Hit is the number of documents
+// of that group that were returned up to and including the document.
+//
+// Lead, if set, is the position of the first document of the group within the
+// uncollapsed results. It allows iterators to resume scanning the results for
+// host groups at the group instead of the first result.
+type GroupCursor struct {
+	Group uint64
+	Hit   uint32
+	Lead  *Cursor
+}
+
+// Encode returns the cursor as an opaque token that can be used as the Cursor
+// of a Query that collapses results.
+func (c GroupCursor) Encode() string {
+	buf := make([]byte, groupCursorLen, groupLeadCursorLen)
+	binary.BigEndian.PutUint64(buf[:8], c.Group)
+	binary.BigEndian.PutUint32(buf[8:], c.Hit)
+	if c.Lead != nil {
+		var lead [8]byte
+		binary.BigEndian.PutUint64(lead[:], math.Float64bits(c.Lead.Score))
+		buf = append(append(buf, lead[:]...), c.Lead.LinkID[:]...)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// DecodeGroupCursor parses a token returned by GroupCursor.Encode.
+func DecodeGroupCursor(token string) (GroupCursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || (len(buf) != groupCursorLen && len(buf) != groupLeadCursorLen) {
+		return GroupCursor{}, xerrors.Errorf("decode group cursor: %w", ErrInvalidCursor)
+	}
+
+	c := GroupCursor{
+		Group: binary.BigEndian.Uint64(buf[:8]),
+		Hit:   binary.BigEndian.Uint32(buf[8:12]),
+	}
+	if len(buf) == groupLeadCursorLen {
+		c.Lead = &Cursor{Score: math.Float64frombits(binary.BigEndian.Uint64(buf[12:20]))}
+		copy(c.Lead.LinkID[:], buf[20:])
+	}
+	return c, nil
+}
+
+// PageSizeOrDefault returns q.PageSize or DefaultPageSize if the query does
+// not specify a page size.
+func (q Query) PageSizeOrDefault() int {
+	if q.PageSize <= 0 {
+		return DefaultPageSize
+	}
+	return q.PageSize
+}
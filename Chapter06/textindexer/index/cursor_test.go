@@ -0,0 +1,44 @@
+package index
+
+import (
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	gc "gopkg.in/check.v1"
+	"math"
+)
+
+var _ = gc.Suite(new(CursorTestSuite))
+
+type CursorTestSuite struct{}
+
+func (s *CursorTestSuite) TestEncodeDecode(c *gc.C) {
+	for _, score := range []float64{0, 1.5, -3.25, math.MaxFloat64, math.SmallestNonzeroFloat64} {
+		exp := Cursor{Score: score, LinkID: uuid.New()}
+		got, err := DecodeCursor(exp.Encode())
+		c.Assert(err, gc.IsNil)
+		c.Assert(got, gc.Equals, exp)
+	}
+}
+
+func (s *CursorTestSuite) TestDecodeInvalid(c *gc.C) {
+	valid := Cursor{Score: 1, LinkID: uuid.New()}.Encode()
+	for _, token := range []string{"", "!!!", valid[:len(valid)-2], valid + "AA"} {
+		_, err := DecodeCursor(token)
+		c.Assert(xerrors.Is(err, ErrInvalidCursor), gc.Equals, true, gc.Commentf("token %q", token))
+	}
+}
+
+func (s *CursorTestSuite) TestEncodeDecodeGroupCursor(c *gc.C) {
+	lead := &Cursor{Score: 0.25, LinkID: uuid.New()}
+	for _, exp := range []GroupCursor{{}, {Group: 3, Hit: 2}, {Group: math.MaxUint64, Hit: math.MaxUint32}, {Group: 1, Hit: 1, Lead: lead}} {
+		got, err := DecodeGroupCursor(exp.Encode())
+		c.Assert(err, gc.IsNil)
+		c.Assert(got, gc.DeepEquals, exp)
+	}
+
+	// Cursors of non-collapsing searches are rejected and vice versa.
+	_, err := DecodeGroupCursor(Cursor{Score: 1, LinkID: uuid.New()}.Encode())
+	c.Assert(xerrors.Is(err, ErrInvalidCursor), gc.Equals, true)
+	_, err = DecodeCursor(GroupCursor{Group: 1, Hit: 1}.Encode())
+	c.Assert(xerrors.Is(err, ErrInvalidCursor), gc.Equals, true)
+}
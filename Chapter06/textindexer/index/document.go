@@ -12,4 +12,14 @@ type Document struct {
 	Content   string
 	IndexedAt time.Time
 	PageRank  float64
+
+	// Fingerprint is a simhash of Content that the indexer populates
+	// when the document is indexed.
+	Fingerprint uint64
+
+	// Language is the ISO 639-1 code of the language of Content as
+	// returned by DetectLanguage. If it is one of the SupportedLanguages,
+	// the indexer additionally analyzes Content using the stemmer and stop
+	// words of that language.
+	Language string
 }
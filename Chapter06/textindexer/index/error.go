@@ -1,6 +1,11 @@
 package index
 
-import "golang.org/x/xerrors"
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"strings"
+)
 
 var (
 	// ErrNotFound is returned by the indexer when attempting to look up
@@ -10,4 +15,47 @@ var (
 	// ErrMissingLinkID is returned when attempting to index a document
 	// that does not specify a valid link ID.
 	ErrMissingLinkID = xerrors.New("document does not provide a valid linkID")
+
+	// ErrInvalidQuery is returned when a search query cannot be parsed.
+	ErrInvalidQuery = xerrors.New("invalid query")
+
+	// ErrInvalidCursor is returned when a search query specifies a
+	// malformed cursor.
+	ErrInvalidCursor = xerrors.New("invalid cursor")
 )
+
+// ItemError describes the failure to process a single item of a bulk
+// operation.
+type ItemError struct {
+	// The position of the failed item in the bulk operation input.
+	Index int
+
+	LinkID uuid.UUID
+	Err    error
+}
+
+// Error implements the error interface.
+func (e ItemError) Error() string {
+	return fmt.Sprintf("item %d (link ID %s): %v", e.Index, e.LinkID, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e ItemError) Unwrap() error {
+	return e.Err
+}
+
+// BulkError is returned by bulk operations when one or more items could not
+// be processed. Items that are not listed in Items were processed
+// successfully.
+type BulkError struct {
+	Items []ItemError
+}
+
+// Error implements the error interface.
+func (e *BulkError) Error() string {
+	msgs := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		msgs[i] = item.Error()
+	}
+	return fmt.Sprintf("%d bulk item(s) failed: %s", len(e.Items), strings.Join(msgs, "; "))
+}
@@ -0,0 +1,137 @@
+package index
+
+import (
+	"math"
+	"time"
+)
+
+// FacetOptions controls the facet counts that are calculated for the set of
+// documents matching a search query.
+type FacetOptions struct {
+	// HostSize is the maximum number of hosts to return counts for. If
+	// not specified, a default value of 10 will be used.
+	HostSize int
+
+	// DateInterval is the width of each IndexedAt bucket. Buckets are
+	// aligned to multiples of DateInterval since the Unix epoch. If not
+	// specified, a default value of 24h will be used.
+	DateInterval time.Duration
+
+	// DateBuckets is the number of IndexedAt buckets to return counts
+	// for. If not specified, a default value of 7 will be used.
+	DateBuckets int
+
+	// DateEnd specifies a time that falls within the last IndexedAt
+	// bucket. If not specified, the current time will be used.
+	DateEnd time.Time
+
+	// PageRankRanges are the PageRank ranges to return counts for. If not
+	// specified, DefaultPageRankRanges will be used.
+	PageRankRanges []PageRankRange
+}
+
+// DefaultPageRankRanges are the PageRank ranges used for faceting when no
+// ranges are explicitly specified.
+var DefaultPageRankRanges = []PageRankRange{
+	{Min: 0, Max: 0.001},
+	{Min: 0.001, Max: 0.01},
+	{Min: 0.01, Max: 0.1},
+	{Min: 0.1},
+}
+
+// WithDefaults returns a copy of the options with any unspecified values
+// set to their defaults.
+func (o FacetOptions) WithDefaults() FacetOptions {
+	if o.HostSize <= 0 {
+		o.HostSize = 10
+	}
+	if o.DateInterval <= 0 {
+		o.DateInterval = 24 * time.Hour
+	}
+	if o.DateBuckets <= 0 {
+		o.DateBuckets = 7
+	}
+	if o.DateEnd.IsZero() {
+		o.DateEnd = time.Now()
+	}
+	if len(o.PageRankRanges) == 0 {
+		o.PageRankRanges = DefaultPageRankRanges
+	}
+	return o
+}
+
+// DateRanges returns the IndexedAt buckets described by the options in
+// ascending order. It should be invoked on options with defaults applied.
+func (o FacetOptions) DateRanges() []DateRange {
+	interval := int64(o.DateInterval)
+	endNanos := o.DateEnd.UnixNano()
+	lastStart := endNanos - endNanos%interval
+	if endNanos < 0 && endNanos%interval != 0 {
+		lastStart -= interval
+	}
+
+	ranges := make([]DateRange, o.DateBuckets)
+	for i := range ranges {
+		start := lastStart - int64(o.DateBuckets-1-i)*interval
+		ranges[i] = DateRange{
+			Start: time.Unix(0, start).UTC(),
+			End:   time.Unix(0, start+interval).UTC(),
+		}
+	}
+	return ranges
+}
+
+// DateRange describes the [Start, End) time range of an IndexedAt bucket.
+type DateRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// PageRankRange describes a [Min, Max) PageRank range. A zero Max value
+// indicates that the range is unbounded.
+type PageRankRange struct {
+	Min float64
+	Max float64
+}
+
+// UpperBound returns the upper bound of the range or +Inf if the range is
+// unbounded.
+func (r PageRankRange) UpperBound() float64 {
+	if r.Max == 0 {
+		return math.Inf(1)
+	}
+	return r.Max
+}
+
+// Facets contains the facet counts for the documents that matched a query.
+type Facets struct {
+	// Hosts contains the hosts with the most matching documents, in
+	// descending count order.
+	Hosts []HostCount
+
+	// IndexedAt contains a count for each of the requested IndexedAt
+	// buckets, in ascending time order.
+	IndexedAt []DateCount
+
+	// PageRank contains a count for each of the requested PageRank
+	// ranges, in the order they were requested.
+	PageRank []PageRankCount
+}
+
+// HostCount is the number of matching documents for a particular host.
+type HostCount struct {
+	Host  string
+	Count uint64
+}
+
+// DateCount is the number of matching documents in an IndexedAt bucket.
+type DateCount struct {
+	DateRange
+	Count uint64
+}
+
+// PageRankCount is the number of matching documents in a PageRank range.
+type PageRankCount struct {
+	PageRankRange
+	Count uint64
+}
@@ -0,0 +1,106 @@
+package index
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MaxDuplicateDistance is the maximum number of bits by which the
+// fingerprints of two documents may differ for the documents to be
+// considered near-duplicates.
+const MaxDuplicateDistance = 7
+
+// The number of words in each shingle used for calculating fingerprints.
+const shingleSize = 2
+
+// Fingerprint calculates a 64-bit simhash of content. Similar content yields
+// fingerprints that differ in a small number of bits. An empty content yields
+// a zero fingerprint.
+func Fingerprint(content string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	var (
+		weights [64]int
+		hasher  = fnv.New64a()
+		size    = shingleSize
+	)
+	if len(words) < size {
+		size = len(words)
+	}
+	for i := 0; i+size <= len(words); i++ {
+		hasher.Reset()
+		_, _ = hasher.Write([]byte(strings.Join(words[i:i+size], " ")))
+		h := hasher.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if h&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fp uint64
+	for bit, w := range weights {
+		if w > 0 {
+			fp |= 1 << uint(bit)
+		}
+	}
+	return fp
+}
+
+// FingerprintDistance returns the number of bits by which two fingerprints
+// differ.
+func FingerprintDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// FingerprintBands splits a fingerprint into MaxDuplicateDistance+1 bands
+// and returns a term for each band. As fingerprints that differ by at most
+// MaxDuplicateDistance bits share at least one band, indexers use these terms
+// for finding candidate near-duplicates.
+func FingerprintBands(fp uint64) []string {
+	const (
+		numBands = MaxDuplicateDistance + 1
+		bandBits = 64 / numBands
+	)
+	bands := make([]string, numBands)
+	for i := range bands {
+		band := (fp >> uint(i*bandBits)) & (1<<bandBits - 1)
+		bands[i] = fmt.Sprintf("%d:%x", i, band)
+	}
+	return bands
+}
+
+// NearDuplicates returns the candidates whose fingerprint differs from the
+// fingerprint of doc by at most MaxDuplicateDistance bits, ordered by
+// descending PageRank and then by link ID. doc itself and documents with an
+// empty fingerprint are excluded. Indexers use NearDuplicates for refining
+// the set of documents that share a fingerprint band with doc.
+func NearDuplicates(doc *Document, candidates []*Document) []*Document {
+	var dups []*Document
+	for _, candidate := range candidates {
+		if candidate.LinkID == doc.LinkID || candidate.Fingerprint == 0 {
+			continue
+		}
+		if FingerprintDistance(doc.Fingerprint, candidate.Fingerprint) <= MaxDuplicateDistance {
+			dups = append(dups, candidate)
+		}
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		if dups[i].PageRank != dups[j].PageRank {
+			return dups[i].PageRank > dups[j].PageRank
+		}
+		return dups[i].LinkID.String() < dups[j].LinkID.String()
+	})
+	return dups
+}
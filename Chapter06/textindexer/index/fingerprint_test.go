@@ -0,0 +1,61 @@
+package index
+
+import (
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(FingerprintTestSuite))
+
+type FingerprintTestSuite struct{}
+
+const fingerprintText = `The gopher is a small burrowing rodent that lives in North America.
+Gophers spend most of their lives underground, digging extensive tunnel systems
+with their strong claws. They feed on roots, tubers and other plant material
+they encounter while digging, and they rarely venture far from their burrows.`
+
+func (s *FingerprintTestSuite) TestNearDuplicates(c *gc.C) {
+	base := Fingerprint(fingerprintText)
+	c.Assert(Fingerprint(fingerprintText), gc.Equals, base, gc.Commentf("fingerprint is not deterministic"))
+	c.Assert(Fingerprint("THE GOPHER, is a small... "+fingerprintText[len("The gopher is a small "):]), gc.Equals, base,
+		gc.Commentf("fingerprint should ignore case and punctuation"))
+
+	nearDuplicates := []string{
+		fingerprintText + " Copyright 2019 Mirror Site.",
+		"Welcome to the mirror. " + fingerprintText,
+		`The gopher is a small burrowing rodent that lives in North America.
+Gophers spend most of their lives underground, digging large tunnel systems
+with their strong claws. They feed on roots, tubers and other plant material
+they encounter while digging, and they rarely venture far from their burrows.`,
+	}
+	for _, text := range nearDuplicates {
+		dist := FingerprintDistance(base, Fingerprint(text))
+		c.Assert(dist <= MaxDuplicateDistance, gc.Equals, true, gc.Commentf("distance %d for %q", dist, text))
+	}
+
+	unrelated := Fingerprint("Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.")
+	c.Assert(FingerprintDistance(base, unrelated) > MaxDuplicateDistance, gc.Equals, true)
+}
+
+func (s *FingerprintTestSuite) TestEmptyContent(c *gc.C) {
+	c.Assert(Fingerprint(""), gc.Equals, uint64(0))
+	c.Assert(Fingerprint(" ... "), gc.Equals, uint64(0))
+}
+
+func (s *FingerprintTestSuite) TestBandsOfNearFingerprintsOverlap(c *gc.C) {
+	fp := Fingerprint(fingerprintText)
+	bands := FingerprintBands(fp)
+	c.Assert(bands, gc.HasLen, MaxDuplicateDistance+1)
+
+	// Flip MaxDuplicateDistance bits, each in a different band.
+	flipped := fp
+	for i := 0; i < MaxDuplicateDistance; i++ {
+		flipped ^= 1 << uint(i*64/(MaxDuplicateDistance+1))
+	}
+	var shared int
+	for i, band := range FingerprintBands(flipped) {
+		if band == bands[i] {
+			shared++
+		}
+	}
+	c.Assert(shared, gc.Equals, 1)
+}
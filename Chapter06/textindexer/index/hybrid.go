@@ -0,0 +1,41 @@
+package index
+
+import "math"
+
+// DefaultVectorWeight is the weight of the cosine similarity in the fused
+// score of hybrid queries that do not specify a VectorWeight.
+const DefaultVectorWeight = 0.5
+
+// MaxHybridCandidates is the maximum number of documents that are retrieved
+// by each of the lexical and the vector part of a hybrid query. Only these
+// documents are scored and returned.
+const MaxHybridCandidates = 100
+
+// MinHybridSimilarity is the minimum cosine similarity of documents that are
+// retrieved by the vector part of a hybrid query. Hashed embeddings of
+// unrelated texts have small similarities due to hash collisions between
+// their features; such documents are not considered.
+const MinHybridSimilarity = 0.1
+
+// VectorWeightOrDefault returns q.VectorWeight or DefaultVectorWeight if the
+// query does not specify a vector weight.
+func (q Query) VectorWeightOrDefault() float64 {
+	if q.VectorWeight == nil {
+		return DefaultVectorWeight
+	}
+	return *q.VectorWeight
+}
+
+// FuseScores combines the lexical (BM25) score of a hybrid query result with
+// the cosine similarity between the embeddings of the query expression and
+// the document. The lexical score is normalized into the [0, 1] range by
+// dividing it by maxLexical, the highest lexical score of all results, and
+// negative similarities are treated as zero. The fused score is the weighted
+// sum of both values.
+func FuseScores(lexical, maxLexical, cosine, vectorWeight float64) float64 {
+	var normLexical float64
+	if maxLexical > 0 && lexical > 0 {
+		normLexical = math.Min(lexical/maxLexical, 1)
+	}
+	return (1-vectorWeight)*normLexical + vectorWeight*math.Max(cosine, 0)
+}
@@ -0,0 +1,39 @@
+package index
+
+import (
+	gc "gopkg.in/check.v1"
+	"math"
+)
+
+var _ = gc.Suite(new(HybridTestSuite))
+
+type HybridTestSuite struct{}
+
+func (s *HybridTestSuite) TestFuseScores(c *gc.C) {
+	specs := []struct {
+		lexical, maxLexical, cosine, weight float64
+		exp                                 float64
+	}{
+		{lexical: 4, maxLexical: 4, cosine: 1, weight: 0.5, exp: 1},
+		{lexical: 2, maxLexical: 4, cosine: 0, weight: 0.5, exp: 0.25},
+		{lexical: 0, maxLexical: 4, cosine: 0.5, weight: 0.5, exp: 0.25},
+		{lexical: 2, maxLexical: 4, cosine: 0.5, weight: 0.2, exp: 0.5},
+		{lexical: 2, maxLexical: 4, cosine: 0.5, weight: 1, exp: 0.5},
+		{lexical: 2, maxLexical: 4, cosine: -0.5, weight: 0.5, exp: 0.25},
+		{lexical: 0, maxLexical: 0, cosine: 0.8, weight: 0.5, exp: 0.4},
+	}
+	for i, spec := range specs {
+		got := FuseScores(spec.lexical, spec.maxLexical, spec.cosine, spec.weight)
+		c.Assert(math.Abs(got-spec.exp) < 1e-9, gc.Equals, true, gc.Commentf("spec %d: got %v, expected %v", i, got, spec.exp))
+	}
+}
+
+func (s *HybridTestSuite) TestVectorWeightOrDefault(c *gc.C) {
+	c.Assert(Query{}.VectorWeightOrDefault(), gc.Equals, DefaultVectorWeight)
+	weight := 0.3
+	c.Assert(Query{VectorWeight: &weight}.VectorWeightOrDefault(), gc.Equals, 0.3)
+
+	// A zero weight is distinct from an unspecified one.
+	weight = 0
+	c.Assert(Query{VectorWeight: &weight}.VectorWeightOrDefault(), gc.Equals, 0.0)
+}
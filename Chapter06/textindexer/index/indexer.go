@@ -1,18 +1,174 @@
 package index
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
 
 type Query struct {
 	Type       QueryType
 	Expression string
 	Offset     uint64
+
+	// Highlight, if specified, requests highlighted fragments of the
+	// Title and Content fields for each search result.
+	Highlight *HighlightOptions
+
+	// Filters restricts the search results to the documents that satisfy
+	// all of the specified filters.
+	Filters Filters
+
+	// Facets, if specified, requests facet counts for the documents that
+	// match the query.
+	Facets *FacetOptions
+
+	// Ranking, if specified, overrides the DefaultRanking used for
+	// ordering the search results.
+	Ranking *Ranking
+
+	// PageSize is the number of results that the iterator fetches per
+	// request. If not specified, DefaultPageSize will be used.
+	PageSize int
+
+	// Cursor, if specified, resumes the iteration of a previous search
+	// after the document whose cursor was obtained via Iterator.Cursor.
+	// The remaining query fields should match the original query. Offset
+	// is ignored when a cursor is specified.
+	Cursor string
+
+	// Collapse, if specified, groups the matching documents by URL host
+	// and returns at most MaxPerHost documents for each host. Groups are
+	// ordered by their best document and the documents of each group are
+	// returned consecutively. When collapsing, Offset, PageSize and the
+	// iterator's TotalCount refer to host groups rather than documents.
+	// Like the number of matching documents, indexers may approximate
+	// the number of host groups when there are many of them.
+	Collapse *CollapseOptions
+
+	// VectorWeight is the weight of the cosine similarity between the
+	// embeddings of the expression and each document in the fused score
+	// of QueryTypeHybrid queries. It must be in the [0, 1] range; the
+	// lexical score is weighted by 1 - VectorWeight. If nil,
+	// DefaultVectorWeight will be used.
+	VectorWeight *float64
+}
+
+// CollapseOptions controls the collapsing of search results by URL host.
+type CollapseOptions struct {
+	// MaxPerHost is the maximum number of documents to return for each
+	// host. If not specified, a default value of 1 will be used.
+	MaxPerHost int
+}
+
+// WithDefaults returns a copy of the options with any unspecified values
+// set to their defaults.
+func (o CollapseOptions) WithDefaults() CollapseOptions {
+	if o.MaxPerHost <= 0 {
+		o.MaxPerHost = 1
+	}
+	return o
+}
+
+// Filters describes a set of restrictions that documents must satisfy to be
+// included in the search results. The zero value does not filter any
+// documents.
+type Filters struct {
+	// Host, if specified, only matches documents whose URL host is Host or
+	// one of its subdomains.
+	Host string
+
+	// URLPrefix, if specified, only matches documents whose URL starts
+	// with URLPrefix.
+	URLPrefix string
+
+	// IndexedSince and IndexedBefore, if specified, only match documents
+	// whose IndexedAt value is within the [IndexedSince, IndexedBefore)
+	// range.
+	IndexedSince  time.Time
+	IndexedBefore time.Time
+
+	// MinPageRank, if greater than zero, only matches documents whose
+	// PageRank score is at least MinPageRank.
+	MinPageRank float64
+
+	// Language, if specified, only matches documents whose Language is
+	// Language. If Language is one of the SupportedLanguages, query terms
+	// are matched against the Content of the documents as analyzed for
+	// that language. Without a Language filter, query terms are matched
+	// against both the plain Content and the Content as analyzed for the
+	// language of each document.
+	Language string
+
+	// LinkIDs, if not empty, only matches the documents whose link ID is
+	// one of LinkIDs.
+	LinkIDs []uuid.UUID
+}
+
+// HighlightOptions controls the generation of highlighted fragments for
+// search results.
+type HighlightOptions struct {
+	// FragmentSize is the approximate size of each fragment in
+	// characters. If not specified, a default value of 100 will be used.
+	FragmentSize int
+
+	// NumFragments is the maximum number of fragments to return for each
+	// field. If not specified, a default value of 3 will be used.
+	NumFragments int
+
+	// PreTag and PostTag are used to wrap each matched term. If not
+	// specified, "<em>" and "</em>" will be used.
+	PreTag  string
+	PostTag string
+}
+
+// WithDefaults returns a copy of the options with any unspecified values
+// set to their defaults.
+func (o HighlightOptions) WithDefaults() HighlightOptions {
+	if o.FragmentSize <= 0 {
+		o.FragmentSize = 100
+	}
+	if o.NumFragments <= 0 {
+		o.NumFragments = 3
+	}
+	if o.PreTag == "" && o.PostTag == "" {
+		o.PreTag, o.PostTag = "<em>", "</em>"
+	}
+	return o
+}
+
+// Highlights contains the highlighted fragments for a search result.
+type Highlights struct {
+	Title   []string
+	Content []string
+}
+
+// ScoreUpdate associates a PageRank score with a link ID.
+type ScoreUpdate struct {
+	LinkID uuid.UUID
+	Score  float64
 }
 
 type QueryType uint8
 
 const (
+	// QueryTypeMatch matches documents containing any of the terms of
+	// the expression. An empty expression matches all documents that
+	// satisfy the query filters.
 	QueryTypeMatch QueryType = iota
 	QueryTypePhrase
+
+	// QueryTypeAdvanced interprets the expression using the syntax
+	// supported by ParseQuery.
+	QueryTypeAdvanced
+
+	// QueryTypeHybrid matches the expression like QueryTypeMatch and
+	// additionally retrieves the documents whose dense vector embedding
+	// is most similar to that of the expression. The results are ordered
+	// by a weighted sum of both scores as described by FuseScores. It is
+	// only supported by indexers that maintain a vector index; other
+	// indexers reject it with ErrInvalidQuery.
+	QueryTypeHybrid
 )
 
 type Iterator interface {
@@ -21,11 +177,137 @@ type Iterator interface {
 	Error() error
 	Document() *Document
 	TotalCount() uint64
+
+	// Highlights returns the highlighted fragments for the current
+	// document or nil if the query did not request highlighting.
+	Highlights() *Highlights
+
+	// Facets returns the facet counts for the documents matching the
+	// query or nil if the query did not request facets.
+	Facets() *Facets
+
+	// Cursor returns an opaque continuation token for the current
+	// document. Searching with the token as the query Cursor returns the
+	// results that follow the current document.
+	Cursor() string
+
+	// Collapsed returns the number of documents from the host of the
+	// current document that matched the query but were omitted due to
+	// collapsing. It returns zero if the query did not request
+	// collapsing.
+	Collapsed() uint64
+
+	// Score returns the relevance score of the current document. Results
+	// are ordered by descending score.
+	Score() float64
 }
 
+// DocumentIterator is implemented by objects that iterate over a set of
+// documents.
+type DocumentIterator interface {
+	Close() error
+	Next() bool
+	Error() error
+	Document() *Document
+}
+
+// Indexer is implemented by text indexer stores. The provided context is
+// used for cancelling in-flight requests; for Search, it also bounds any
+// result pages that the returned Iterator fetches lazily.
+//
+// Capabilities that not every indexer provides are described by separate
+// interfaces such as DuplicateFinder. Callers discover them via type
+// assertions on the Indexer.
 type Indexer interface {
-	Index(doc *Document) error
-	FindByID(linkID uuid.UUID) (*Document, error)
-	Search(query Query) (Iterator, error)
-	UpdateScore(linkID uuid.UUID, score float64) error
+	Index(ctx context.Context, doc *Document) error
+	FindByID(ctx context.Context, linkID uuid.UUID) (*Document, error)
+	Search(ctx context.Context, query Query) (Iterator, error)
+	UpdateScore(ctx context.Context, linkID uuid.UUID, score float64) error
+
+	// IndexMany behaves like calling Index for each document but submits
+	// all documents to the underlying store in a single bulk request.
+	// Failures to process individual documents are reported via a
+	// *BulkError; the remaining documents are still indexed.
+	IndexMany(ctx context.Context, docs []*Document) error
+
+	// UpdateScores behaves like calling UpdateScore for each entry but
+	// submits all updates in a single bulk request. Failures to process
+	// individual entries are reported via a *BulkError.
+	UpdateScores(ctx context.Context, updates []ScoreUpdate) error
+
+	// Delete removes the document with the specified link ID from the
+	// index. It returns ErrNotFound if no such document exists.
+	Delete(ctx context.Context, linkID uuid.UUID) error
+
+	// Expire removes all documents that have not been indexed since the
+	// specified time, including documents that were never indexed but
+	// only had their score updated. It returns the number of removed
+	// documents.
+	Expire(ctx context.Context, indexedBefore time.Time) (uint64, error)
+}
+
+// DuplicateFinder is implemented by indexers that can look up the
+// near-duplicates of the documents that they store.
+type DuplicateFinder interface {
+	// FindDuplicates returns the documents whose content is a
+	// near-duplicate of the content of the document with the specified
+	// link ID, i.e. their fingerprints differ by at most
+	// MaxDuplicateDistance bits. The document itself is not included and
+	// the results are ordered by descending PageRank. It returns
+	// ErrNotFound if no such document exists.
+	FindDuplicates(ctx context.Context, linkID uuid.UUID) ([]*Document, error)
+}
+
+// Scanner is implemented by indexers that can iterate over all the documents
+// that they store.
+type Scanner interface {
+	// Scan returns an iterator over all documents in the index, including
+	// documents that only had their score updated, ordered by link ID.
+	Scan(ctx context.Context) (DocumentIterator, error)
+}
+
+// Restorer is implemented by indexers that can store documents exactly as
+// they were obtained from a Scanner.
+type Restorer interface {
+	// Restore stores the provided documents exactly as specified,
+	// including their PageRank and IndexedAt values, replacing any
+	// existing documents with the same link IDs. It is intended for
+	// loading documents that were obtained via Scan. Failures to process
+	// individual documents are reported via a *BulkError.
+	Restore(ctx context.Context, docs []*Document) error
+}
+
+// Suggester is implemented by indexers that can suggest spelling corrections
+// for query expressions.
+type Suggester interface {
+	// Suggest returns a spelling correction for a query expression that is
+	// built from the terms of the indexed Title and Content fields. Each
+	// word of expression that does not occur in the index is replaced by
+	// the most similar indexed term, preferring terms that occur in more
+	// documents. Implementations may also prefer terms that occur next to
+	// the neighbouring words of expression in the indexed text. It
+	// returns an empty string if no word can be corrected.
+	Suggest(ctx context.Context, expression string) (string, error)
+}
+
+// Completer is implemented by indexers that can complete partially typed
+// queries.
+type Completer interface {
+	// Complete returns up to limit completions of a partially typed query
+	// that are built from the titles of the matching documents with the
+	// highest PageRank, as described by MakeCompletions. It returns no
+	// completions if prefix does not contain any words or none of its
+	// words has at least MinCompletionWordLength characters.
+	Complete(ctx context.Context, prefix string, limit int) ([]Completion, error)
+}
+
+// RelatedFinder is implemented by indexers that can look up the documents
+// that are similar to the documents that they store.
+type RelatedFinder interface {
+	// Related returns an iterator over up to n documents whose Title and
+	// Content are similar to those of the document with the specified
+	// link ID, ordered by descending similarity. The document itself is
+	// not included. If n is not positive, DefaultRelatedLimit documents
+	// are returned. It returns ErrNotFound if no such document exists.
+	Related(ctx context.Context, linkID uuid.UUID, n int) (Iterator, error)
 }
@@ -1,21 +1,48 @@
 package indextest
 
 import (
+	"context"
 	"fmt"
 	"github.com/google/uuid"
 	"golang.org/x/xerrors"
 	gc "gopkg.in/check.v1"
+	"io"
+	"sort"
+	"strings"
 	"test_project/Chapter06/textindexer/index"
 	"time"
 )
 
 type SuiteBase struct {
 	idx index.Indexer
+
+	// newAnalyzedIndexer creates an empty indexer that uses a custom text
+	// analysis configuration.
+	newAnalyzedIndexer func(index.AnalysisConfig) (index.Indexer, error)
+}
+
+// duplicateFinder is implemented by indexers that can look up the
+// near-duplicates of documents that are not stored in the index.
+type duplicateFinder interface {
+	FindDuplicatesOf(ctx context.Context, doc *index.Document) ([]*index.Document, error)
+}
+
+// relatedFinder is implemented by indexers that can look up the documents
+// that are related to documents that are not stored in the index.
+type relatedFinder interface {
+	RelatedTo(ctx context.Context, doc *index.Document, n int) (index.Iterator, error)
 }
 
 func (s *SuiteBase) SetIndexer(i index.Indexer) {
 	s.idx = i
 }
+
+// SetAnalyzedIndexerFactory sets the function for creating empty indexers
+// with a custom text analysis configuration. Tests that require such indexers
+// are skipped if no factory is set.
+func (s *SuiteBase) SetAnalyzedIndexerFactory(newIndexer func(index.AnalysisConfig) (index.Indexer, error)) {
+	s.newAnalyzedIndexer = newIndexer
+}
 func (s *SuiteBase) TestIndexDoesNotOverridePageRank(c *gc.C) {
 	// Insert new Document
 	doc := &index.Document{
@@ -25,12 +52,12 @@ func (s *SuiteBase) TestIndexDoesNotOverridePageRank(c *gc.C) {
 		Content:   "Lorem ipsum dolor",
 		IndexedAt: time.Now().Add(-12 * time.Hour).UTC(),
 	}
-	err := s.idx.Index(doc)
+	err := s.idx.Index(context.TODO(), doc)
 	c.Assert(err, gc.IsNil)
 
 	// Update its score
 	expScore := 0.5
-	err = s.idx.UpdateScore(doc.LinkID, expScore)
+	err = s.idx.UpdateScore(context.TODO(), doc.LinkID, expScore)
 	c.Assert(err, gc.IsNil)
 
 	// Update document
@@ -42,11 +69,11 @@ func (s *SuiteBase) TestIndexDoesNotOverridePageRank(c *gc.C) {
 		IndexedAt: time.Now().UTC(),
 	}
 
-	err = s.idx.Index(updatedDoc)
+	err = s.idx.Index(context.TODO(), updatedDoc)
 	c.Assert(err, gc.IsNil)
 
 	// Lookup document and verify that PageRank score has not been changed.
-	got, err := s.idx.FindByID(doc.LinkID)
+	got, err := s.idx.FindByID(context.TODO(), doc.LinkID)
 	c.Assert(err, gc.IsNil)
 	c.Assert(got.PageRank, gc.Equals, expScore)
 }
@@ -59,7 +86,7 @@ func (s *SuiteBase) TestIndex(c *gc.C) {
 		Content:   "Lorem ipsum dolor",
 		IndexedAt: time.Now().Add(-12 * time.Hour).UTC(),
 	}
-	err := s.idx.Index(doc)
+	err := s.idx.Index(context.TODO(), doc)
 	c.Assert(err, gc.IsNil, gc.Commentf("TestIndex fail error"))
 
 	updatedDoc := &index.Document{
@@ -69,14 +96,14 @@ func (s *SuiteBase) TestIndex(c *gc.C) {
 		Content:   "Ovidius poeta in terra pontica",
 		IndexedAt: time.Now().UTC(),
 	}
-	err = s.idx.Index(updatedDoc)
+	err = s.idx.Index(context.TODO(), updatedDoc)
 	c.Assert(err, gc.IsNil, gc.Commentf("Update fail error"))
 
 	incompleteDoc := &index.Document{
 		URL: "http://example.com",
 	}
 
-	err = s.idx.Index(incompleteDoc)
+	err = s.idx.Index(context.TODO(), incompleteDoc)
 	c.Assert(xerrors.Is(err, index.ErrMissingLinkID), gc.Equals, true)
 }
 
@@ -88,14 +115,14 @@ func (s SuiteBase) TestFindByID(c *gc.C) {
 		Content:   "Lorem ipsum dolor",
 		IndexedAt: time.Now().Add(-12 * time.Hour).UTC(),
 	}
-	err := s.idx.Index(doc)
+	err := s.idx.Index(context.TODO(), doc)
 	c.Assert(err, gc.IsNil, gc.Commentf("TestIndex fail error"))
 
-	found, e := s.idx.FindByID(doc.LinkID)
+	found, e := s.idx.FindByID(context.TODO(), doc.LinkID)
 	c.Assert(e, gc.IsNil, gc.Commentf("Error in TestFindByID"))
 	c.Assert(found, gc.DeepEquals, doc, gc.Commentf("Not original"))
 
-	_, err = s.idx.FindByID(uuid.New())
+	_, err = s.idx.FindByID(context.TODO(), uuid.New())
 	c.Assert(xerrors.Is(err, index.ErrNotFound), gc.Equals, true, gc.Commentf("sdweqwxzdas"))
 }
 func (s SuiteBase) TestPhaseSearch(c *gc.C) {
@@ -116,14 +143,14 @@ func (s SuiteBase) TestPhaseSearch(c *gc.C) {
 			expIDs = append(expIDs, id)
 		}
 
-		err := s.idx.Index(doc)
+		err := s.idx.Index(context.TODO(), doc)
 		c.Assert(err, gc.IsNil)
 
-		err = s.idx.UpdateScore(id, float64(numDocs-i))
+		err = s.idx.UpdateScore(context.TODO(), id, float64(numDocs-i))
 		c.Assert(err, gc.IsNil)
 	}
 
-	it, err := s.idx.Search(index.Query{
+	it, err := s.idx.Search(context.TODO(), index.Query{
 		Type:       index.QueryTypePhrase,
 		Expression: "lorem dolor ipsum",
 	})
@@ -148,14 +175,14 @@ func (s *SuiteBase) TestMatchSearch(c *gc.C) {
 			expIDs = append(expIDs, id)
 		}
 
-		err := s.idx.Index(doc)
+		err := s.idx.Index(context.TODO(), doc)
 		c.Assert(err, gc.IsNil)
 
-		err = s.idx.UpdateScore(id, float64(numDocs-i))
+		err = s.idx.UpdateScore(context.TODO(), id, float64(numDocs-i))
 		c.Assert(err, gc.IsNil)
 	}
 
-	it, err := s.idx.Search(index.Query{
+	it, err := s.idx.Search(context.TODO(), index.Query{
 		Type:       index.QueryTypeMatch,
 		Expression: "lorem ipsum",
 	})
@@ -177,14 +204,14 @@ func (s *SuiteBase) TestMatchSearchWithOffset(c *gc.C) {
 			Content: "Ovidius poeta in terra pontica",
 		}
 
-		err := s.idx.Index(doc)
+		err := s.idx.Index(context.TODO(), doc)
 		c.Assert(err, gc.IsNil)
 
-		err = s.idx.UpdateScore(id, float64(numDocs-i))
+		err = s.idx.UpdateScore(context.TODO(), id, float64(numDocs-i))
 		c.Assert(err, gc.IsNil)
 	}
 
-	it, err := s.idx.Search(index.Query{
+	it, err := s.idx.Search(context.TODO(), index.Query{
 		Type:       index.QueryTypeMatch,
 		Expression: "poeta",
 		Offset:     20,
@@ -193,7 +220,7 @@ func (s *SuiteBase) TestMatchSearchWithOffset(c *gc.C) {
 	c.Assert(iterateDocs(c, it), gc.DeepEquals, expIDs[20:])
 
 	// Search with offset beyon the total number of results
-	it, err = s.idx.Search(index.Query{
+	it, err = s.idx.Search(context.TODO(), index.Query{
 		Type:       index.QueryTypeMatch,
 		Expression: "poeta",
 		Offset:     200,
@@ -216,14 +243,14 @@ func (s *SuiteBase) TestUpdateScore(c *gc.C) {
 			Content: "Ovidius poeta in terra pontica",
 		}
 
-		err := s.idx.Index(doc)
+		err := s.idx.Index(context.TODO(), doc)
 		c.Assert(err, gc.IsNil)
 
-		err = s.idx.UpdateScore(id, float64(numDocs-i))
+		err = s.idx.UpdateScore(context.TODO(), id, float64(numDocs-i))
 		c.Assert(err, gc.IsNil)
 	}
 
-	it, err := s.idx.Search(index.Query{
+	it, err := s.idx.Search(context.TODO(), index.Query{
 		Type:       index.QueryTypeMatch,
 		Expression: "poeta",
 	})
@@ -233,11 +260,11 @@ func (s *SuiteBase) TestUpdateScore(c *gc.C) {
 	// Update the pagerank scores so that results are sorted in the
 	// reverse order.
 	for i := 0; i < numDocs; i++ {
-		err = s.idx.UpdateScore(expIDs[i], float64(i))
+		err = s.idx.UpdateScore(context.TODO(), expIDs[i], float64(i))
 		c.Assert(err, gc.IsNil, gc.Commentf(expIDs[i].String()))
 	}
 
-	it, err = s.idx.Search(index.Query{
+	it, err = s.idx.Search(context.TODO(), index.Query{
 		Type:       index.QueryTypeMatch,
 		Expression: "poeta",
 	})
@@ -246,10 +273,10 @@ func (s *SuiteBase) TestUpdateScore(c *gc.C) {
 }
 func (s *SuiteBase) TestUpdateScoreForUnknownDocument(c *gc.C) {
 	linkID := uuid.New()
-	err := s.idx.UpdateScore(linkID, 0.5)
+	err := s.idx.UpdateScore(context.TODO(), linkID, 0.5)
 	c.Assert(err, gc.IsNil)
 
-	doc, err := s.idx.FindByID(linkID)
+	doc, err := s.idx.FindByID(context.TODO(), linkID)
 	c.Assert(err, gc.IsNil)
 
 	c.Assert(doc.URL, gc.Equals, "")
@@ -259,6 +286,336 @@ func (s *SuiteBase) TestUpdateScoreForUnknownDocument(c *gc.C) {
 	c.Assert(doc.PageRank, gc.Equals, 0.5)
 }
 
+func (s *SuiteBase) TestSearchHighlights(c *gc.C) {
+	filler := strings.Repeat("lorem ipsum dolor sit amet ", 20)
+	titleMatchID, contentOnlyID := uuid.New(), uuid.New()
+	docs := []*index.Document{
+		{
+			LinkID:  titleMatchID,
+			Title:   "Ovidius biography",
+			Content: filler + "Ovidius poeta in terra pontica " + filler + "Ovidius again",
+		},
+		{
+			LinkID:  contentOnlyID,
+			Title:   "Metamorphoses",
+			Content: filler + "written by Ovidius " + filler,
+		},
+	}
+	c.Assert(s.idx.IndexMany(context.TODO(), docs), gc.IsNil)
+
+	it, err := s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "ovidius",
+		Highlight: &index.HighlightOptions{
+			FragmentSize: 60,
+			NumFragments: 2,
+			PreTag:       "[",
+			PostTag:      "]",
+		},
+	})
+	c.Assert(err, gc.IsNil)
+
+	var seen int
+	for it.Next() {
+		seen++
+		doc, highlights := it.Document(), it.Highlights()
+		c.Assert(highlights, gc.NotNil)
+		c.Assert(len(highlights.Content) >= 1 && len(highlights.Content) <= 2, gc.Equals, true, gc.Commentf("got %d content fragments", len(highlights.Content)))
+		for _, frag := range highlights.Content {
+			c.Assert(frag, gc.Matches, `.*\[Ovidius\].*`)
+			c.Assert(len(frag) < len(doc.Content), gc.Equals, true, gc.Commentf("expected a fragment; got full content"))
+		}
+
+		switch doc.LinkID {
+		case titleMatchID:
+			c.Assert(highlights.Title, gc.HasLen, 1)
+			c.Assert(highlights.Title[0], gc.Equals, "[Ovidius] biography")
+		case contentOnlyID:
+			c.Assert(highlights.Title, gc.HasLen, 0)
+		}
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+	c.Assert(seen, gc.Equals, 2)
+
+	// Highlights are not populated unless requested.
+	it, err = s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "ovidius",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.Next(), gc.Equals, true)
+	c.Assert(it.Highlights(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+}
+
+func (s *SuiteBase) TestIndexMany(c *gc.C) {
+	existingID := uuid.New()
+	err := s.idx.Index(context.TODO(), &index.Document{
+		LinkID:  existingID,
+		URL:     "http://example.com/existing",
+		Title:   "Illustrious examples",
+		Content: "Lorem ipsum dolor",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.idx.UpdateScore(context.TODO(), existingID, 0.5), gc.IsNil)
+
+	docs := []*index.Document{
+		{
+			LinkID:    existingID,
+			URL:       "http://example.com/existing",
+			Title:     "A more exciting title",
+			Content:   "Ovidius poeta in terra pontica",
+			IndexedAt: time.Now().UTC(),
+		},
+		{URL: "http://example.com/no-link-id"},
+	}
+	for i := 0; i < 20; i++ {
+		docs = append(docs, &index.Document{
+			LinkID:    uuid.New(),
+			URL:       fmt.Sprintf("http://example.com/%d", i),
+			Title:     "Ovidius",
+			Content:   "Ovidius poeta in terra pontica",
+			IndexedAt: time.Now().UTC(),
+		})
+	}
+
+	err = s.idx.IndexMany(context.TODO(), docs)
+	var bulkErr *index.BulkError
+	c.Assert(xerrors.As(err, &bulkErr), gc.Equals, true, gc.Commentf("expected a bulk error; got %v", err))
+	c.Assert(bulkErr.Items, gc.HasLen, 1)
+	c.Assert(bulkErr.Items[0].Index, gc.Equals, 1)
+	c.Assert(xerrors.Is(bulkErr.Items[0].Err, index.ErrMissingLinkID), gc.Equals, true)
+
+	// Bulk indexing must not override the PageRank of existing documents.
+	got, err := s.idx.FindByID(context.TODO(), existingID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.Title, gc.Equals, "A more exciting title")
+	c.Assert(got.PageRank, gc.Equals, 0.5)
+
+	for _, doc := range docs[2:] {
+		got, err = s.idx.FindByID(context.TODO(), doc.LinkID)
+		c.Assert(err, gc.IsNil)
+		c.Assert(got, gc.DeepEquals, doc)
+	}
+
+	it, err := s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "poeta",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(iterateDocs(c, it), gc.HasLen, len(docs)-1)
+
+	c.Assert(s.idx.IndexMany(context.TODO(), nil), gc.IsNil)
+}
+
+func (s *SuiteBase) TestUpdateScores(c *gc.C) {
+	var (
+		numDocs = 30
+		expIDs  []uuid.UUID
+		docs    []*index.Document
+	)
+	for i := 0; i < numDocs; i++ {
+		id := uuid.New()
+		expIDs = append(expIDs, id)
+		docs = append(docs, &index.Document{
+			LinkID:  id,
+			Title:   fmt.Sprintf("doc with ID %s", id.String()),
+			Content: "Ovidius poeta in terra pontica",
+		})
+	}
+	c.Assert(s.idx.IndexMany(context.TODO(), docs), gc.IsNil)
+
+	updates := make([]index.ScoreUpdate, numDocs)
+	for i, id := range expIDs {
+		updates[i] = index.ScoreUpdate{LinkID: id, Score: float64(numDocs - i)}
+	}
+	unknownID := uuid.New()
+	updates = append(updates, index.ScoreUpdate{LinkID: unknownID, Score: 0.5})
+	c.Assert(s.idx.UpdateScores(context.TODO(), updates), gc.IsNil)
+
+	it, err := s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "poeta",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(iterateDocs(c, it), gc.DeepEquals, expIDs)
+
+	// Scores for unknown documents create a placeholder entry.
+	doc, err := s.idx.FindByID(context.TODO(), unknownID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc.PageRank, gc.Equals, 0.5)
+	c.Assert(doc.IndexedAt.IsZero(), gc.Equals, true)
+
+	// Reverse the order.
+	for i, id := range expIDs {
+		updates[i] = index.ScoreUpdate{LinkID: id, Score: float64(i)}
+	}
+	c.Assert(s.idx.UpdateScores(context.TODO(), updates[:numDocs]), gc.IsNil)
+	it, err = s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "poeta",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(iterateDocs(c, it), gc.DeepEquals, reverse(expIDs))
+}
+
+func (s *SuiteBase) TestDelete(c *gc.C) {
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		id := uuid.New()
+		ids = append(ids, id)
+		err := s.idx.Index(context.TODO(), &index.Document{
+			LinkID:    id,
+			URL:       fmt.Sprintf("http://example.com/%d", i),
+			Title:     "Illustrious examples",
+			Content:   "Lorem ipsum dolor",
+			IndexedAt: time.Now().UTC(),
+		})
+		c.Assert(err, gc.IsNil)
+	}
+
+	err := s.idx.Delete(context.TODO(), ids[1])
+	c.Assert(err, gc.IsNil)
+
+	_, err = s.idx.FindByID(context.TODO(), ids[1])
+	c.Assert(xerrors.Is(err, index.ErrNotFound), gc.Equals, true)
+
+	it, err := s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "lorem",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(iterateDocs(c, it), gc.HasLen, 2)
+
+	err = s.idx.Delete(context.TODO(), ids[1])
+	c.Assert(xerrors.Is(err, index.ErrNotFound), gc.Equals, true)
+
+	// Re-indexing a deleted document should work as expected.
+	err = s.idx.Index(context.TODO(), &index.Document{
+		LinkID:    ids[1],
+		URL:       "http://example.com/1",
+		Title:     "Illustrious examples",
+		Content:   "Lorem ipsum dolor",
+		IndexedAt: time.Now().UTC(),
+	})
+	c.Assert(err, gc.IsNil)
+	_, err = s.idx.FindByID(context.TODO(), ids[1])
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *SuiteBase) TestExpire(c *gc.C) {
+	var (
+		numDocs    = 20
+		staleIDs   = make(map[uuid.UUID]bool)
+		freshIDs   []uuid.UUID
+		indexDocFn = func(id uuid.UUID) {
+			err := s.idx.Index(context.TODO(), &index.Document{
+				LinkID:    id,
+				URL:       fmt.Sprintf("http://example.com/%s", id),
+				Title:     "Illustrious examples",
+				Content:   "Lorem ipsum dolor",
+				IndexedAt: time.Now().UTC(),
+			})
+			c.Assert(err, gc.IsNil)
+		}
+	)
+	for i := 0; i < numDocs; i++ {
+		id := uuid.New()
+		indexDocFn(id)
+		if i%2 == 0 {
+			staleIDs[id] = true
+		} else {
+			freshIDs = append(freshIDs, id)
+		}
+	}
+
+	// Documents that only have a score are also considered stale.
+	scoreOnlyID := uuid.New()
+	c.Assert(s.idx.UpdateScore(context.TODO(), scoreOnlyID, 0.5), gc.IsNil)
+	staleIDs[scoreOnlyID] = true
+
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	for _, id := range freshIDs {
+		indexDocFn(id)
+	}
+
+	expired, err := s.idx.Expire(context.TODO(), cutoff)
+	c.Assert(err, gc.IsNil)
+	c.Assert(expired, gc.Equals, uint64(len(staleIDs)))
+
+	for id := range staleIDs {
+		_, err = s.idx.FindByID(context.TODO(), id)
+		c.Assert(xerrors.Is(err, index.ErrNotFound), gc.Equals, true, gc.Commentf("expected document %s to be expired", id))
+	}
+	for _, id := range freshIDs {
+		_, err = s.idx.FindByID(context.TODO(), id)
+		c.Assert(err, gc.IsNil, gc.Commentf("expected document %s to be retained", id))
+	}
+
+	it, err := s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "lorem",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(iterateDocs(c, it), gc.HasLen, len(freshIDs))
+
+	// Nothing left to expire.
+	expired, err = s.idx.Expire(context.TODO(), cutoff)
+	c.Assert(err, gc.IsNil)
+	c.Assert(expired, gc.Equals, uint64(0))
+}
+
+func (s *SuiteBase) TestContextCancellation(c *gc.C) {
+	numDocs := 50
+	for i := 0; i < numDocs; i++ {
+		id := uuid.New()
+		err := s.idx.Index(context.TODO(), &index.Document{
+			LinkID:  id,
+			Title:   fmt.Sprintf("doc with ID %s", id.String()),
+			Content: "Ovidius poeta in terra pontica",
+		})
+		c.Assert(err, gc.IsNil)
+	}
+
+	// Cancelling the context must abort any pending page fetches.
+	ctx, cancelFn := context.WithCancel(context.Background())
+	it, err := s.idx.Search(ctx, index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "poeta",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.Next(), gc.Equals, true)
+	cancelFn()
+
+	var seen int
+	for seen = 1; it.Next(); seen++ {
+	}
+	c.Assert(seen < numDocs, gc.Equals, true, gc.Commentf("iterator ignored context cancellation"))
+	c.Assert(xerrors.Is(it.Error(), context.Canceled), gc.Equals, true, gc.Commentf("unexpected iterator error: %v", it.Error()))
+	c.Assert(it.Close(), gc.IsNil)
+
+	linkID := uuid.New()
+	err = s.idx.Index(ctx, &index.Document{LinkID: linkID})
+	c.Assert(xerrors.Is(err, context.Canceled), gc.Equals, true, gc.Commentf("Index: %v", err))
+	_, err = s.idx.FindByID(ctx, linkID)
+	c.Assert(xerrors.Is(err, context.Canceled), gc.Equals, true, gc.Commentf("FindByID: %v", err))
+	_, err = s.idx.Search(ctx, index.Query{Type: index.QueryTypeMatch, Expression: "poeta"})
+	c.Assert(xerrors.Is(err, context.Canceled), gc.Equals, true, gc.Commentf("Search: %v", err))
+	err = s.idx.UpdateScore(ctx, linkID, 0.5)
+	c.Assert(xerrors.Is(err, context.Canceled), gc.Equals, true, gc.Commentf("UpdateScore: %v", err))
+	err = s.idx.Delete(ctx, linkID)
+	c.Assert(xerrors.Is(err, context.Canceled), gc.Equals, true, gc.Commentf("Delete: %v", err))
+	_, err = s.idx.Expire(ctx, time.Now())
+	c.Assert(xerrors.Is(err, context.Canceled), gc.Equals, true, gc.Commentf("Expire: %v", err))
+	if completer, ok := s.idx.(index.Completer); ok {
+		_, err = completer.Complete(ctx, "poeta", 0)
+		c.Assert(xerrors.Is(err, context.Canceled), gc.Equals, true, gc.Commentf("Complete: %v", err))
+	}
+}
+
 func reverse(in []uuid.UUID) []uuid.UUID {
 	for left, right := 0, len(in)-1; left < right; left, right = left+1, right-1 {
 		in[left], in[right] = in[right], in[left]
@@ -276,3 +633,948 @@ func iterateDocs(c *gc.C, it index.Iterator) []uuid.UUID {
 	c.Assert(it.Close(), gc.IsNil)
 	return seen
 }
+
+func (s *SuiteBase) TestAdvancedSearch(c *gc.C) {
+	docs := []*index.Document{
+		{URL: "http://www.example.com/a", Title: "Go concurrency patterns", Content: "channels and goroutines"},
+		{URL: "http://example.com/b", Title: "Rust ownership", Content: "borrow checker and lifetimes"},
+		{URL: "http://blog.other.org/c", Title: "Go generics", Content: "type parameters in go"},
+		{URL: "http://other.org/d", Title: "Cooking pasta", Content: "boil water then add the pasta"},
+		{URL: "http://notexample.com/e", Title: "Concurrency in Rust", Content: "fearless concurrency with channels"},
+	}
+	ids := make([]uuid.UUID, len(docs))
+	for i, doc := range docs {
+		ids[i] = uuid.New()
+		doc.LinkID = ids[i]
+		c.Assert(s.idx.Index(context.TODO(), doc), gc.IsNil)
+		// Use widely spaced scores so that results are always returned
+		// in document order.
+		c.Assert(s.idx.UpdateScore(context.TODO(), ids[i], float64(100*(len(docs)-i))), gc.IsNil)
+	}
+
+	specs := []struct {
+		expr   string
+		expIdx []int
+	}{
+		{`channels`, []int{0, 4}},
+		{`"borrow checker"`, []int{1}},
+		{`title:go`, []int{0, 2}},
+		{`title:"go generics"`, []int{2}},
+		{`go -generics`, []int{0}},
+		{`concurrency AND channels`, []int{0, 4}},
+		{`rust OR pasta`, []int{1, 3, 4}},
+		{`(rust OR pasta) NOT cooking`, []int{1, 4}},
+		{`-rust`, []int{0, 2, 3}},
+		{`site:example.com`, []int{0, 1}},
+		{`site:other.org go`, []int{2}},
+		{`site:example.com OR site:notexample.com channels`, []int{0, 1, 4}},
+	}
+	for _, spec := range specs {
+		it, err := s.idx.Search(context.TODO(), index.Query{
+			Type:       index.QueryTypeAdvanced,
+			Expression: spec.expr,
+		})
+		c.Assert(err, gc.IsNil, gc.Commentf("query: %s", spec.expr))
+
+		var expIDs []uuid.UUID
+		for _, idx := range spec.expIdx {
+			expIDs = append(expIDs, ids[idx])
+		}
+		c.Assert(iterateDocs(c, it), gc.DeepEquals, expIDs, gc.Commentf("query: %s", spec.expr))
+	}
+}
+
+func (s *SuiteBase) TestAdvancedSearchWithInvalidQuery(c *gc.C) {
+	_, err := s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeAdvanced,
+		Expression: `go AND (rust OR`,
+	})
+	c.Assert(xerrors.Is(err, index.ErrInvalidQuery), gc.Equals, true, gc.Commentf("%v", err))
+
+	var syntaxErr *index.QuerySyntaxError
+	c.Assert(xerrors.As(err, &syntaxErr), gc.Equals, true)
+	c.Assert(syntaxErr.Pos, gc.Equals, 15)
+}
+
+func (s *SuiteBase) TestSearchFilters(c *gc.C) {
+	urls := []string{
+		"http://example.com/blog/1",
+		"http://www.example.com/about",
+		"http://notexample.com/blog/2",
+		"https://example.com/blog/3",
+		"http://other.org/blog/4",
+		"http://example.com/shop",
+	}
+	ids := make([]uuid.UUID, len(urls))
+	indexDocFn := func(i int) {
+		ids[i] = uuid.New()
+		err := s.idx.Index(context.TODO(), &index.Document{
+			LinkID:    ids[i],
+			URL:       urls[i],
+			Title:     fmt.Sprintf("Document %d", i),
+			Content:   "Lorem ipsum dolor",
+			IndexedAt: time.Now().UTC(),
+		})
+		c.Assert(err, gc.IsNil)
+		c.Assert(s.idx.UpdateScore(context.TODO(), ids[i], float64(len(urls)-i)), gc.IsNil)
+	}
+
+	// Index the first half of the documents before the cutoff time and
+	// the remaining documents after it.
+	for i := 0; i < len(urls)/2; i++ {
+		indexDocFn(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	for i := len(urls) / 2; i < len(urls); i++ {
+		indexDocFn(i)
+	}
+
+	specs := []struct {
+		descr   string
+		filters index.Filters
+		expIdx  []int
+	}{
+		{"no filters", index.Filters{}, []int{0, 1, 2, 3, 4, 5}},
+		{"host", index.Filters{Host: "example.com"}, []int{0, 1, 3, 5}},
+		{"subdomain host", index.Filters{Host: "WWW.example.com"}, []int{1}},
+		{"URL prefix", index.Filters{URLPrefix: "http://example.com/blog/"}, []int{0}},
+		{"indexed since", index.Filters{IndexedSince: cutoff}, []int{3, 4, 5}},
+		{"indexed before", index.Filters{IndexedBefore: cutoff}, []int{0, 1, 2}},
+		{"min PageRank", index.Filters{MinPageRank: 4}, []int{0, 1, 2}},
+		{
+			"combined",
+			index.Filters{Host: "example.com", IndexedSince: cutoff, MinPageRank: 1},
+			[]int{3, 5},
+		},
+		{"no matches", index.Filters{Host: "example.com", IndexedSince: cutoff, IndexedBefore: cutoff}, nil},
+		{"link IDs", index.Filters{LinkIDs: []uuid.UUID{ids[4], ids[1], uuid.New()}}, []int{1, 4}},
+		{"link IDs and host", index.Filters{LinkIDs: []uuid.UUID{ids[4], ids[1]}, Host: "example.com"}, []int{1}},
+	}
+	for _, spec := range specs {
+		var expIDs []uuid.UUID
+		for _, idx := range spec.expIdx {
+			expIDs = append(expIDs, ids[idx])
+		}
+
+		// An empty expression matches all documents that satisfy the
+		// filters.
+		for _, expr := range []string{"lorem", ""} {
+			it, err := s.idx.Search(context.TODO(), index.Query{
+				Type:       index.QueryTypeMatch,
+				Expression: expr,
+				Filters:    spec.filters,
+			})
+			c.Assert(err, gc.IsNil, gc.Commentf("%s, expression %q", spec.descr, expr))
+			c.Assert(iterateDocs(c, it), gc.DeepEquals, expIDs, gc.Commentf("%s, expression %q", spec.descr, expr))
+		}
+	}
+}
+
+func (s *SuiteBase) TestSearchFacets(c *gc.C) {
+	// Index more documents than the iterator page size to ensure that
+	// facets are calculated over the entire result set.
+	hosts := []string{"a.com", "a.com", "b.com", "a.com", "c.com", "b.com"}
+	numDocs := 2 * len(hosts)
+	for i := 0; i < numDocs; i++ {
+		id := uuid.New()
+		err := s.idx.Index(context.TODO(), &index.Document{
+			LinkID:    id,
+			URL:       fmt.Sprintf("http://%s/%d", hosts[i%len(hosts)], i),
+			Title:     fmt.Sprintf("Document %d", i),
+			Content:   "Lorem ipsum dolor",
+			IndexedAt: time.Now().UTC(),
+		})
+		c.Assert(err, gc.IsNil)
+		c.Assert(s.idx.UpdateScore(context.TODO(), id, float64(i)/float64(numDocs)), gc.IsNil)
+	}
+
+	facetOpts := &index.FacetOptions{
+		HostSize:     2,
+		DateInterval: time.Hour,
+		DateBuckets:  3,
+		PageRankRanges: []index.PageRankRange{
+			{Min: 0, Max: 0.25},
+			{Min: 0.25, Max: 0.5},
+			{Min: 0.5},
+		},
+	}
+	it, err := s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "lorem",
+		Facets:     facetOpts,
+	})
+	c.Assert(err, gc.IsNil)
+
+	facets := it.Facets()
+	c.Assert(facets, gc.NotNil)
+	c.Assert(facets.Hosts, gc.DeepEquals, []index.HostCount{
+		{Host: "a.com", Count: 6},
+		{Host: "b.com", Count: 4},
+	})
+	c.Assert(facets.PageRank, gc.DeepEquals, []index.PageRankCount{
+		{PageRankRange: facetOpts.PageRankRanges[0], Count: 3},
+		{PageRankRange: facetOpts.PageRankRanges[1], Count: 3},
+		{PageRankRange: facetOpts.PageRankRanges[2], Count: 6},
+	})
+
+	// All documents were indexed just now and should fall into the most
+	// recent buckets.
+	c.Assert(facets.IndexedAt, gc.HasLen, 3)
+	var dateTotal uint64
+	for i, bucket := range facets.IndexedAt {
+		c.Assert(bucket.End.Sub(bucket.Start), gc.Equals, time.Hour)
+		if i > 0 {
+			c.Assert(bucket.Start.Equal(facets.IndexedAt[i-1].End), gc.Equals, true)
+		}
+		dateTotal += bucket.Count
+	}
+	c.Assert(dateTotal, gc.Equals, uint64(numDocs))
+	c.Assert(facets.IndexedAt[2].End.After(time.Now()), gc.Equals, true)
+
+	// Facets must remain available while iterating the result pages.
+	c.Assert(iterateDocs(c, it), gc.HasLen, numDocs)
+	c.Assert(it.Facets(), gc.DeepEquals, facets)
+
+	// Facets must honor the query filters.
+	it, err = s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "lorem",
+		Filters:    index.Filters{MinPageRank: 0.5},
+		Facets:     &index.FacetOptions{},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.Facets().Hosts, gc.DeepEquals, []index.HostCount{
+		{Host: "a.com", Count: 3},
+		{Host: "b.com", Count: 2},
+		{Host: "c.com", Count: 1},
+	})
+	c.Assert(it.Close(), gc.IsNil)
+
+	// Documents whose score was never updated have a PageRank of zero.
+	c.Assert(s.idx.Index(context.TODO(), &index.Document{
+		LinkID:  uuid.New(),
+		URL:     "http://d.com/unscored",
+		Content: "Unscored sit amet",
+	}), gc.IsNil)
+	it, err = s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "unscored",
+		Facets:     facetOpts,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.Facets().PageRank, gc.DeepEquals, []index.PageRankCount{
+		{PageRankRange: facetOpts.PageRankRanges[0], Count: 1},
+		{PageRankRange: facetOpts.PageRankRanges[1], Count: 0},
+		{PageRankRange: facetOpts.PageRankRanges[2], Count: 0},
+	})
+	c.Assert(it.Close(), gc.IsNil)
+
+	// Queries that do not request facets do not return any.
+	it, err = s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "lorem",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.Facets(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+}
+
+func (s *SuiteBase) TestRanking(c *gc.C) {
+	indexDocFn := func(title, content string, pageRank float64) uuid.UUID {
+		id := uuid.New()
+		err := s.idx.Index(context.TODO(), &index.Document{
+			LinkID:    id,
+			URL:       fmt.Sprintf("http://example.com/%s", id),
+			Title:     title,
+			Content:   content,
+			IndexedAt: time.Now().UTC(),
+		})
+		c.Assert(err, gc.IsNil)
+		c.Assert(s.idx.UpdateScore(context.TODO(), id, pageRank), gc.IsNil)
+		return id
+	}
+	searchFn := func(expr string, ranking *index.Ranking) []uuid.UUID {
+		it, err := s.idx.Search(context.TODO(), index.Query{
+			Type:       index.QueryTypeMatch,
+			Expression: expr,
+			Ranking:    ranking,
+		})
+		c.Assert(err, gc.IsNil)
+		return iterateDocs(c, it)
+	}
+
+	// Text relevance vs PageRank.
+	relevantID := indexDocFn("Gophers", "gopher gopher gopher gopher", 0.01)
+	popularID := indexDocFn("Animals", "the gopher is one of many animals living in burrows", 0.02)
+	c.Assert(searchFn("gopher", &index.Ranking{TextWeight: 1}), gc.DeepEquals, []uuid.UUID{relevantID, popularID})
+	c.Assert(searchFn("gopher", &index.Ranking{PageRankWeight: 1}), gc.DeepEquals, []uuid.UUID{popularID, relevantID})
+	c.Assert(searchFn("gopher", &index.Ranking{TextWeight: 0.001, PageRankWeight: 1000}), gc.DeepEquals, []uuid.UUID{popularID, relevantID})
+
+	// Title boost.
+	titleID := indexDocFn("badger", "lorem ipsum", 0)
+	contentID := indexDocFn("lorem ipsum", "badger", 0)
+	c.Assert(searchFn("badger", &index.Ranking{TextWeight: 1, TitleBoost: 10}), gc.DeepEquals, []uuid.UUID{titleID, contentID})
+	c.Assert(searchFn("badger", &index.Ranking{TextWeight: 1, TitleBoost: 0.1}), gc.DeepEquals, []uuid.UUID{contentID, titleID})
+
+	// Freshness decay.
+	staleID := indexDocFn("Weasels", "weasel", 0.5)
+	time.Sleep(200 * time.Millisecond)
+	freshID := indexDocFn("Weasels", "weasel", 0.1)
+	c.Assert(searchFn("weasel", &index.Ranking{PageRankWeight: 1}), gc.DeepEquals, []uuid.UUID{staleID, freshID})
+	c.Assert(searchFn("weasel", &index.Ranking{
+		PageRankWeight:    1,
+		FreshnessWeight:   10,
+		FreshnessHalfLife: 50 * time.Millisecond,
+	}), gc.DeepEquals, []uuid.UUID{freshID, staleID})
+}
+
+func (s *SuiteBase) TestCursorPagination(c *gc.C) {
+	numDocs := 25
+	for i := 0; i < numDocs; i++ {
+		id := uuid.New()
+		err := s.idx.Index(context.TODO(), &index.Document{
+			LinkID:  id,
+			URL:     fmt.Sprintf("http://example.com/%d", i),
+			Title:   fmt.Sprintf("Document %d", i),
+			Content: "Lorem ipsum dolor",
+		})
+		c.Assert(err, gc.IsNil)
+		// Use a small number of distinct scores so that the iterators
+		// need to rely on the link ID for breaking ties.
+		c.Assert(s.idx.UpdateScore(context.TODO(), id, float64(i%3)), gc.IsNil)
+	}
+
+	query := index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "lorem",
+		PageSize:   100,
+	}
+	it, err := s.idx.Search(context.TODO(), query)
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.TotalCount(), gc.Equals, uint64(numDocs))
+	expIDs := iterateDocs(c, it)
+	c.Assert(expIDs, gc.HasLen, numDocs)
+
+	// Iterating with a small page size must yield the same results in the
+	// same order.
+	query.PageSize = 4
+	it, err = s.idx.Search(context.TODO(), query)
+	c.Assert(err, gc.IsNil)
+	var (
+		gotIDs  []uuid.UUID
+		cursors []string
+	)
+	for it.Next() {
+		gotIDs = append(gotIDs, it.Document().LinkID)
+		cursors = append(cursors, it.Cursor())
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.TotalCount(), gc.Equals, uint64(numDocs))
+	c.Assert(it.Close(), gc.IsNil)
+	c.Assert(gotIDs, gc.DeepEquals, expIDs)
+
+	// Resuming from a cursor returns the documents after the one that
+	// the cursor was obtained for.
+	for _, pos := range []int{0, 3, 10, numDocs - 1} {
+		query.Cursor = cursors[pos]
+		it, err = s.idx.Search(context.TODO(), query)
+		c.Assert(err, gc.IsNil)
+		c.Assert(iterateDocs(c, it), gc.DeepEquals, nilIfEmpty(expIDs[pos+1:]), gc.Commentf("cursor position %d", pos))
+	}
+
+	// Offsets are still supported for the first page.
+	query.Cursor = ""
+	query.Offset = 5
+	query.PageSize = 3
+	it, err = s.idx.Search(context.TODO(), query)
+	c.Assert(err, gc.IsNil)
+	c.Assert(iterateDocs(c, it), gc.DeepEquals, expIDs[5:])
+
+	query.Cursor = "not-a-valid-cursor"
+	_, err = s.idx.Search(context.TODO(), query)
+	c.Assert(xerrors.Is(err, index.ErrInvalidCursor), gc.Equals, true, gc.Commentf("%v", err))
+}
+
+func nilIfEmpty(ids []uuid.UUID) []uuid.UUID {
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids
+}
+
+func (s *SuiteBase) TestFindDuplicates(c *gc.C) {
+	finder, ok := s.idx.(index.DuplicateFinder)
+	if !ok {
+		c.Skip("indexer does not implement index.DuplicateFinder")
+	}
+
+	content := `The gopher is a small burrowing rodent that lives in North America.
+Gophers spend most of their lives underground, digging extensive tunnel systems
+with their strong claws. They feed on roots, tubers and other plant material
+they encounter while digging, and they rarely venture far from their burrows.`
+	var (
+		original = &index.Document{LinkID: uuid.New(), URL: "http://example.com/fox", Content: content}
+		mirror   = &index.Document{LinkID: uuid.New(), URL: "http://mirror.example.org/fox", Content: content}
+		variant  = &index.Document{LinkID: uuid.New(), URL: "http://example.com/fox?ref=feed", Content: strings.Replace(content, "extensive", "large", 1)}
+		other    = &index.Document{LinkID: uuid.New(), URL: "http://example.com/other", Content: "Ovidius poeta in terra pontica scribit epistulas ad amicos suos qui Romae manent"}
+		empty    = &index.Document{LinkID: uuid.New(), URL: "http://example.com/empty"}
+	)
+	err := s.idx.IndexMany(context.TODO(), []*index.Document{original, mirror, variant, other, empty})
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.idx.UpdateScore(context.TODO(), mirror.LinkID, 0.9), gc.IsNil)
+	c.Assert(s.idx.UpdateScore(context.TODO(), variant.LinkID, 0.1), gc.IsNil)
+
+	found, err := s.idx.FindByID(context.TODO(), original.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(found.Fingerprint, gc.Not(gc.Equals), uint64(0))
+	c.Assert(found.Fingerprint, gc.Equals, index.Fingerprint(content))
+
+	// Duplicates are ordered by descending PageRank and exclude the
+	// document itself.
+	dups, err := finder.FindDuplicates(context.TODO(), original.LinkID)
+	c.Assert(err, gc.IsNil)
+	var dupIDs []uuid.UUID
+	for _, dup := range dups {
+		dupIDs = append(dupIDs, dup.LinkID)
+	}
+	c.Assert(dupIDs, gc.DeepEquals, []uuid.UUID{mirror.LinkID, variant.LinkID})
+
+	// Indexers that can look up the duplicates of documents that are not
+	// stored in the index fingerprint them on the fly.
+	if ofFinder, ok := s.idx.(duplicateFinder); ok {
+		dups, err = ofFinder.FindDuplicatesOf(context.TODO(), &index.Document{LinkID: uuid.New(), Content: content})
+		c.Assert(err, gc.IsNil)
+		dupIDs = dupIDs[:0]
+		for _, dup := range dups {
+			dupIDs = append(dupIDs, dup.LinkID)
+		}
+		c.Assert(dupIDs, gc.DeepEquals, []uuid.UUID{mirror.LinkID, variant.LinkID, original.LinkID})
+	}
+
+	dups, err = finder.FindDuplicates(context.TODO(), other.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dups, gc.HasLen, 0)
+
+	// Documents without content have no duplicates.
+	dups, err = finder.FindDuplicates(context.TODO(), empty.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dups, gc.HasLen, 0)
+
+	_, err = finder.FindDuplicates(context.TODO(), uuid.New())
+	c.Assert(xerrors.Is(err, index.ErrNotFound), gc.Equals, true, gc.Commentf("%v", err))
+}
+
+func (s *SuiteBase) TestCollapseByHost(c *gc.C) {
+	// Documents are listed by descending PageRank; a.com has 4 documents,
+	// b.com has 2 and c.com has 1.
+	urls := []string{
+		"http://a.com/1", "http://b.com/1", "http://a.com/2", "http://a.com/3",
+		"http://c.com/1", "http://b.com/2", "http://a.com/4",
+	}
+	ids := make([]uuid.UUID, len(urls))
+	for i, url := range urls {
+		ids[i] = uuid.New()
+		doc := &index.Document{
+			LinkID:  ids[i],
+			URL:     url,
+			Title:   "Gophers",
+			Content: "Gophers dig tunnels",
+		}
+		c.Assert(s.idx.Index(context.TODO(), doc), gc.IsNil)
+		c.Assert(s.idx.UpdateScore(context.TODO(), ids[i], float64(len(urls)-i)), gc.IsNil)
+	}
+
+	type result struct {
+		id        uuid.UUID
+		collapsed uint64
+	}
+	iterate := func(it index.Iterator) (results []result, cursors []string) {
+		for it.Next() {
+			results = append(results, result{id: it.Document().LinkID, collapsed: it.Collapsed()})
+			cursors = append(cursors, it.Cursor())
+		}
+		c.Assert(it.Error(), gc.IsNil)
+		c.Assert(it.Close(), gc.IsNil)
+		return results, cursors
+	}
+
+	// By default only the best document of each host is returned. A page
+	// size of 1 makes the iterator fetch each group with a new request.
+	query := index.Query{Type: index.QueryTypeMatch, Expression: "gophers", PageSize: 1, Collapse: &index.CollapseOptions{}}
+	it, err := s.idx.Search(context.TODO(), query)
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.TotalCount(), gc.Equals, uint64(3))
+	got, _ := iterate(it)
+	c.Assert(got, gc.DeepEquals, []result{{ids[0], 3}, {ids[1], 1}, {ids[4], 0}})
+
+	// Groups are ordered by their best document and their documents are
+	// returned consecutively.
+	query.Collapse.MaxPerHost = 2
+	it, err = s.idx.Search(context.TODO(), query)
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.TotalCount(), gc.Equals, uint64(3))
+	got, cursors := iterate(it)
+	exp := []result{{ids[0], 2}, {ids[2], 2}, {ids[1], 0}, {ids[5], 0}, {ids[4], 0}}
+	c.Assert(got, gc.DeepEquals, exp)
+
+	// Resuming from each cursor returns the remaining results.
+	for pos, cursor := range cursors {
+		query.Cursor = cursor
+		it, err = s.idx.Search(context.TODO(), query)
+		c.Assert(err, gc.IsNil)
+		got, _ = iterate(it)
+		var expRest []result
+		if pos+1 < len(exp) {
+			expRest = exp[pos+1:]
+		}
+		c.Assert(got, gc.DeepEquals, expRest, gc.Commentf("cursor position %d", pos))
+	}
+
+	// Cursors remain usable when the first document of their group has
+	// been deleted. As the c.com group now precedes the b.com group, the
+	// cursor, which points after the first document of the second group,
+	// continues with the b.com group.
+	c.Assert(s.idx.Delete(context.TODO(), ids[1]), gc.IsNil)
+	query.Cursor = cursors[2]
+	it, err = s.idx.Search(context.TODO(), query)
+	c.Assert(err, gc.IsNil)
+	got, _ = iterate(it)
+	c.Assert(got, gc.DeepEquals, []result{{ids[5], 0}})
+	c.Assert(s.idx.Index(context.TODO(), &index.Document{LinkID: ids[1], URL: urls[1], Title: "Gophers", Content: "Gophers dig tunnels"}), gc.IsNil)
+	c.Assert(s.idx.UpdateScore(context.TODO(), ids[1], float64(len(urls)-1)), gc.IsNil)
+
+	// Offsets skip entire groups.
+	query.Cursor = ""
+	query.Offset = 1
+	it, err = s.idx.Search(context.TODO(), query)
+	c.Assert(err, gc.IsNil)
+	got, _ = iterate(it)
+	c.Assert(got, gc.DeepEquals, exp[2:])
+
+	// Cursors of non-collapsing searches cannot be used for resuming a
+	// collapsing search.
+	query.Offset = 0
+	query.Cursor = index.Cursor{Score: 1, LinkID: ids[0]}.Encode()
+	_, err = s.idx.Search(context.TODO(), query)
+	c.Assert(xerrors.Is(err, index.ErrInvalidCursor), gc.Equals, true, gc.Commentf("%v", err))
+}
+
+func (s *SuiteBase) TestScanAndRestore(c *gc.C) {
+	scanner, canScan := s.idx.(index.Scanner)
+	restorer, canRestore := s.idx.(index.Restorer)
+	if !canScan || !canRestore {
+		c.Skip("indexer does not implement index.Scanner and index.Restorer")
+	}
+
+	var expDocs []*index.Document
+	for i := 0; i < 5; i++ {
+		doc := &index.Document{
+			LinkID:    uuid.New(),
+			URL:       fmt.Sprintf("http://example.com/%d", i),
+			Title:     fmt.Sprintf("Page %d", i),
+			Content:   fmt.Sprintf("The content of page %d", i),
+			IndexedAt: time.Now().Add(-time.Duration(i) * time.Hour).UTC(),
+		}
+		c.Assert(s.idx.Index(context.TODO(), doc), gc.IsNil)
+		c.Assert(s.idx.UpdateScore(context.TODO(), doc.LinkID, float64(i)), gc.IsNil)
+		doc.PageRank = float64(i)
+		expDocs = append(expDocs, doc)
+	}
+	// Documents that only had their score updated are also scanned.
+	scoreOnly := &index.Document{LinkID: uuid.New(), PageRank: 0.5}
+	c.Assert(s.idx.UpdateScore(context.TODO(), scoreOnly.LinkID, scoreOnly.PageRank), gc.IsNil)
+	scoreOnly, err := s.idx.FindByID(context.TODO(), scoreOnly.LinkID)
+	c.Assert(err, gc.IsNil)
+	expDocs = append(expDocs, scoreOnly)
+	sort.Slice(expDocs, func(l, r int) bool { return expDocs[l].LinkID.String() < expDocs[r].LinkID.String() })
+
+	scan := func() []*index.Document {
+		it, err := scanner.Scan(context.TODO())
+		c.Assert(err, gc.IsNil)
+		var docs []*index.Document
+		for it.Next() {
+			docs = append(docs, it.Document())
+		}
+		c.Assert(it.Error(), gc.IsNil)
+		c.Assert(it.Close(), gc.IsNil)
+		return docs
+	}
+	c.Assert(scan(), gc.DeepEquals, expDocs)
+
+	// Restoring replaces documents as-is, including their PageRank and
+	// IndexedAt values, unlike Index.
+	restored := &index.Document{
+		LinkID:    expDocs[0].LinkID,
+		URL:       "http://example.com/restored",
+		Title:     "Restored",
+		Content:   "Restored content",
+		IndexedAt: time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+		PageRank:  0.75,
+	}
+	deleted := expDocs[1]
+	c.Assert(s.idx.Delete(context.TODO(), deleted.LinkID), gc.IsNil)
+	err = restorer.Restore(context.TODO(), []*index.Document{restored, {URL: "http://example.com/no-id"}, deleted})
+	var bulkErr *index.BulkError
+	c.Assert(xerrors.As(err, &bulkErr), gc.Equals, true, gc.Commentf("%v", err))
+	c.Assert(bulkErr.Items, gc.HasLen, 1)
+	c.Assert(bulkErr.Items[0].Index, gc.Equals, 1)
+	c.Assert(xerrors.Is(bulkErr.Items[0].Err, index.ErrMissingLinkID), gc.Equals, true)
+
+	exp := *restored
+	exp.Fingerprint = index.Fingerprint(exp.Content)
+	got, err := s.idx.FindByID(context.TODO(), restored.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, gc.DeepEquals, &exp)
+
+	expDocs[0] = &exp
+	c.Assert(scan(), gc.DeepEquals, expDocs)
+}
+
+func (s *SuiteBase) TestTextAnalysis(c *gc.C) {
+	if s.newAnalyzedIndexer == nil {
+		c.Skip("indexer does not support custom text analysis")
+	}
+	idx, err := s.newAnalyzedIndexer(index.AnalysisConfig{
+		Language:        "en",
+		Stemming:        true,
+		RemoveStopWords: true,
+		StopWords:       []string{"the", "Best"},
+		Synonyms:        [][]string{{"car", "automobile"}},
+	})
+	c.Assert(err, gc.IsNil)
+	if closer, ok := idx.(io.Closer); ok {
+		defer func() { c.Assert(closer.Close(), gc.IsNil) }()
+	}
+
+	shoes := &index.Document{
+		LinkID:  uuid.New(),
+		Title:   "The best running shoes",
+		Content: "Lightweight shoes for long distance running",
+	}
+	cars := &index.Document{
+		LinkID:  uuid.New(),
+		Title:   "Reviews",
+		Content: "Reviews of the latest automobiles",
+	}
+	for _, doc := range []*index.Document{shoes, cars} {
+		c.Assert(idx.Index(context.TODO(), doc), gc.IsNil)
+	}
+
+	specs := []struct {
+		descr  string
+		query  index.Query
+		expIDs []uuid.UUID
+	}{
+		{
+			descr:  "terms are stemmed",
+			query:  index.Query{Type: index.QueryTypeMatch, Expression: "runs"},
+			expIDs: []uuid.UUID{shoes.LinkID},
+		},
+		{
+			descr:  "stop words are not indexed",
+			query:  index.Query{Type: index.QueryTypeMatch, Expression: "best"},
+			expIDs: nil,
+		},
+		{
+			descr:  "synonyms are expanded",
+			query:  index.Query{Type: index.QueryTypeMatch, Expression: "car"},
+			expIDs: []uuid.UUID{cars.LinkID},
+		},
+		{
+			descr:  "phrases match stemmed terms",
+			query:  index.Query{Type: index.QueryTypePhrase, Expression: "distance runs"},
+			expIDs: []uuid.UUID{shoes.LinkID},
+		},
+		{
+			descr:  "phrases match synonyms",
+			query:  index.Query{Type: index.QueryTypePhrase, Expression: "latest car"},
+			expIDs: []uuid.UUID{cars.LinkID},
+		},
+	}
+	for _, spec := range specs {
+		it, err := idx.Search(context.TODO(), spec.query)
+		c.Assert(err, gc.IsNil, gc.Commentf(spec.descr))
+		c.Assert(iterateDocs(c, it), gc.DeepEquals, spec.expIDs, gc.Commentf(spec.descr))
+	}
+}
+
+func (s *SuiteBase) TestLanguageFilter(c *gc.C) {
+	german := &index.Document{
+		LinkID:   uuid.New(),
+		Title:    "Haustiere",
+		Content:  "Die Katzen schlafen auf dem Sofa",
+		Language: "de",
+	}
+	english := &index.Document{
+		LinkID:   uuid.New(),
+		Title:    "Pets",
+		Content:  "The cats are sleeping on the sofa",
+		Language: "en",
+	}
+	for _, doc := range []*index.Document{german, english} {
+		c.Assert(s.idx.Index(context.TODO(), doc), gc.IsNil)
+	}
+
+	got, err := s.idx.FindByID(context.TODO(), german.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.Language, gc.Equals, "de")
+
+	specs := []struct {
+		descr    string
+		expr     string
+		language string
+		expIDs   []uuid.UUID
+	}{
+		{
+			descr:  "unfiltered queries also match the localized content",
+			expr:   "katze",
+			expIDs: []uuid.UUID{german.LinkID},
+		},
+		{
+			descr:  "unfiltered queries also match the localized content",
+			expr:   "sleeps",
+			expIDs: []uuid.UUID{english.LinkID},
+		},
+		{
+			descr:    "filtered queries use the language analyzer",
+			expr:     "katze",
+			language: "de",
+			expIDs:   []uuid.UUID{german.LinkID},
+		},
+		{
+			descr:    "filtered queries use the language analyzer",
+			expr:     "cat sleeps",
+			language: "en",
+			expIDs:   []uuid.UUID{english.LinkID},
+		},
+		{
+			descr:    "documents in other languages are excluded",
+			expr:     "sofa",
+			language: "en",
+			expIDs:   []uuid.UUID{english.LinkID},
+		},
+	}
+	for _, spec := range specs {
+		it, err := s.idx.Search(context.TODO(), index.Query{
+			Type:       index.QueryTypeMatch,
+			Expression: spec.expr,
+			Filters:    index.Filters{Language: spec.language},
+		})
+		c.Assert(err, gc.IsNil, gc.Commentf(spec.descr))
+		c.Assert(iterateDocs(c, it), gc.DeepEquals, spec.expIDs, gc.Commentf(spec.descr))
+	}
+
+	// Matches of the localized content are highlighted.
+	it, err := s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeMatch,
+		Expression: "katze",
+		Filters:    index.Filters{Language: "de"},
+		Highlight:  &index.HighlightOptions{},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.Next(), gc.Equals, true)
+	c.Assert(it.Highlights().Content, gc.DeepEquals, []string{"Die <em>Katzen</em> schlafen auf dem Sofa"})
+	c.Assert(it.Close(), gc.IsNil)
+}
+
+func (s *SuiteBase) TestSuggest(c *gc.C) {
+	suggester, ok := s.idx.(index.Suggester)
+	if !ok {
+		c.Skip("indexer does not implement index.Suggester")
+	}
+
+	docs := []*index.Document{
+		{LinkID: uuid.New(), Title: "Gopher conference", Content: "The quick brown fox jumps over the lazy dog"},
+		{LinkID: uuid.New(), Content: "Brown bears and quick rabbits"},
+		{LinkID: uuid.New(), Content: "Polar bears live in the arctic"},
+		{LinkID: uuid.New(), Content: "A man with a beard"},
+	}
+	c.Assert(s.idx.IndexMany(context.TODO(), docs), gc.IsNil)
+
+	specs := []struct {
+		descr string
+		expr  string
+		exp   string
+	}{
+		{
+			descr: "misspelled words are replaced and the remaining text is retained",
+			expr:  "Quikc, brwn FOX!",
+			exp:   "quick, brown FOX!",
+		},
+		{
+			descr: "title terms are suggested",
+			expr:  "gophr",
+			exp:   "gopher",
+		},
+		{
+			descr: "terms occurring in more documents are preferred",
+			expr:  "bearz",
+			exp:   "bears",
+		},
+		{
+			descr: "indexed words are not corrected",
+			expr:  "quick brown fox",
+			exp:   "",
+		},
+		{
+			descr: "short words are not corrected",
+			expr:  "dgo",
+			exp:   "",
+		},
+		{
+			descr: "words without similar terms are not corrected",
+			expr:  "xylophone",
+			exp:   "",
+		},
+	}
+	for _, spec := range specs {
+		got, err := suggester.Suggest(context.TODO(), spec.expr)
+		c.Assert(err, gc.IsNil, gc.Commentf(spec.descr))
+		c.Assert(got, gc.Equals, spec.exp, gc.Commentf(spec.descr))
+	}
+}
+
+func (s *SuiteBase) TestComplete(c *gc.C) {
+	completer, ok := s.idx.(index.Completer)
+	if !ok {
+		c.Skip("indexer does not implement index.Completer")
+	}
+
+	var (
+		tour    = &index.Document{LinkID: uuid.New(), Title: "A Tour of Go", Content: "Gophers welcome"}
+		gophers = &index.Document{LinkID: uuid.New(), Title: "Gophers and goroutines", Content: "Concurrency"}
+		golf    = &index.Document{LinkID: uuid.New(), Title: "Golf clubs", Content: "Go golfing"}
+		mirror  = &index.Document{LinkID: uuid.New(), Title: "a tour of GO"}
+	)
+	c.Assert(s.idx.IndexMany(context.TODO(), []*index.Document{tour, gophers, golf, mirror}), gc.IsNil)
+	c.Assert(s.idx.UpdateScores(context.TODO(), []index.ScoreUpdate{
+		{LinkID: tour.LinkID, Score: 0.9},
+		{LinkID: gophers.LinkID, Score: 0.5},
+		{LinkID: golf.LinkID, Score: 0.2},
+		{LinkID: mirror.LinkID, Score: 0.1},
+	}), gc.IsNil)
+
+	type completion struct {
+		Type   index.CompletionType
+		Text   string
+		LinkID uuid.UUID
+	}
+	complete := func(prefix string, limit int) []completion {
+		completions, err := completer.Complete(context.TODO(), prefix, limit)
+		c.Assert(err, gc.IsNil, gc.Commentf("prefix %q", prefix))
+		var got []completion
+		for _, comp := range completions {
+			got = append(got, completion{Type: comp.Type, Text: comp.Text, LinkID: comp.LinkID})
+		}
+		return got
+	}
+
+	// Completions are ranked by PageRank; duplicate titles are omitted.
+	c.Assert(complete("Go", 0), gc.DeepEquals, []completion{
+		{Type: index.CompletionTypeTitle, Text: "A Tour of Go", LinkID: tour.LinkID},
+		{Type: index.CompletionTypeTitle, Text: "Gophers and goroutines", LinkID: gophers.LinkID},
+		{Type: index.CompletionTypeTerm, Text: "gophers", LinkID: gophers.LinkID},
+		{Type: index.CompletionTypeTerm, Text: "goroutines", LinkID: gophers.LinkID},
+		{Type: index.CompletionTypeTitle, Text: "Golf clubs", LinkID: golf.LinkID},
+		{Type: index.CompletionTypeTerm, Text: "golf", LinkID: golf.LinkID},
+	})
+
+	// All words must match title words; content is ignored.
+	c.Assert(complete("tour go", 0), gc.DeepEquals, []completion{
+		{Type: index.CompletionTypeTitle, Text: "A Tour of Go", LinkID: tour.LinkID},
+	})
+	c.Assert(complete("welcome", 0), gc.HasLen, 0)
+
+	c.Assert(complete("Gophers GOR", 1), gc.DeepEquals, []completion{
+		{Type: index.CompletionTypeTitle, Text: "Gophers and goroutines", LinkID: gophers.LinkID},
+	})
+	c.Assert(complete("Gophers GOR", 2), gc.DeepEquals, []completion{
+		{Type: index.CompletionTypeTitle, Text: "Gophers and goroutines", LinkID: gophers.LinkID},
+		{Type: index.CompletionTypeTerm, Text: "Gophers goroutines", LinkID: gophers.LinkID},
+	})
+	c.Assert(complete(" !? ", 0), gc.HasLen, 0)
+
+	// Prefixes without a word of MinCompletionWordLength characters are
+	// not completed.
+	c.Assert(complete("g", 0), gc.HasLen, 0)
+}
+
+func (s *SuiteBase) TestRelated(c *gc.C) {
+	finder, ok := s.idx.(index.RelatedFinder)
+	if !ok {
+		c.Skip("indexer does not implement index.RelatedFinder")
+	}
+
+	var (
+		source   = &index.Document{LinkID: uuid.New(), Title: "Gopher burrows", Content: "Gophers dig extensive tunnel systems underground with their strong claws"}
+		pocket   = &index.Document{LinkID: uuid.New(), Title: "Pocket gophers", Content: "Pocket gophers dig tunnel systems underground"}
+		moles    = &index.Document{LinkID: uuid.New(), Title: "Moles", Content: "Moles dig underground with claws"}
+		markets  = &index.Document{LinkID: uuid.New(), Title: "Markets", Content: "Stock markets rallied today"}
+		scoreDoc = uuid.New()
+	)
+	c.Assert(s.idx.IndexMany(context.TODO(), []*index.Document{source, pocket, moles, markets}), gc.IsNil)
+	c.Assert(s.idx.UpdateScore(context.TODO(), scoreDoc, 0.5), gc.IsNil)
+
+	// The most similar documents are returned first and the source
+	// document is excluded.
+	it, err := finder.Related(context.TODO(), source.LinkID, 0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.TotalCount(), gc.Equals, uint64(2))
+	c.Assert(iterateDocs(c, it), gc.DeepEquals, []uuid.UUID{pocket.LinkID, moles.LinkID})
+
+	// At most n documents are returned.
+	it, err = finder.Related(context.TODO(), source.LinkID, 1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(iterateDocs(c, it), gc.DeepEquals, []uuid.UUID{pocket.LinkID})
+
+	// Indexers that support it can use documents that are not stored in
+	// the index as the source; documents with the same link ID are
+	// excluded.
+	if toFinder, ok := s.idx.(relatedFinder); ok {
+		it, err = toFinder.RelatedTo(context.TODO(), &index.Document{LinkID: uuid.New(), Title: source.Title, Content: source.Content}, 0)
+		c.Assert(err, gc.IsNil)
+		c.Assert(iterateDocs(c, it), gc.DeepEquals, []uuid.UUID{source.LinkID, pocket.LinkID, moles.LinkID})
+
+		it, err = toFinder.RelatedTo(context.TODO(), source, 0)
+		c.Assert(err, gc.IsNil)
+		c.Assert(iterateDocs(c, it), gc.DeepEquals, []uuid.UUID{pocket.LinkID, moles.LinkID})
+	}
+
+	// Documents without shared terms have no related documents.
+	for _, linkID := range []uuid.UUID{markets.LinkID, scoreDoc} {
+		it, err = finder.Related(context.TODO(), linkID, 0)
+		c.Assert(err, gc.IsNil)
+		c.Assert(iterateDocs(c, it), gc.HasLen, 0)
+	}
+
+	_, err = finder.Related(context.TODO(), uuid.New(), 0)
+	c.Assert(xerrors.Is(err, index.ErrNotFound), gc.Equals, true, gc.Commentf("%v", err))
+}
+
+func (s *SuiteBase) TestSearchScores(c *gc.C) {
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	docs := []*index.Document{
+		{LinkID: ids[0], Title: "Burrows", Content: "gopher gopher gopher tunnels"},
+		{LinkID: ids[1], Title: "Burrows", Content: "gopher tunnels"},
+		{LinkID: ids[2], Title: "Burrows", Content: "mole tunnels"},
+	}
+	c.Assert(s.idx.IndexMany(context.TODO(), docs), gc.IsNil)
+
+	it, err := s.idx.Search(context.TODO(), index.Query{Type: index.QueryTypeMatch, Expression: "gopher"})
+	c.Assert(err, gc.IsNil)
+	var (
+		got    []uuid.UUID
+		scores []float64
+	)
+	for it.Next() {
+		got = append(got, it.Document().LinkID)
+		scores = append(scores, it.Score())
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+	c.Assert(got, gc.DeepEquals, ids[:2])
+	c.Assert(scores[0] > scores[1], gc.Equals, true, gc.Commentf("scores: %v", scores))
+	c.Assert(scores[1] > 0, gc.Equals, true, gc.Commentf("scores: %v", scores))
+}
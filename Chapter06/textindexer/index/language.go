@@ -0,0 +1,83 @@
+package index
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The maximum number of words that DetectLanguage examines.
+const maxDetectionWords = 1000
+
+// The minimum number of words and the minimum fraction of the examined words
+// that must be common words of a language for DetectLanguage to report it.
+const (
+	minDetectionMatches = 2
+	minDetectionRatio   = 0.05
+)
+
+// commonWords lists the most frequent words of each supported language.
+// Words shared by several languages count towards each of them; the
+// remaining words tell related languages apart.
+var commonWords = map[string][]string{
+	"da": {"og", "i", "at", "det", "er", "en", "til", "på", "den", "af", "med", "for", "ikke", "der", "som", "de", "har", "jeg", "et", "var", "men", "fra", "kan", "også", "vil", "efter", "når", "hvor", "blev", "meget", "hvad", "eller", "dig", "mig", "ind", "ud", "os", "mere", "vores", "nu", "hvis", "inden"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "des", "auf", "für", "dem", "von", "auch", "es", "im", "sie", "wird", "werden", "oder", "aber", "wie", "bei", "nach", "noch", "über", "ich", "wir", "sind"},
+	"en": {"the", "and", "of", "to", "in", "is", "that", "it", "for", "was", "with", "as", "on", "are", "this", "be", "by", "have", "from", "or", "which", "you", "not", "but", "at", "they", "his", "her", "were", "an", "we", "has"},
+	"es": {"el", "la", "los", "las", "de", "y", "que", "en", "del", "es", "por", "con", "una", "para", "se", "su", "al", "lo", "como", "más", "pero", "sus", "le", "ha", "este", "son", "entre", "cuando", "muy", "sin", "también", "fue"},
+	"fi": {"ja", "on", "ei", "se", "että", "oli", "hän", "ovat", "myös", "mutta", "kun", "tai", "joka", "sen", "ole", "niin", "kuin", "tämä", "mitä", "vain", "jo", "olla", "sitä", "sekä", "jotka", "voi", "nyt", "hänen", "mukaan", "siitä"},
+	"fr": {"le", "la", "les", "et", "des", "est", "un", "une", "du", "que", "qui", "dans", "pour", "pas", "sur", "au", "avec", "ce", "il", "sont", "par", "plus", "ne", "se", "nous", "vous", "aux", "cette", "elle", "mais", "ou", "été"},
+	"hu": {"a", "az", "és", "hogy", "nem", "is", "egy", "van", "meg", "de", "ez", "már", "csak", "ki", "el", "mint", "még", "vagy", "volt", "minden", "úgy", "kell", "lesz", "azt", "ezt", "amely", "után", "pedig", "nagyon", "között"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "una", "del", "della", "non", "sono", "è", "le", "con", "si", "gli", "da", "nel", "anche", "alla", "dei", "come", "più", "ma", "questo", "ha", "delle", "loro", "essere"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "die", "ook", "aan", "er", "maar", "als", "bij", "nog", "wordt", "door", "naar", "dit", "wij", "uit", "heeft", "kan", "deze"},
+	"no": {"og", "i", "det", "er", "en", "til", "på", "som", "ikke", "av", "for", "med", "har", "de", "var", "jeg", "et", "men", "fra", "kan", "også", "vil", "etter", "når", "hvor", "ble", "mye", "skal", "seg", "hun", "eller", "hva", "den", "inn", "ut", "oss", "mer", "våre", "nå", "hvis", "deg", "meg", "før"},
+	"ro": {"și", "de", "în", "la", "cu", "care", "pe", "nu", "este", "o", "un", "să", "din", "mai", "a", "pentru", "sunt", "ce", "fost", "au", "sau", "se", "dar", "prin", "acest", "când", "despre", "foarte", "după", "lui"},
+	"ru": {"и", "в", "не", "на", "что", "с", "он", "как", "это", "по", "но", "из", "к", "у", "за", "от", "для", "так", "же", "она", "все", "было", "они", "его", "был", "о", "бы", "только", "или", "уже"},
+	"sv": {"och", "i", "att", "det", "är", "en", "som", "på", "av", "för", "med", "till", "den", "inte", "har", "de", "om", "ett", "var", "jag", "men", "från", "kan", "också", "ska", "efter", "när", "eller", "sig", "vi", "mycket", "blev"},
+	"tr": {"ve", "bir", "bu", "da", "de", "için", "ile", "çok", "olarak", "daha", "gibi", "ne", "en", "ama", "değil", "olan", "kadar", "sonra", "var", "mı", "ben", "her", "o", "ki", "diye", "şey", "biz", "onun", "veya", "göre"},
+}
+
+// commonWordLanguages maps each common word to the languages that use it.
+var commonWordLanguages = func() map[string][]string {
+	languages := make(map[string][]string)
+	for _, code := range SupportedLanguages() {
+		for _, word := range commonWords[code] {
+			languages[word] = append(languages[word], code)
+		}
+	}
+	return languages
+}()
+
+// DetectLanguage returns the ISO 639-1 code of the supported language that
+// text is most likely written in, or an empty string if the language cannot
+// be determined. Detection runs locally by counting the occurrences of the
+// most common words of each language.
+func DetectLanguage(text string) string {
+	var (
+		counts = make(map[string]int)
+		words  int
+	)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.Is(unicode.Mn, r)
+	}) {
+		if words++; words > maxDetectionWords {
+			words = maxDetectionWords
+			break
+		}
+		for _, code := range commonWordLanguages[word] {
+			counts[code]++
+		}
+	}
+
+	var (
+		best      string
+		bestCount int
+	)
+	for _, code := range SupportedLanguages() {
+		if counts[code] > bestCount {
+			best, bestCount = code, counts[code]
+		}
+	}
+	if bestCount < minDetectionMatches || float64(bestCount) < minDetectionRatio*float64(words) {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,39 @@
+package index
+
+import (
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(LanguageTestSuite))
+
+type LanguageTestSuite struct{}
+
+func (s *LanguageTestSuite) TestDetectLanguage(c *gc.C) {
+	specs := []struct {
+		text string
+		exp  string
+	}{
+		{"The quick brown fox jumps over the lazy dog and runs into the forest.", "en"},
+		{"Der schnelle braune Fuchs springt über den faulen Hund und läuft in den Wald.", "de"},
+		{"Le renard brun rapide saute par-dessus le chien paresseux et court dans la forêt.", "fr"},
+		{"El rápido zorro marrón salta sobre el perro perezoso y corre hacia el bosque.", "es"},
+		{"La volpe marrone veloce salta sopra il cane pigro e corre nella foresta.", "it"},
+		{"De snelle bruine vos springt over de luie hond en rent het bos in.", "nl"},
+		{"Den hurtige brune ræv hopper over den dovne hund og løber ind i skoven.", "da"},
+		{"Den raske brune reven hopper over den late hunden og løper inn i skogen.", "no"},
+		{"Læs mere om vores produkter og se, hvad andre kunder siger om dem.", "da"},
+		{"Les mer om våre produkter og se hva andre kunder sier om dem.", "no"},
+		{"Vi sender din ordre samme dag, hvis du bestiller inden klokken 15.", "da"},
+		{"Vi sender bestillingen din samme dag hvis du bestiller før klokken 15.", "no"},
+		{"Den snabba bruna räven hoppar över den lata hunden och springer in i skogen.", "sv"},
+		{"Nopea ruskea kettu hyppää laiskan koiran yli ja juoksee metsään, koska se on nälkäinen.", "fi"},
+		{"Быстрая коричневая лиса прыгает через ленивую собаку и бежит в лес, как и всегда.", "ru"},
+		{"Hızlı kahverengi tilki tembel köpeğin üzerinden atlar ve ormana doğru koşar, çok hızlı.", "tr"},
+		{"", ""},
+		{"12345 67890", ""},
+		{"Gopher", ""},
+	}
+	for _, spec := range specs {
+		c.Assert(DetectLanguage(spec.text), gc.Equals, spec.exp, gc.Commentf("text %q", spec.text))
+	}
+}
@@ -0,0 +1,325 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QuerySyntaxError is returned by ParseQuery when the query expression is
+// malformed. It wraps ErrInvalidQuery.
+type QuerySyntaxError struct {
+	// Pos is the byte offset in the expression where the error was
+	// detected.
+	Pos int
+	Msg string
+}
+
+// Error implements the error interface.
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos, e.Msg)
+}
+
+// Unwrap returns ErrInvalidQuery.
+func (e *QuerySyntaxError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+// ParseQuery parses a query expression into a query tree. The supported
+// syntax is:
+//
+//   - words: documents must contain the word in their title or content
+//   - "quoted phrases": documents must contain the exact phrase
+//   - title:word, title:"a phrase": restrict matching to the title
+//   - site:example.com: restrict results to a host and its subdomains
+//   - a AND b, a OR b, NOT a: boolean operators (in decreasing order of
+//     precedence: NOT, AND, OR). Adjacent terms are implicitly ANDed.
+//   - -a: shorthand for NOT a; a "-" that is not directly followed by a
+//     term is ignored
+//   - (a OR b) c: grouping
+//
+// The operator keywords are case-sensitive; lower-case "and", "or" and "not"
+// are treated as regular words.
+func ParseQuery(expr string) (QueryNode, error) {
+	tokens, err := tokenizeQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, &QuerySyntaxError{Pos: 0, Msg: "empty query"}
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		if tok.kind == tokRParen {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "unbalanced closing parenthesis"}
+		}
+		return nil, &QuerySyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %s", tok)}
+	}
+	return node, nil
+}
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokAnd
+	tokOr
+	tokNot
+	tokMinus
+	tokLParen
+	tokRParen
+)
+
+type queryToken struct {
+	kind  tokenKind
+	pos   int
+	field Field
+	text  string
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokAnd:
+		return "operator AND"
+	case tokOr:
+		return "operator OR"
+	case tokNot:
+		return "operator NOT"
+	case tokMinus:
+		return `"-"`
+	case tokLParen:
+		return `"("`
+	case tokRParen:
+		return `")"`
+	case tokPhrase:
+		return fmt.Sprintf("phrase %q", t.text)
+	default:
+		return fmt.Sprintf("word %q", t.text)
+	}
+}
+
+var queryFields = map[string]Field{
+	"title": FieldTitle,
+	"site":  FieldSite,
+}
+
+func tokenizeQuery(expr string) ([]queryToken, error) {
+	var tokens []queryToken
+	for pos := 0; pos < len(expr); {
+		r, size := utf8.DecodeRuneInString(expr[pos:])
+		switch {
+		case unicode.IsSpace(r):
+			pos += size
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokLParen, pos: pos})
+			pos += size
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokRParen, pos: pos})
+			pos += size
+		case r == '-' && (pos+size == len(expr) || isQuerySpace(expr[pos+size:])):
+			// A standalone "-" does not negate anything and would be
+			// discarded by the analyzers; ignore it.
+			pos += size
+		case r == '-':
+			tokens = append(tokens, queryToken{kind: tokMinus, pos: pos})
+			pos += size
+		case r == '"':
+			phrase, next, err := scanPhrase(expr, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokPhrase, pos: pos, text: phrase})
+			pos = next
+		default:
+			tok, next, err := scanWord(expr, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			pos = next
+		}
+	}
+	return append(tokens, queryToken{kind: tokEOF, pos: len(expr)}), nil
+}
+
+func isQuerySpace(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsSpace(r)
+}
+
+// scanPhrase scans a quoted phrase starting at the opening quote located at
+// pos. It returns the phrase contents and the position after the closing
+// quote.
+func scanPhrase(expr string, pos int) (string, int, error) {
+	end := strings.IndexByte(expr[pos+1:], '"')
+	if end == -1 {
+		return "", 0, &QuerySyntaxError{Pos: pos, Msg: "unterminated phrase"}
+	}
+	phrase := strings.TrimSpace(expr[pos+1 : pos+1+end])
+	if phrase == "" {
+		return "", 0, &QuerySyntaxError{Pos: pos, Msg: "empty phrase"}
+	}
+	return phrase, pos + end + 2, nil
+}
+
+// scanWord scans a word, keyword or field term starting at pos.
+func scanWord(expr string, pos int) (queryToken, int, error) {
+	end := pos
+	for end < len(expr) {
+		r, size := utf8.DecodeRuneInString(expr[end:])
+		if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+			break
+		}
+		end += size
+	}
+	word := expr[pos:end]
+
+	switch word {
+	case "AND":
+		return queryToken{kind: tokAnd, pos: pos}, end, nil
+	case "OR":
+		return queryToken{kind: tokOr, pos: pos}, end, nil
+	case "NOT":
+		return queryToken{kind: tokNot, pos: pos}, end, nil
+	}
+
+	colon := strings.IndexByte(word, ':')
+	if colon == -1 {
+		return queryToken{kind: tokWord, pos: pos, text: word}, end, nil
+	}
+	field, known := queryFields[strings.ToLower(word[:colon])]
+	if !known {
+		// Not a field filter; treat the whole thing as a regular word.
+		return queryToken{kind: tokWord, pos: pos, text: word}, end, nil
+	}
+
+	if value := word[colon+1:]; value != "" {
+		return queryToken{kind: tokWord, pos: pos, field: field, text: value}, end, nil
+	}
+	if end < len(expr) && expr[end] == '"' && field != FieldSite {
+		phrase, next, err := scanPhrase(expr, end)
+		if err != nil {
+			return queryToken{}, 0, err
+		}
+		return queryToken{kind: tokPhrase, pos: pos, field: field, text: phrase}, next, nil
+	}
+	return queryToken{}, 0, &QuerySyntaxError{Pos: pos, Msg: fmt.Sprintf("missing value for field %q", field)}
+}
+
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) consume() queryToken {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+// parseOr parses: and { OR and }
+func (p *queryParser) parseOr() (QueryNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []QueryNode{first}
+	for p.peek().kind == tokOr {
+		p.consume()
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &OrNode{Children: children}, nil
+}
+
+// parseAnd parses: unary { [AND] unary }
+func (p *queryParser) parseAnd() (QueryNode, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []QueryNode{first}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.consume()
+		case tokWord, tokPhrase, tokNot, tokMinus, tokLParen:
+			// implicit AND
+		default:
+			if len(children) == 1 {
+				return first, nil
+			}
+			return &AndNode{Children: children}, nil
+		}
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+}
+
+// parseUnary parses: (NOT | -) unary | primary
+func (p *queryParser) parseUnary() (QueryNode, error) {
+	switch p.peek().kind {
+	case tokNot, tokMinus:
+		p.consume()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotNode{Child: child}, nil
+	default:
+		return p.parsePrimary()
+	}
+}
+
+// parsePrimary parses: ( or ) | word | phrase
+func (p *queryParser) parsePrimary() (QueryNode, error) {
+	tok := p.consume()
+	switch tok.kind {
+	case tokWord:
+		return &TermNode{Field: tok.field, Text: tok.text}, nil
+	case tokPhrase:
+		return &PhraseNode{Field: tok.field, Phrase: tok.text}, nil
+	case tokLParen:
+		if p.peek().kind == tokRParen {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "empty group"}
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "unbalanced opening parenthesis"}
+		}
+		p.consume()
+		return node, nil
+	case tokRParen:
+		return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "unbalanced closing parenthesis"}
+	default:
+		return nil, &QuerySyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected a term but got %s", tok)}
+	}
+}
@@ -0,0 +1,80 @@
+package index
+
+import (
+	"golang.org/x/xerrors"
+	gc "gopkg.in/check.v1"
+	"testing"
+)
+
+var _ = gc.Suite(new(QueryParserTestSuite))
+
+type QueryParserTestSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *QueryParserTestSuite) TestParse(c *gc.C) {
+	specs := []struct {
+		expr string
+		exp  string
+	}{
+		{`foo`, `foo`},
+		{`foo bar`, `AND(foo, bar)`},
+		{`foo AND bar`, `AND(foo, bar)`},
+		{`foo OR bar baz`, `OR(foo, AND(bar, baz))`},
+		{`foo OR bar OR baz`, `OR(foo, bar, baz)`},
+		{`(foo OR bar) baz`, `AND(OR(foo, bar), baz)`},
+		{`NOT foo bar`, `AND(NOT(foo), bar)`},
+		{`foo -bar`, `AND(foo, NOT(bar))`},
+		{`foo - bar`, `AND(foo, bar)`},
+		{`foo -`, `foo`},
+		{`-(foo OR bar)`, `NOT(OR(foo, bar))`},
+		{`"foo  bar" baz`, `AND("foo  bar", baz)`},
+		{`title:foo`, `title:foo`},
+		{`title:"foo bar"`, `title:"foo bar"`},
+		{`TITLE:foo`, `title:foo`},
+		{`site:example.com -title:go`, `AND(site:example.com, NOT(title:go))`},
+		{`time:10:30`, `time:10:30`},
+		{`foo and or not`, `AND(foo, and, or, not)`},
+		{`foo(bar)`, `AND(foo, bar)`},
+	}
+
+	for _, spec := range specs {
+		node, err := ParseQuery(spec.expr)
+		c.Assert(err, gc.IsNil, gc.Commentf("query: %s", spec.expr))
+		c.Assert(node.String(), gc.Equals, spec.exp, gc.Commentf("query: %s", spec.expr))
+	}
+}
+
+func (s *QueryParserTestSuite) TestParseErrors(c *gc.C) {
+	specs := []struct {
+		expr   string
+		expPos int
+		expMsg string
+	}{
+		{``, 0, "empty query"},
+		{`   `, 0, "empty query"},
+		{` - `, 0, "empty query"},
+		{`foo "bar`, 4, "unterminated phrase"},
+		{`foo ""`, 4, "empty phrase"},
+		{`foo (bar`, 4, "unbalanced opening parenthesis"},
+		{`foo bar)`, 7, "unbalanced closing parenthesis"},
+		{`foo ()`, 4, "empty group"},
+		{`foo OR`, 6, "expected a term but got end of query"},
+		{`foo AND OR bar`, 8, "expected a term but got operator OR"},
+		{`NOT`, 3, "expected a term but got end of query"},
+		{`title: foo`, 0, `missing value for field "title"`},
+		{`site:"example.com"`, 0, `missing value for field "site"`},
+	}
+
+	for _, spec := range specs {
+		_, err := ParseQuery(spec.expr)
+		c.Assert(xerrors.Is(err, ErrInvalidQuery), gc.Equals, true, gc.Commentf("query: %s", spec.expr))
+
+		var syntaxErr *QuerySyntaxError
+		c.Assert(xerrors.As(err, &syntaxErr), gc.Equals, true)
+		c.Assert(syntaxErr.Pos, gc.Equals, spec.expPos, gc.Commentf("query: %s", spec.expr))
+		c.Assert(syntaxErr.Msg, gc.Equals, spec.expMsg, gc.Commentf("query: %s", spec.expr))
+	}
+}
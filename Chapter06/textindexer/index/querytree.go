@@ -0,0 +1,120 @@
+package index
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Field identifies the document field that a query term applies to.
+type Field uint8
+
+const (
+	// FieldAny matches terms against both the Title and Content fields.
+	FieldAny Field = iota
+
+	// FieldTitle matches terms against the Title field.
+	FieldTitle
+
+	// FieldSite matches the host of the document URL. A site term matches
+	// both the host itself and any of its subdomains.
+	FieldSite
+)
+
+// String returns the name of the field as used in query expressions.
+func (f Field) String() string {
+	switch f {
+	case FieldTitle:
+		return "title"
+	case FieldSite:
+		return "site"
+	default:
+		return ""
+	}
+}
+
+// QueryNode is implemented by the nodes of a parsed query tree.
+type QueryNode interface {
+	fmt.Stringer
+
+	queryNode()
+}
+
+// TermNode matches documents that contain all the words in Text.
+type TermNode struct {
+	Field Field
+	Text  string
+}
+
+// PhraseNode matches documents that contain the words of Phrase in the
+// exact same order.
+type PhraseNode struct {
+	Field  Field
+	Phrase string
+}
+
+// AndNode matches documents that match all of its children.
+type AndNode struct {
+	Children []QueryNode
+}
+
+// OrNode matches documents that match at least one of its children.
+type OrNode struct {
+	Children []QueryNode
+}
+
+// NotNode matches documents that do not match its child.
+type NotNode struct {
+	Child QueryNode
+}
+
+func (*TermNode) queryNode()   {}
+func (*PhraseNode) queryNode() {}
+func (*AndNode) queryNode()    {}
+func (*OrNode) queryNode()     {}
+func (*NotNode) queryNode()    {}
+
+func (n *TermNode) String() string {
+	return fieldPrefix(n.Field) + n.Text
+}
+
+func (n *PhraseNode) String() string {
+	return fieldPrefix(n.Field) + `"` + n.Phrase + `"`
+}
+
+func (n *AndNode) String() string {
+	return "AND(" + joinNodes(n.Children) + ")"
+}
+
+func (n *OrNode) String() string {
+	return "OR(" + joinNodes(n.Children) + ")"
+}
+
+func (n *NotNode) String() string {
+	return "NOT(" + n.Child.String() + ")"
+}
+
+func fieldPrefix(f Field) string {
+	if f == FieldAny {
+		return ""
+	}
+	return f.String() + ":"
+}
+
+func joinNodes(nodes []QueryNode) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// URLHost returns the lower-cased host name (without the port) of rawURL or
+// an empty string if rawURL cannot be parsed.
+func URLHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,73 @@
+package index
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultRanking is the ranking used for queries that do not specify one.
+var DefaultRanking = Ranking{
+	TextWeight:     1,
+	PageRankWeight: 1,
+	TitleBoost:     2,
+}
+
+// Ranking controls how the score of each document matching a query is
+// calculated. The score of a document is defined as:
+//
+//	TextWeight * relevance + PageRankWeight * PageRank + FreshnessWeight * freshness
+//
+// where relevance is the text relevance score calculated by the backend with
+// Title matches boosted by TitleBoost and freshness decays exponentially from
+// 1 towards 0 as the document ages, halving every FreshnessHalfLife.
+type Ranking struct {
+	// TextWeight scales the text relevance score.
+	TextWeight float64
+
+	// PageRankWeight scales the PageRank score of each document.
+	PageRankWeight float64
+
+	// TitleBoost scales the relevance of matches in the Title field
+	// relative to matches in the Content field. If not specified, a
+	// value of 1 will be used.
+	TitleBoost float64
+
+	// FreshnessWeight scales the freshness score of each document.
+	// Freshness scoring is disabled unless both FreshnessWeight and
+	// FreshnessHalfLife are greater than zero. Documents without an
+	// IndexedAt value do not receive a freshness score.
+	FreshnessWeight   float64
+	FreshnessHalfLife time.Duration
+}
+
+// EffectiveTitleBoost returns the title boost to apply for this ranking.
+func (r Ranking) EffectiveTitleBoost() float64 {
+	if r.TitleBoost <= 0 {
+		return 1
+	}
+	return r.TitleBoost
+}
+
+// FreshnessEnabled returns true if the ranking includes a freshness score.
+func (r Ranking) FreshnessEnabled() bool {
+	return r.FreshnessWeight > 0 && r.FreshnessHalfLife > 0
+}
+
+// Freshness returns the freshness score for a document that was indexed at
+// indexedAt with respect to the reference time now.
+func (r Ranking) Freshness(indexedAt, now time.Time) float64 {
+	age := now.Sub(indexedAt)
+	if age < 0 {
+		age = -age
+	}
+	return math.Pow(0.5, float64(age)/float64(r.FreshnessHalfLife))
+}
+
+// RankingOrDefault returns q.Ranking or DefaultRanking if the query does not
+// specify a ranking.
+func (q Query) RankingOrDefault() Ranking {
+	if q.Ranking == nil {
+		return DefaultRanking
+	}
+	return *q.Ranking
+}
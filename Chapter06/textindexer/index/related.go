@@ -0,0 +1,28 @@
+package index
+
+// DefaultRelatedLimit is the number of related documents that are returned if
+// no limit is specified.
+const DefaultRelatedLimit = 10
+
+// The parameters of the more-like-this queries that find the documents that
+// are related to a document. The terms of the Title and Content of the
+// document that occur at least RelatedMinTermFreq times in it and in at least
+// RelatedMinDocFreq indexed documents, including the document itself, are
+// ranked by their TF-IDF weight and the RelatedMaxQueryTerms best terms are
+// selected. Related documents must contain at least
+// RelatedMinShouldMatchPercent percent of the selected terms.
+const (
+	RelatedMinTermFreq           = 1
+	RelatedMinDocFreq            = 2
+	RelatedMaxQueryTerms         = 25
+	RelatedMinShouldMatchPercent = 30
+)
+
+// RelatedMinShouldMatch returns the number of the selected terms of a
+// more-like-this query that related documents must contain.
+func RelatedMinShouldMatch(numTerms int) int {
+	if min := numTerms * RelatedMinShouldMatchPercent / 100; min > 1 {
+		return min
+	}
+	return 1
+}
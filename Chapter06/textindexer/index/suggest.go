@@ -0,0 +1,77 @@
+package index
+
+import (
+	"strings"
+)
+
+// The parameters that control which indexed terms are suggested as spelling
+// corrections for the words of a query expression. Only words that do not
+// occur in the index and are at least SuggestMinWordLength characters long
+// are corrected. A correction must share the first SuggestPrefixLength
+// characters with the word and be within SuggestMaxEdits edits of it.
+const (
+	SuggestMaxEdits      = 2
+	SuggestPrefixLength  = 1
+	SuggestMinWordLength = 4
+)
+
+// Correction replaces the word at the [Start, End) byte range of a query
+// expression with Term.
+type Correction struct {
+	Start int
+	End   int
+	Term  string
+}
+
+// ApplyCorrections returns a copy of expression with the specified
+// corrections applied. The corrections must be ordered by their Start offset
+// and must not overlap.
+func ApplyCorrections(expression string, corrections []Correction) string {
+	var (
+		sb   strings.Builder
+		last int
+	)
+	for _, corr := range corrections {
+		sb.WriteString(expression[last:corr.Start])
+		sb.WriteString(corr.Term)
+		last = corr.End
+	}
+	sb.WriteString(expression[last:])
+	return sb.String()
+}
+
+// EditDistance returns the number of single-character insertions, deletions,
+// substitutions and transpositions of adjacent characters that are required
+// to turn a into b.
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// Only the last three rows of the distance matrix are retained.
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,39 @@
+package index
+
+import (
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(SuggestTestSuite))
+
+type SuggestTestSuite struct{}
+
+func (s *SuggestTestSuite) TestEditDistance(c *gc.C) {
+	specs := []struct {
+		a, b string
+		exp  int
+	}{
+		{"", "", 0},
+		{"", "fox", 3},
+		{"fox", "fox", 0},
+		{"brwn", "brown", 1},
+		{"quikc", "quick", 1},
+		{"kitten", "sitting", 3},
+		{"straße", "strasse", 2},
+		{"über", "uber", 1},
+	}
+	for _, spec := range specs {
+		c.Assert(EditDistance(spec.a, spec.b), gc.Equals, spec.exp, gc.Commentf("%q -> %q", spec.a, spec.b))
+		c.Assert(EditDistance(spec.b, spec.a), gc.Equals, spec.exp, gc.Commentf("%q -> %q", spec.b, spec.a))
+	}
+}
+
+func (s *SuggestTestSuite) TestApplyCorrections(c *gc.C) {
+	expr := "Quikc, brwn fox!"
+	got := ApplyCorrections(expr, []Correction{
+		{Start: 0, End: 5, Term: "quick"},
+		{Start: 7, End: 11, Term: "brown"},
+	})
+	c.Assert(got, gc.Equals, "quick, brown fox!")
+	c.Assert(ApplyCorrections(expr, nil), gc.Equals, expr)
+}
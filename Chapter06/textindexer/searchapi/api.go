@@ -0,0 +1,102 @@
+package searchapi
+
+import (
+	"github.com/google/uuid"
+	"test_project/Chapter06/textindexer/index"
+	"time"
+)
+
+// SearchRequest is the JSON body accepted by the search endpoint.
+type SearchRequest struct {
+	// Query is the search expression. It must not be empty.
+	Query string `json:"query"`
+
+	// Type selects how Query is interpreted: "match" (default), "phrase",
+	// "advanced" or "hybrid". Hybrid queries are only supported if the
+	// indexer maintains a vector index.
+	Type string `json:"type,omitempty"`
+
+	// VectorWeight is the weight of the vector similarity in the scores
+	// of hybrid queries. If not specified, index.DefaultVectorWeight will
+	// be used; a weight of 0 ranks hybrid results by their lexical score
+	// only.
+	VectorWeight *float64 `json:"vector_weight,omitempty"`
+
+	// Offset is the number of results to skip. It cannot be combined
+	// with Cursor.
+	Offset uint64 `json:"offset,omitempty"`
+
+	// PageSize is the maximum number of results to return. If not
+	// specified, index.DefaultPageSize will be used.
+	PageSize int `json:"page_size,omitempty"`
+
+	// Cursor resumes a previous search after the last result of the
+	// page that returned it as NextCursor.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// SearchResponse is the JSON body returned by the search endpoint.
+type SearchResponse struct {
+	// TotalCount is the total number of documents matching the query.
+	TotalCount uint64 `json:"total_count"`
+
+	Results []Document `json:"results"`
+
+	// NextCursor, if not empty, can be specified as the cursor of a
+	// follow-up request to fetch the next page of results.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Document is the JSON representation of an indexed document. The content
+// of a document is only included by the document lookup endpoint.
+type Document struct {
+	LinkID    uuid.UUID `json:"link_id"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content,omitempty"`
+	IndexedAt time.Time `json:"indexed_at"`
+	PageRank  float64   `json:"page_rank"`
+}
+
+// ErrorResponse is the JSON body returned when a request fails.
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// Error describes why a request failed. Code is a stable, machine-readable
+// identifier while Message is intended for humans.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// The error codes reported by the server.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeTimeout          = "timeout"
+	CodeInternal         = "internal"
+)
+
+var queryTypes = map[string]index.QueryType{
+	"":         index.QueryTypeMatch,
+	"match":    index.QueryTypeMatch,
+	"phrase":   index.QueryTypePhrase,
+	"advanced": index.QueryTypeAdvanced,
+	"hybrid":   index.QueryTypeHybrid,
+}
+
+func makeDocument(doc *index.Document, includeContent bool) Document {
+	d := Document{
+		LinkID:    doc.LinkID,
+		URL:       doc.URL,
+		Title:     doc.Title,
+		IndexedAt: doc.IndexedAt,
+		PageRank:  doc.PageRank,
+	}
+	if includeContent {
+		d.Content = doc.Content
+	}
+	return d
+}
@@ -0,0 +1,50 @@
+package searchapi
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+	"test_project/Chapter06/textindexer/index"
+	"time"
+)
+
+// Config encapsulates the configuration options for the search API server.
+type Config struct {
+	// Indexer is the text indexer that serves the search requests. A
+	// valid indexer instance is required for the config to be valid.
+	Indexer index.Indexer
+
+	// RequestTimeout bounds the time spent on processing a single
+	// request, including all calls to the indexer. If not specified, a
+	// default value of 5 seconds will be used.
+	RequestTimeout time.Duration
+
+	// MaxPageSize is the largest page size that clients may request. If
+	// not specified, a default value of 100 will be used.
+	MaxPageSize int
+
+	// MaxRequestBytes is the maximum size of a request body. If not
+	// specified, a default value of 64KiB will be used.
+	MaxRequestBytes int64
+}
+
+// validate checks whether a server configuration is valid and sets the
+// default values where required.
+func (cfg *Config) validate() error {
+	var err error
+	if cfg.Indexer == nil {
+		err = multierror.Append(err, xerrors.New("indexer not specified"))
+	}
+	if cfg.RequestTimeout < 0 {
+		err = multierror.Append(err, xerrors.New("request timeout must not be negative"))
+	} else if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = 5 * time.Second
+	}
+	if cfg.MaxPageSize <= 0 {
+		cfg.MaxPageSize = 100
+	}
+	if cfg.MaxRequestBytes <= 0 {
+		cfg.MaxRequestBytes = 64 << 10
+	}
+
+	return err
+}
@@ -0,0 +1,183 @@
+package searchapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"net/http"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// documentsPath is the path prefix of the document lookup endpoint.
+const documentsPath = "/documents/"
+
+// Server exposes an index.Indexer over a JSON HTTP API with the following
+// endpoints:
+//
+//	POST /search            searches the index; see SearchRequest
+//	GET  /documents/{id}    looks up the document with the specified link ID
+//
+// Failed requests are answered with an ErrorResponse.
+type Server struct {
+	cfg Config
+	mux *http.ServeMux
+}
+
+// NewServer creates a new search API server using the provided config.
+func NewServer(cfg Config) (*Server, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, xerrors.Errorf("search API: config validation failed: %w", err)
+	}
+
+	s := &Server{cfg: cfg, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/search", s.handleSearch)
+	s.mux.HandleFunc(documentsPath, s.handleLookup)
+	return s, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req SearchRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.cfg.MaxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("malformed request body: %v", err))
+		return
+	}
+	q, err := s.makeQuery(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.RequestTimeout)
+	defer cancel()
+	res, err := s.search(ctx, q)
+	if err != nil {
+		writeIndexerError(ctx, w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// makeQuery validates req and converts it into an index.Query.
+func (s *Server) makeQuery(req SearchRequest) (index.Query, error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return index.Query{}, xerrors.New("query must not be empty")
+	}
+	queryType, known := queryTypes[req.Type]
+	if !known {
+		return index.Query{}, xerrors.Errorf("unsupported query type %q", req.Type)
+	}
+	if req.PageSize < 0 || req.PageSize > s.cfg.MaxPageSize {
+		return index.Query{}, xerrors.Errorf("page size must be between 1 and %d", s.cfg.MaxPageSize)
+	}
+	if req.Cursor != "" && req.Offset != 0 {
+		return index.Query{}, xerrors.New("offset and cursor cannot be combined")
+	}
+	if w := req.VectorWeight; w != nil && (*w < 0 || *w > 1) {
+		return index.Query{}, xerrors.New("vector weight must be between 0 and 1")
+	}
+
+	return index.Query{
+		Type:         queryType,
+		Expression:   req.Query,
+		Offset:       req.Offset,
+		PageSize:     req.PageSize,
+		Cursor:       req.Cursor,
+		VectorWeight: req.VectorWeight,
+	}, nil
+}
+
+// search runs q and collects a single page of results.
+func (s *Server) search(ctx context.Context, q index.Query) (*SearchResponse, error) {
+	it, err := s.cfg.Indexer.Search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = it.Close() }()
+
+	pageSize := q.PageSizeOrDefault()
+	res := &SearchResponse{Results: make([]Document, 0, pageSize)}
+	for len(res.Results) < pageSize && it.Next() {
+		res.Results = append(res.Results, makeDocument(it.Document(), false))
+		if len(res.Results) == pageSize {
+			res.NextCursor = it.Cursor()
+		}
+	}
+	if err = it.Error(); err != nil {
+		return nil, err
+	}
+	res.TotalCount = it.TotalCount()
+
+	// Avoid handing out a cursor that points past the last result when
+	// the total count tells us that there is nothing left to fetch.
+	if q.Cursor == "" && q.Offset+uint64(len(res.Results)) >= res.TotalCount {
+		res.NextCursor = ""
+	}
+	return res, nil
+}
+
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	linkID, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, documentsPath))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid link ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.RequestTimeout)
+	defer cancel()
+	doc, err := s.cfg.Indexer.FindByID(ctx, linkID)
+	if err != nil {
+		writeIndexerError(ctx, w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, makeDocument(doc, true))
+}
+
+// writeIndexerError maps an error returned by the indexer to the
+// appropriate error response.
+func writeIndexerError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case xerrors.Is(err, index.ErrNotFound):
+		writeError(w, http.StatusNotFound, CodeNotFound, "document not found")
+	case xerrors.Is(err, index.ErrInvalidQuery), xerrors.Is(err, index.ErrInvalidCursor):
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	case xerrors.Is(err, context.DeadlineExceeded), ctx.Err() == context.DeadlineExceeded:
+		writeError(w, http.StatusGatewayTimeout, CodeTimeout, "request timed out")
+	default:
+		// Do not leak internal error details to clients.
+		writeError(w, http.StatusInternalServerError, CodeInternal, "internal server error")
+	}
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, fmt.Sprintf("method must be %s", allowed))
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, ErrorResponse{Error: Error{Code: code, Message: msg}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
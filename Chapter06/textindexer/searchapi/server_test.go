@@ -0,0 +1,238 @@
+package searchapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	gc "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/store/memory"
+	"testing"
+	"time"
+)
+
+var _ = gc.Suite(new(ServerTestSuite))
+
+func Test(t *testing.T) { gc.TestingT(t) }
+
+type ServerTestSuite struct {
+	idx *memory.InMemoryBleveIndexer
+	srv *Server
+	ids []uuid.UUID
+}
+
+func (s *ServerTestSuite) SetUpTest(c *gc.C) {
+	idx, err := memory.NewInMemoryBleveIndexer()
+	c.Assert(err, gc.IsNil)
+	s.idx = idx
+
+	s.ids = make([]uuid.UUID, 15)
+	for i := range s.ids {
+		s.ids[i] = uuid.New()
+		c.Assert(idx.Index(context.TODO(), &index.Document{
+			LinkID:  s.ids[i],
+			URL:     fmt.Sprintf("http://example.com/%d", i),
+			Title:   fmt.Sprintf("Gopher page %d", i),
+			Content: "gophers dig tunnels",
+		}), gc.IsNil)
+		// Rank the documents so that they are returned in order.
+		c.Assert(idx.UpdateScore(context.TODO(), s.ids[i], float64(len(s.ids)-i)), gc.IsNil)
+	}
+
+	s.srv, err = NewServer(Config{Indexer: idx, MaxPageSize: 10})
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *ServerTestSuite) TearDownTest(c *gc.C) {
+	c.Assert(s.idx.Close(), gc.IsNil)
+}
+
+func (s *ServerTestSuite) TestInvalidConfig(c *gc.C) {
+	_, err := NewServer(Config{RequestTimeout: -time.Second})
+	c.Assert(err, gc.ErrorMatches, "(?ms).*indexer not specified.*request timeout must not be negative.*")
+}
+
+func (s *ServerTestSuite) TestSearchPagination(c *gc.C) {
+	var res SearchResponse
+	rec := s.do(c, http.MethodPost, "/search", `{"query": "gophers", "page_size": 4}`, &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(res.TotalCount, gc.Equals, uint64(15))
+	c.Assert(resultIDs(res), gc.DeepEquals, s.ids[:4])
+	c.Assert(res.Results[0].URL, gc.Equals, "http://example.com/0")
+	c.Assert(res.Results[0].Content, gc.Equals, "", gc.Commentf("search results should not include the content"))
+	c.Assert(res.NextCursor, gc.Not(gc.Equals), "")
+
+	var got []uuid.UUID
+	for cursor := ""; ; {
+		var page SearchResponse
+		body := fmt.Sprintf(`{"query": "gophers", "page_size": 4, "cursor": %q}`, cursor)
+		rec = s.do(c, http.MethodPost, "/search", body, &page)
+		c.Assert(rec.Code, gc.Equals, http.StatusOK)
+		got = append(got, resultIDs(page)...)
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	c.Assert(got, gc.DeepEquals, s.ids)
+
+	res = SearchResponse{}
+	rec = s.do(c, http.MethodPost, "/search", `{"query": "gophers", "offset": 12}`, &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(resultIDs(res), gc.DeepEquals, s.ids[12:])
+	c.Assert(res.NextCursor, gc.Equals, "")
+}
+
+func (s *ServerTestSuite) TestSearchWithoutMatches(c *gc.C) {
+	var res SearchResponse
+	rec := s.do(c, http.MethodPost, "/search", `{"query": "\"tunnels dig\"", "type": "phrase"}`, &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(res.TotalCount, gc.Equals, uint64(0))
+	c.Assert(res.Results, gc.HasLen, 0)
+}
+
+func (s *ServerTestSuite) TestSearchValidation(c *gc.C) {
+	specs := []struct {
+		body string
+		msg  string
+	}{
+		{body: `{"query": "  "}`, msg: "query must not be empty"},
+		{body: `{"query": "foo", "type": "fuzzy"}`, msg: `unsupported query type "fuzzy"`},
+		{body: `{"query": "foo", "page_size": 11}`, msg: "page size must be between 1 and 10"},
+		{body: `{"query": "foo", "page_size": -1}`, msg: "page size must be between 1 and 10"},
+		{body: `{"query": "foo", "offset": 1, "cursor": "abc"}`, msg: "offset and cursor cannot be combined"},
+		{body: `{"query": "foo", "unknown": true}`, msg: "malformed request body.*"},
+		{body: `{"query": `, msg: "malformed request body.*"},
+		{body: `{"query": "foo", "cursor": "bogus"}`, msg: ".*invalid cursor"},
+		{body: `{"query": "(foo", "type": "advanced"}`, msg: ".*unbalanced opening parenthesis.*"},
+		{body: `{"query": "foo", "vector_weight": 2}`, msg: "vector weight must be between 0 and 1"},
+		{body: `{"query": "foo", "type": "hybrid"}`, msg: ".*hybrid queries require a vector index.*"},
+	}
+	for specIndex, spec := range specs {
+		var res ErrorResponse
+		rec := s.do(c, http.MethodPost, "/search", spec.body, &res)
+		c.Assert(rec.Code, gc.Equals, http.StatusBadRequest, gc.Commentf("spec %d", specIndex))
+		c.Assert(res.Error.Code, gc.Equals, CodeInvalidRequest, gc.Commentf("spec %d", specIndex))
+		c.Assert(res.Error.Message, gc.Matches, spec.msg, gc.Commentf("spec %d", specIndex))
+	}
+}
+
+func (s *ServerTestSuite) TestVectorWeight(c *gc.C) {
+	var req SearchRequest
+	c.Assert(json.Unmarshal([]byte(`{"query": "foo"}`), &req), gc.IsNil)
+	q, err := s.srv.makeQuery(req)
+	c.Assert(err, gc.IsNil)
+	c.Assert(q.VectorWeightOrDefault(), gc.Equals, index.DefaultVectorWeight)
+
+	// An explicit weight of 0 is not replaced by the default.
+	c.Assert(json.Unmarshal([]byte(`{"query": "foo", "vector_weight": 0}`), &req), gc.IsNil)
+	q, err = s.srv.makeQuery(req)
+	c.Assert(err, gc.IsNil)
+	c.Assert(q.VectorWeightOrDefault(), gc.Equals, 0.0)
+}
+
+func (s *ServerTestSuite) TestLookup(c *gc.C) {
+	var doc Document
+	rec := s.do(c, http.MethodGet, "/documents/"+s.ids[3].String(), "", &doc)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(doc.LinkID, gc.Equals, s.ids[3])
+	c.Assert(doc.Title, gc.Equals, "Gopher page 3")
+	c.Assert(doc.Content, gc.Equals, "gophers dig tunnels")
+	c.Assert(doc.PageRank, gc.Equals, 12.0)
+
+	var res ErrorResponse
+	rec = s.do(c, http.MethodGet, "/documents/"+uuid.New().String(), "", &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusNotFound)
+	c.Assert(res.Error.Code, gc.Equals, CodeNotFound)
+
+	rec = s.do(c, http.MethodGet, "/documents/not-a-uuid", "", &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusBadRequest)
+	c.Assert(res.Error.Code, gc.Equals, CodeInvalidRequest)
+}
+
+func (s *ServerTestSuite) TestMethodNotAllowed(c *gc.C) {
+	var res ErrorResponse
+	rec := s.do(c, http.MethodGet, "/search", "", &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusMethodNotAllowed)
+	c.Assert(rec.Header().Get("Allow"), gc.Equals, http.MethodPost)
+	c.Assert(res.Error.Code, gc.Equals, CodeMethodNotAllowed)
+
+	rec = s.do(c, http.MethodDelete, "/documents/"+s.ids[0].String(), "", &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusMethodNotAllowed)
+	c.Assert(rec.Header().Get("Allow"), gc.Equals, http.MethodGet)
+}
+
+func (s *ServerTestSuite) TestTimeout(c *gc.C) {
+	srv, err := NewServer(Config{
+		Indexer:        blockingIndexer{Indexer: s.idx},
+		RequestTimeout: 10 * time.Millisecond,
+	})
+	c.Assert(err, gc.IsNil)
+	s.srv = srv
+
+	var res ErrorResponse
+	rec := s.do(c, http.MethodPost, "/search", `{"query": "gophers"}`, &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusGatewayTimeout)
+	c.Assert(res.Error.Code, gc.Equals, CodeTimeout)
+
+	rec = s.do(c, http.MethodGet, "/documents/"+s.ids[0].String(), "", &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusGatewayTimeout)
+	c.Assert(res.Error.Code, gc.Equals, CodeTimeout)
+}
+
+func (s *ServerTestSuite) TestInternalError(c *gc.C) {
+	srv, err := NewServer(Config{Indexer: failingIndexer{Indexer: s.idx}})
+	c.Assert(err, gc.IsNil)
+	s.srv = srv
+
+	var res ErrorResponse
+	rec := s.do(c, http.MethodPost, "/search", `{"query": "gophers"}`, &res)
+	c.Assert(rec.Code, gc.Equals, http.StatusInternalServerError)
+	c.Assert(res.Error, gc.DeepEquals, Error{Code: CodeInternal, Message: "internal server error"})
+}
+
+// do sends a request to the server under test and decodes the JSON response
+// into res.
+func (s *ServerTestSuite) do(c *gc.C, method, path, body string, res interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	s.srv.ServeHTTP(rec, req)
+	c.Assert(rec.Header().Get("Content-Type"), gc.Equals, "application/json")
+	c.Assert(json.NewDecoder(rec.Body).Decode(res), gc.IsNil)
+	return rec
+}
+
+func resultIDs(res SearchResponse) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, doc := range res.Results {
+		ids = append(ids, doc.LinkID)
+	}
+	return ids
+}
+
+// blockingIndexer blocks until the context of each lookup or search expires.
+type blockingIndexer struct {
+	index.Indexer
+}
+
+func (i blockingIndexer) FindByID(ctx context.Context, _ uuid.UUID) (*index.Document, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (i blockingIndexer) Search(ctx context.Context, _ index.Query) (index.Iterator, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// failingIndexer fails all searches.
+type failingIndexer struct {
+	index.Indexer
+}
+
+func (i failingIndexer) Search(context.Context, index.Query) (index.Iterator, error) {
+	return nil, fmt.Errorf("connection refused")
+}
@@ -0,0 +1,159 @@
+package bleveutil
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	_ "github.com/blevesearch/bleve/analysis/lang/da"
+	_ "github.com/blevesearch/bleve/analysis/lang/de"
+	_ "github.com/blevesearch/bleve/analysis/lang/en"
+	_ "github.com/blevesearch/bleve/analysis/lang/es"
+	_ "github.com/blevesearch/bleve/analysis/lang/fi"
+	_ "github.com/blevesearch/bleve/analysis/lang/fr"
+	_ "github.com/blevesearch/bleve/analysis/lang/hu"
+	_ "github.com/blevesearch/bleve/analysis/lang/it"
+	_ "github.com/blevesearch/bleve/analysis/lang/nl"
+	_ "github.com/blevesearch/bleve/analysis/lang/no"
+	_ "github.com/blevesearch/bleve/analysis/lang/ro"
+	_ "github.com/blevesearch/bleve/analysis/lang/ru"
+	_ "github.com/blevesearch/bleve/analysis/lang/sv"
+	_ "github.com/blevesearch/bleve/analysis/lang/tr"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/token/stop"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/analysis/tokenmap"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// SynonymFilterName is the name of the token filter that expands terms with
+// their synonyms. The filter expects a "synonyms" list of comma-separated
+// groups of equivalent terms.
+const SynonymFilterName = "textindexer_synonyms"
+
+// textAnalyzerName is the name of the analyzer that is added to the index
+// mapping for a custom analysis configuration. The analyzers for the
+// supported languages are named "<textAnalyzerName>_<language>".
+const textAnalyzerName = "textindexer"
+
+// synonymsConfigKey is the key of the synonym rules in the configuration of
+// the synonym filter.
+const synonymsConfigKey = "synonyms"
+
+func init() {
+	registry.RegisterTokenFilter(SynonymFilterName, newSynonymFilter)
+}
+
+// addAnalyzer registers an analyzer for cfg with m under the specified name.
+// The token filters and maps that the analyzer depends on are registered
+// using name as a prefix.
+func addAnalyzer(m *mapping.IndexMappingImpl, name string, cfg index.AnalysisConfig) error {
+	var (
+		filters          = []interface{}{lowercase.Name}
+		stopWordsMapName = name + "_stop_words"
+		stopWordsName    = name + "_stop"
+		synonymsName     = name + "_synonym_groups"
+	)
+
+	switch {
+	case cfg.RemoveStopWords && len(cfg.StopWords) != 0:
+		tokens := make([]interface{}, 0, len(cfg.StopWords))
+		for _, word := range cfg.LowercaseStopWords() {
+			tokens = append(tokens, word)
+		}
+		if err := m.AddCustomTokenMap(stopWordsMapName, map[string]interface{}{
+			"type":   tokenmap.Name,
+			"tokens": tokens,
+		}); err != nil {
+			return err
+		}
+		if err := m.AddCustomTokenFilter(stopWordsName, map[string]interface{}{
+			"type":           stop.Name,
+			"stop_token_map": stopWordsMapName,
+		}); err != nil {
+			return err
+		}
+		filters = append(filters, stopWordsName)
+	case cfg.RemoveStopWords:
+		filters = append(filters, "stop_"+cfg.Language)
+	}
+
+	if len(cfg.Synonyms) != 0 {
+		rules := make([]interface{}, 0, len(cfg.Synonyms))
+		for _, rule := range cfg.SynonymRules() {
+			rules = append(rules, rule)
+		}
+		if err := m.AddCustomTokenFilter(synonymsName, map[string]interface{}{
+			"type":            SynonymFilterName,
+			synonymsConfigKey: rules,
+		}); err != nil {
+			return err
+		}
+		filters = append(filters, synonymsName)
+	}
+
+	if cfg.Stemming {
+		filters = append(filters, "stemmer_"+cfg.Language+"_snowball")
+	}
+
+	return m.AddCustomAnalyzer(name, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": filters,
+	})
+}
+
+// synonymFilter emits the synonyms of each term at the same position as the
+// term itself so that phrase queries continue to work.
+type synonymFilter struct {
+	synonyms map[string][]string
+}
+
+func newSynonymFilter(config map[string]interface{}, _ *registry.Cache) (analysis.TokenFilter, error) {
+	rules, ok := config[synonymsConfigKey].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must specify %s", synonymsConfigKey)
+	}
+
+	f := &synonymFilter{synonyms: make(map[string][]string)}
+	for _, rule := range rules {
+		ruleStr, ok := rule.(string)
+		if !ok {
+			return nil, fmt.Errorf("synonym rule %v is not a string", rule)
+		}
+		var terms []string
+		for _, term := range strings.Split(ruleStr, ",") {
+			if term = strings.ToLower(strings.TrimSpace(term)); term != "" {
+				terms = append(terms, term)
+			}
+		}
+		for _, term := range terms {
+			for _, synonym := range terms {
+				if synonym != term {
+					f.synonyms[term] = append(f.synonyms[term], synonym)
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+// Filter implements analysis.TokenFilter.
+func (f *synonymFilter) Filter(input analysis.TokenStream) analysis.TokenStream {
+	output := make(analysis.TokenStream, 0, len(input))
+	for _, tok := range input {
+		output = append(output, tok)
+		for _, synonym := range f.synonyms[string(tok.Term)] {
+			output = append(output, &analysis.Token{
+				Start:    tok.Start,
+				End:      tok.End,
+				Term:     []byte(synonym),
+				Position: tok.Position,
+				Type:     tok.Type,
+			})
+		}
+	}
+	return output
+}
@@ -0,0 +1,288 @@
+package bleveutil
+
+import (
+	"context"
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/google/uuid"
+	"math"
+	"test_project/Chapter06/textindexer/index"
+)
+
+const (
+	// The name of the facet that counts the matching documents per host.
+	collapseHostsFacet = "collapseHosts"
+
+	// The number of hits to fetch per request when scanning the results
+	// for host groups.
+	groupScanSize = 100
+)
+
+// Collapser iterates the results of a search request grouped by URL host,
+// mirroring the semantics of elasticsearch's field collapsing. Host groups
+// are discovered by scanning the matching documents in SortOrder; the top
+// documents of each group are then fetched by a separate request that is
+// restricted to the group's host.
+//
+// The cursors returned by a Collapser include the position of the leading
+// document of the current group so that subsequent pages resume the scan at
+// that document instead of scanning all preceding groups again.
+type Collapser struct {
+	ctx        context.Context
+	idx        bleve.Index
+	searchReq  *bleve.SearchRequest
+	maxPerHost int
+
+	// The state of the scan for host groups.
+	scanReq *bleve.SearchRequest
+	scanRes *bleve.SearchResult
+	scanIdx int
+	seen    map[string]struct{}
+
+	// resumed is set if the scan started at the leading document of the
+	// group of a cursor. The hosts of the preceding groups were not seen
+	// by the scan; a host only starts a new group at its first document.
+	resumed bool
+
+	hostCounts map[string]uint64
+	facets     search.FacetResults
+
+	// The current group, its position and the number of its hits that
+	// were returned so far.
+	group     uint64
+	loaded    bool
+	groupHost string
+	groupLead *search.DocumentMatch
+	groupHits search.DocumentMatchCollection
+	hitIdx    int
+
+	lastErr error
+}
+
+// NewCollapser prepares the collapsed iteration of the documents matching
+// searchReq according to the collapse options, offset and cursor of q. The
+// facets requested by searchReq are calculated over all matching documents
+// while its remaining settings (e.g. stored fields) apply to the requests
+// that fetch the documents of each group.
+func NewCollapser(ctx context.Context, idx bleve.Index, searchReq *bleve.SearchRequest, q index.Query) (*Collapser, error) {
+	start := index.GroupCursor{Group: q.Offset}
+	if q.Cursor != "" {
+		var err error
+		if start, err = index.DecodeGroupCursor(q.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	countReq := bleve.NewSearchRequest(searchReq.Query)
+	countReq.Size = 0
+	countReq.Facets = make(bleve.FacetsRequest, len(searchReq.Facets)+1)
+	for name, facet := range searchReq.Facets {
+		countReq.Facets[name] = facet
+	}
+	countReq.AddFacet(collapseHostsFacet, bleve.NewFacetRequest("Host", math.MaxInt32))
+	rs, err := idx.SearchInContext(ctx, countReq)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Collapser{
+		ctx:        ctx,
+		idx:        idx,
+		searchReq:  searchReq,
+		maxPerHost: q.Collapse.WithDefaults().MaxPerHost,
+		scanReq:    bleve.NewSearchRequestOptions(searchReq.Query, groupScanSize, 0, false),
+		seen:       make(map[string]struct{}),
+		hostCounts: make(map[string]uint64),
+		facets:     rs.Facets,
+	}
+	c.scanReq.SortBy(SortOrder)
+	c.scanReq.Fields = []string{"Host"}
+	if hosts := rs.Facets[collapseHostsFacet]; hosts != nil {
+		for _, term := range hosts.Terms {
+			c.hostCounts[term.Term] = uint64(term.Count)
+		}
+		delete(rs.Facets, collapseHostsFacet)
+	}
+
+	if start.Lead != nil {
+		resumed, err := c.resume(start)
+		if err != nil {
+			return nil, err
+		} else if resumed {
+			return c, nil
+		}
+	}
+
+	// Skip the groups that precede the starting position.
+	for c.group = 0; c.group < start.Group; c.group++ {
+		if _, found := c.nextLead(); !found {
+			break
+		}
+	}
+	if c.lastErr != nil {
+		return nil, c.lastErr
+	}
+	c.hitIdx = int(start.Hit)
+	return c, nil
+}
+
+// resume positions the collapser at the group whose leading document is
+// identified by start.Lead and continues the scan for host groups after that
+// document. It returns false if the leading document no longer exists, in
+// which case the groups that precede the starting position must be skipped.
+func (c *Collapser) resume(start index.GroupCursor) (bool, error) {
+	leadID := start.Lead.LinkID.String()
+	leadReq := bleve.NewSearchRequest(bleve.NewDocIDQuery([]string{leadID}))
+	leadReq.Fields = []string{"Host"}
+	rs, err := c.idx.SearchInContext(c.ctx, leadReq)
+	if err != nil {
+		return false, err
+	} else if len(rs.Hits) == 0 {
+		return false, nil
+	}
+
+	host, _ := rs.Hits[0].Fields["Host"].(string)
+	hits, err := c.fetchGroup(host)
+	if err != nil {
+		return false, err
+	}
+	c.seen[host] = struct{}{}
+	c.resumed = true
+	c.group, c.hitIdx = start.Group, int(start.Hit)
+	c.loaded, c.groupHost, c.groupHits = true, host, hits
+	c.groupLead = &search.DocumentMatch{ID: leadID, Score: start.Lead.Score}
+	c.scanReq.SearchAfter = HitSearchAfter(c.groupLead)
+	return true, nil
+}
+
+// Next advances to the next document. It returns false if no more documents
+// are available or an error occurred.
+func (c *Collapser) Next() bool {
+	for c.lastErr == nil && (!c.loaded || c.hitIdx >= len(c.groupHits)) {
+		if !c.loadNextGroup() {
+			return false
+		}
+	}
+	if c.lastErr != nil {
+		return false
+	}
+	c.hitIdx++
+	return true
+}
+
+// Hit returns the current document.
+func (c *Collapser) Hit() *search.DocumentMatch {
+	return c.groupHits[c.hitIdx-1]
+}
+
+// Collapsed returns the number of documents from the host of the current
+// document that were omitted.
+func (c *Collapser) Collapsed() uint64 {
+	count := c.hostCounts[c.groupHost]
+	if returned := uint64(len(c.groupHits)); count > returned {
+		return count - returned
+	}
+	return 0
+}
+
+// Cursor returns the continuation token for the current document.
+func (c *Collapser) Cursor() string {
+	linkID, _ := uuid.Parse(c.groupLead.ID)
+	return index.GroupCursor{
+		Group: c.group,
+		Hit:   uint32(c.hitIdx),
+		Lead:  &index.Cursor{Score: c.groupLead.Score, LinkID: linkID},
+	}.Encode()
+}
+
+// TotalCount returns the number of host groups.
+func (c *Collapser) TotalCount() uint64 {
+	return uint64(len(c.hostCounts))
+}
+
+// Facets returns the results of the facets requested by the search request.
+func (c *Collapser) Facets() search.FacetResults {
+	return c.facets
+}
+
+// Error returns the last error encountered by the collapser.
+func (c *Collapser) Error() error {
+	return c.lastErr
+}
+
+// loadNextGroup fetches the documents of the next host group.
+func (c *Collapser) loadNextGroup() bool {
+	for {
+		lead, found := c.nextLead()
+		if !found {
+			return false
+		}
+		host, _ := lead.Fields["Host"].(string)
+		hits, err := c.fetchGroup(host)
+		if err != nil {
+			c.lastErr = err
+			return false
+		}
+		if c.resumed && (len(hits) == 0 || hits[0].ID != lead.ID) {
+			// The host belongs to a group that precedes the cursor.
+			continue
+		}
+
+		if c.loaded {
+			c.group++
+			c.hitIdx = 0
+		}
+		c.loaded, c.groupHost, c.groupLead, c.groupHits = true, host, lead, hits
+		return true
+	}
+}
+
+// fetchGroup returns the top documents of the group of host.
+func (c *Collapser) fetchGroup(host string) (search.DocumentMatchCollection, error) {
+	hostQuery := bleve.NewTermQuery(host)
+	hostQuery.SetField("Host")
+	groupReq := *c.searchReq
+	groupReq.Query = query.NewConjunctionQuery([]query.Query{c.searchReq.Query, newConstantScoreQuery(hostQuery, 0)})
+	groupReq.Size = c.maxPerHost
+	groupReq.From = 0
+	groupReq.SearchAfter = nil
+	groupReq.Facets = nil
+	rs, err := c.idx.SearchInContext(c.ctx, &groupReq)
+	if err != nil {
+		return nil, err
+	}
+	return rs.Hits, nil
+}
+
+// nextLead returns the next document in SortOrder whose host has not been
+// seen by the scan.
+func (c *Collapser) nextLead() (*search.DocumentMatch, bool) {
+	for {
+		if c.scanRes == nil || c.scanIdx >= len(c.scanRes.Hits) {
+			if c.scanRes != nil {
+				// A partial page indicates that there are no more
+				// results.
+				if len(c.scanRes.Hits) < c.scanReq.Size {
+					return nil, false
+				}
+				c.scanReq.SearchAfter = HitSearchAfter(c.scanRes.Hits[c.scanIdx-1])
+			}
+			if c.scanRes, c.lastErr = c.idx.SearchInContext(c.ctx, c.scanReq); c.lastErr != nil {
+				return nil, false
+			}
+			c.scanIdx = 0
+			if len(c.scanRes.Hits) == 0 {
+				return nil, false
+			}
+		}
+
+		hit := c.scanRes.Hits[c.scanIdx]
+		c.scanIdx++
+		host, _ := hit.Fields["Host"].(string)
+		if _, seen := c.seen[host]; !seen {
+			c.seen[host] = struct{}{}
+			return hit, true
+		}
+	}
+}
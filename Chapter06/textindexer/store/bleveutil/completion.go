@@ -0,0 +1,62 @@
+package bleveutil
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/token/edgengram"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// titleCompletionFieldName is the name of the field that holds the leading
+// characters of each word of the Title of documents.
+const titleCompletionFieldName = "TitleCompletion"
+
+// The names of the analyzer for the TitleCompletion field and of the edge
+// n-gram token filter that it uses.
+const (
+	completionAnalyzerName = "textindexer_completion"
+	completionFilterName   = "textindexer_completion_edge_ngram"
+)
+
+// addCompletionAnalyzer registers the analyzer for the TitleCompletion field
+// with m.
+func addCompletionAnalyzer(m *mapping.IndexMappingImpl) error {
+	if err := m.AddCustomTokenFilter(completionFilterName, map[string]interface{}{
+		"type": edgengram.Name,
+		"min":  1.0,
+		"max":  float64(index.MaxCompletionWordLength),
+	}); err != nil {
+		return err
+	}
+	return m.AddCustomAnalyzer(completionAnalyzerName, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []interface{}{lowercase.Name, completionFilterName},
+	})
+}
+
+// NewCompletionRequest returns a search request for the candidates for
+// completing prefix, i.e. the documents whose Title contains a word starting
+// with each of the index.CompletionWords of prefix, ordered by descending
+// PageRank. It returns nil if index.CompletionWords yields no words for
+// prefix.
+func NewCompletionRequest(prefix string) *bleve.SearchRequest {
+	words := index.CompletionWords(prefix)
+	if len(words) == 0 {
+		return nil
+	}
+	conjuncts := make([]query.Query, len(words))
+	for i, word := range words {
+		tq := bleve.NewTermQuery(word)
+		tq.SetField(titleCompletionFieldName)
+		conjuncts[i] = tq
+	}
+	searchReq := bleve.NewSearchRequest(bleve.NewConjunctionQuery(conjuncts...))
+	searchReq.SortBy([]string{"-PageRank", "_id"})
+	searchReq.Size = index.MaxCompletionCandidates
+	return searchReq
+}
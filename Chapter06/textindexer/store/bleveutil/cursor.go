@@ -0,0 +1,39 @@
+package bleveutil
+
+import (
+	"github.com/blevesearch/bleve/search"
+	"github.com/google/uuid"
+	"strconv"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// SortOrder is the sort order for search requests whose results are paged
+// using cursors. Hits are ordered by descending score with ties broken by
+// ascending document (link) ID.
+var SortOrder = []string{"-_score", "_id"}
+
+// SearchAfter decodes a cursor token into a search-after key for a request
+// sorted by SortOrder.
+func SearchAfter(token string) ([]string, error) {
+	c, err := index.DecodeCursor(token)
+	if err != nil {
+		return nil, err
+	}
+	return []string{formatScore(c.Score), c.LinkID.String()}, nil
+}
+
+// HitSearchAfter returns the search-after key for fetching the hits that
+// follow hit in a request sorted by SortOrder.
+func HitSearchAfter(hit *search.DocumentMatch) []string {
+	return []string{formatScore(hit.Score), hit.ID}
+}
+
+// HitCursor returns the cursor token for hit.
+func HitCursor(hit *search.DocumentMatch) string {
+	linkID, _ := uuid.Parse(hit.ID)
+	return index.Cursor{Score: hit.Score, LinkID: linkID}.Encode()
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
@@ -0,0 +1,45 @@
+package bleveutil
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"strconv"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// MaxDuplicateCandidates is the maximum number of documents sharing a
+// fingerprint band that are examined when looking for near-duplicates.
+const MaxDuplicateCandidates = 1000
+
+// NewDuplicatesQuery returns a query that matches the documents that share at
+// least one fingerprint band with fp.
+func NewDuplicatesQuery(fp uint64) query.Query {
+	bands := index.FingerprintBands(fp)
+	disjuncts := make([]query.Query, len(bands))
+	for i, band := range bands {
+		tq := bleve.NewTermQuery(band)
+		tq.SetField("FingerprintBands")
+		disjuncts[i] = tq
+	}
+	return query.NewDisjunctionQuery(disjuncts)
+}
+
+// FingerprintBands returns the fingerprint band terms to index for fp or nil
+// if fp is empty.
+func FingerprintBands(fp uint64) []string {
+	if fp == 0 {
+		return nil
+	}
+	return index.FingerprintBands(fp)
+}
+
+// FormatFingerprint encodes fp for storing it in a text field.
+func FormatFingerprint(fp uint64) string {
+	return strconv.FormatUint(fp, 16)
+}
+
+// ParseFingerprint decodes a fingerprint encoded by FormatFingerprint.
+func ParseFingerprint(s string) uint64 {
+	fp, _ := strconv.ParseUint(s, 16, 64)
+	return fp
+}
@@ -0,0 +1,83 @@
+package bleveutil
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+	"sort"
+	"strconv"
+	"test_project/Chapter06/textindexer/index"
+)
+
+const (
+	hostsFacet     = "hosts"
+	indexedAtFacet = "indexedAt"
+	pageRankFacet  = "pageRank"
+)
+
+// AddFacets adds the facet requests described by opts to searchReq. The
+// options must have their defaults applied and the same options must be
+// passed to MapFacets when processing the search results.
+func AddFacets(searchReq *bleve.SearchRequest, opts index.FacetOptions) {
+	// Request an extra host as documents without a URL are indexed with an
+	// empty host that gets filtered out by MapFacets.
+	searchReq.AddFacet(hostsFacet, bleve.NewFacetRequest("Host", opts.HostSize+1))
+
+	dateRanges := opts.DateRanges()
+	dateFacet := bleve.NewFacetRequest("IndexedAtDate", len(dateRanges))
+	for i, r := range dateRanges {
+		dateFacet.AddDateTimeRange(strconv.Itoa(i), r.Start, r.End)
+	}
+	searchReq.AddFacet(indexedAtFacet, dateFacet)
+
+	pageRankFacetReq := bleve.NewFacetRequest("PageRankFacet", len(opts.PageRankRanges))
+	for i, r := range opts.PageRankRanges {
+		min, max := r.Min, r.Max
+		if max == 0 {
+			pageRankFacetReq.AddNumericRange(strconv.Itoa(i), &min, nil)
+			continue
+		}
+		pageRankFacetReq.AddNumericRange(strconv.Itoa(i), &min, &max)
+	}
+	searchReq.AddFacet(pageRankFacet, pageRankFacetReq)
+}
+
+// MapFacets converts the facet results returned by bleve for a search request
+// prepared by AddFacets into an index.Facets instance.
+func MapFacets(res search.FacetResults, opts index.FacetOptions) *index.Facets {
+	facets := &index.Facets{
+		IndexedAt: make([]index.DateCount, 0, opts.DateBuckets),
+		PageRank:  make([]index.PageRankCount, len(opts.PageRankRanges)),
+	}
+
+	if hosts := res[hostsFacet]; hosts != nil {
+		sort.Sort(hosts.Terms)
+		for _, term := range hosts.Terms {
+			if term.Term == "" || len(facets.Hosts) == opts.HostSize {
+				continue
+			}
+			facets.Hosts = append(facets.Hosts, index.HostCount{Host: term.Term, Count: uint64(term.Count)})
+		}
+	}
+
+	dateCounts := make(map[string]uint64)
+	if dates := res[indexedAtFacet]; dates != nil {
+		for _, r := range dates.DateRanges {
+			dateCounts[r.Name] = uint64(r.Count)
+		}
+	}
+	for i, r := range opts.DateRanges() {
+		facets.IndexedAt = append(facets.IndexedAt, index.DateCount{DateRange: r, Count: dateCounts[strconv.Itoa(i)]})
+	}
+
+	pageRankCounts := make(map[string]uint64)
+	if ranges := res[pageRankFacet]; ranges != nil {
+		for _, r := range ranges.NumericRanges {
+			pageRankCounts[r.Name] = uint64(r.Count)
+		}
+	}
+	for i, r := range opts.PageRankRanges {
+		facets.PageRank[i] = index.PageRankCount{PageRankRange: r, Count: pageRankCounts[strconv.Itoa(i)]}
+	}
+
+	return facets
+}
@@ -0,0 +1,89 @@
+// Package bleveutil contains helpers shared by the bleve-backed indexer
+// implementations.
+package bleveutil
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/highlight/format/html"
+	"github.com/blevesearch/bleve/search/highlight/fragmenter/simple"
+	simpleHighlighter "github.com/blevesearch/bleve/search/highlight/highlighter/simple"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// Highlighter generates highlighted fragments for search hits. The search
+// request that produced the hits must have IncludeLocations set.
+type Highlighter struct {
+	idx   bleve.Index
+	hl    *simpleHighlighter.Highlighter
+	count int
+}
+
+// NewHighlighter returns a Highlighter for hits obtained from idx. The
+// highlighted fields must be stored in the index.
+func NewHighlighter(idx bleve.Index, opts index.HighlightOptions) *Highlighter {
+	opts = opts.WithDefaults()
+	return &Highlighter{
+		idx: idx,
+		hl: simpleHighlighter.NewHighlighter(
+			simple.NewFragmenter(opts.FragmentSize),
+			html.NewFragmentFormatter(opts.PreTag, opts.PostTag),
+			"",
+		),
+		count: opts.NumFragments,
+	}
+}
+
+// Highlight returns the highlighted Title and Content fragments for hit.
+func (h *Highlighter) Highlight(hit *search.DocumentMatch) (*index.Highlights, error) {
+	doc, err := h.idx.Document(hit.ID)
+	if err != nil {
+		return nil, err
+	}
+	highlights := new(index.Highlights)
+	if doc == nil {
+		return highlights, nil
+	}
+	highlights.Title = h.bestFragments(hit, doc, "Title")
+	highlights.Content = h.bestFragments(withLocalizedLocations(hit), doc, "Content")
+	return highlights, nil
+}
+
+// withLocalizedLocations returns hit with the term locations of the localized
+// content fields merged into those of the Content field. The localized
+// fields are not stored but share the term offsets of Content.
+func withLocalizedLocations(hit *search.DocumentMatch) *search.DocumentMatch {
+	var localized []search.TermLocationMap
+	for field, locations := range hit.Locations {
+		if strings.HasPrefix(field, localizedContentPrefix) {
+			localized = append(localized, locations)
+		}
+	}
+	if len(localized) == 0 {
+		return hit
+	}
+
+	merged := make(search.TermLocationMap)
+	for _, locations := range append(localized, hit.Locations["Content"]) {
+		for term, termLocations := range locations {
+			merged[term] = append(merged[term], termLocations...)
+		}
+	}
+	hitCopy := *hit
+	hitCopy.Locations = make(search.FieldTermLocationMap, len(hit.Locations))
+	for field, locations := range hit.Locations {
+		hitCopy.Locations[field] = locations
+	}
+	hitCopy.Locations["Content"] = merged
+	return &hitCopy
+}
+
+func (h *Highlighter) bestFragments(hit *search.DocumentMatch, doc *document.Document, field string) []string {
+	// Only highlight fields that actually matched the query.
+	if len(hit.Locations[field]) == 0 {
+		return nil
+	}
+	return h.hl.BestFragmentsInField(hit, doc, field, h.count)
+}
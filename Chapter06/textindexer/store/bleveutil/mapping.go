@@ -0,0 +1,147 @@
+package bleveutil
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/mapping"
+	"golang.org/x/xerrors"
+	"test_project/Chapter06/textindexer/index"
+	"time"
+)
+
+// NewIndexMapping returns the index mapping used by the bleve-backed
+// indexers. URL, Host and FingerprintBands are indexed verbatim, Title and
+// Content are analyzed and stored, IndexedAt and Fingerprint are stored but
+// not indexed and PageRank is indexed as a number. IndexedAtDate holds an
+// indexed (but not stored) copy of IndexedAt that is used for date range
+// filters and PageRankFacet holds an indexed copy of PageRank that is used
+// for faceting. Language is indexed verbatim and stored. The terms of Title
+// and Content are also indexed without any stemming or stop word removal into
+// the Vocabulary field that spelling suggestions are built from, and the
+// leading characters of each word of Title are indexed into TitleCompletion
+// for completing partially typed queries.
+//
+// Title and Content are analyzed according to analysis or using the default
+// bleve analyzer if analysis is the zero value. Additionally, the Content of
+// documents in a supported language is analyzed using the stemmer and stop
+// words of that language into the field returned by LocalizedContentField.
+func NewIndexMapping(analysis index.AnalysisConfig) (mapping.IndexMapping, error) {
+	if err := analysis.Validate(); err != nil {
+		return nil, xerrors.Errorf("invalid analysis config: %w", err)
+	}
+
+	m := bleve.NewIndexMapping()
+	textField := bleve.NewTextFieldMapping()
+	if !analysis.IsZero() {
+		if err := addAnalyzer(m, textAnalyzerName, analysis); err != nil {
+			return nil, xerrors.Errorf("invalid analysis config: %w", err)
+		}
+		textField.Analyzer = textAnalyzerName
+	}
+
+	localizedMapping := bleve.NewDocumentStaticMapping()
+	for _, language := range index.SupportedLanguages() {
+		analyzer := textAnalyzerName + "_" + language
+		if err := addAnalyzer(m, analyzer, analysis.ForLanguage(language)); err != nil {
+			return nil, xerrors.Errorf("invalid analysis config: %w", err)
+		}
+		localizedField := bleve.NewTextFieldMapping()
+		localizedField.Analyzer = analyzer
+		localizedField.Store = false
+		localizedField.IncludeInAll = false
+		localizedMapping.AddFieldMappingsAt(language, localizedField)
+	}
+
+	if err := addAnalyzer(m, vocabularyAnalyzerName, index.AnalysisConfig{}); err != nil {
+		return nil, xerrors.Errorf("invalid analysis config: %w", err)
+	}
+	vocabularyField := bleve.NewTextFieldMapping()
+	vocabularyField.Name = vocabularyFieldName
+	vocabularyField.Analyzer = vocabularyAnalyzerName
+	vocabularyField.Store = false
+	vocabularyField.IncludeInAll = false
+	vocabularyField.IncludeTermVectors = false
+
+	if err := addCompletionAnalyzer(m); err != nil {
+		return nil, xerrors.Errorf("invalid analysis config: %w", err)
+	}
+	titleCompletionField := bleve.NewTextFieldMapping()
+	titleCompletionField.Name = titleCompletionFieldName
+	titleCompletionField.Analyzer = completionAnalyzerName
+	titleCompletionField.Store = false
+	titleCompletionField.IncludeInAll = false
+	titleCompletionField.IncludeTermVectors = false
+
+	keywordField := bleve.NewTextFieldMapping()
+	keywordField.Analyzer = keyword.Name
+	keywordField.IncludeInAll = false
+
+	indexedKeywordField := bleve.NewTextFieldMapping()
+	indexedKeywordField.Analyzer = keyword.Name
+	indexedKeywordField.Store = false
+	indexedKeywordField.IncludeInAll = false
+
+	storedOnlyField := bleve.NewTextFieldMapping()
+	storedOnlyField.Index = false
+	storedOnlyField.IncludeInAll = false
+
+	dateField := bleve.NewDateTimeFieldMapping()
+	dateField.Store = false
+	dateField.IncludeInAll = false
+
+	numericField := bleve.NewNumericFieldMapping()
+	numericField.IncludeInAll = false
+
+	// The scorch index visits the doc values of a field twice when it is
+	// used both for sorting and faceting, which doubles the facet counts.
+	// Facets are therefore calculated over a separate copy of the field.
+	pageRankFacetField := bleve.NewNumericFieldMapping()
+	pageRankFacetField.Name = "PageRankFacet"
+	pageRankFacetField.Store = false
+	pageRankFacetField.IncludeInAll = false
+
+	docMapping := bleve.NewDocumentStaticMapping()
+	docMapping.AddFieldMappingsAt("URL", keywordField)
+	docMapping.AddFieldMappingsAt("Host", keywordField)
+	docMapping.AddFieldMappingsAt("Title", textField, vocabularyField, titleCompletionField)
+	docMapping.AddFieldMappingsAt("Content", textField, vocabularyField)
+	docMapping.AddFieldMappingsAt("IndexedAt", storedOnlyField)
+	docMapping.AddFieldMappingsAt("IndexedAtDate", dateField)
+	docMapping.AddFieldMappingsAt("Fingerprint", storedOnlyField)
+	docMapping.AddFieldMappingsAt("FingerprintBands", indexedKeywordField)
+	docMapping.AddFieldMappingsAt("PageRank", numericField, pageRankFacetField)
+	docMapping.AddFieldMappingsAt("Language", keywordField)
+	docMapping.AddSubDocumentMapping("LocalizedContent", localizedMapping)
+
+	m.DefaultMapping = docMapping
+	return m, nil
+}
+
+// LocalizedContentField returns the name of the field holding the Content of
+// documents in the specified supported language.
+func LocalizedContentField(language string) string {
+	return localizedContentPrefix + language
+}
+
+// localizedContentPrefix is the common prefix of the localized content
+// fields.
+const localizedContentPrefix = "LocalizedContent."
+
+// LocalizedContent returns the value of the LocalizedContent field for doc or
+// nil if the language of doc is not supported.
+func LocalizedContent(doc *index.Document) map[string]string {
+	if index.LanguageName(doc.Language) == "" {
+		return nil
+	}
+	return map[string]string{doc.Language: doc.Content}
+}
+
+// DateField returns a value for t that can be assigned to a datetime field of
+// an indexed document. As bleve cannot index the zero time, DateField returns
+// nil if t is zero so that the field is omitted.
+func DateField(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
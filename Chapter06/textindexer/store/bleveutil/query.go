@@ -0,0 +1,193 @@
+package bleveutil
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"golang.org/x/xerrors"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+	"time"
+)
+
+// NewQuery translates q into the equivalent bleve query. Documents must be
+// indexed using the mapping returned by NewIndexMapping.
+//
+// The scores of the matching documents are calculated according to the
+// ranking specified by the query; filters do not affect the scores.
+func NewQuery(q index.Query) (query.Query, error) {
+	ranking := q.RankingOrDefault()
+	t := queryTranslator{titleBoost: ranking.EffectiveTitleBoost()}
+	if index.LanguageName(q.Filters.Language) != "" {
+		t.language = q.Filters.Language
+	}
+	bq, err := t.matchQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	if filters := newFilterQueries(q.Filters); len(filters) != 0 {
+		clauses := []query.Query{bq}
+		for _, filter := range filters {
+			clauses = append(clauses, newConstantScoreQuery(filter, 0))
+		}
+		bq = query.NewConjunctionQuery(clauses)
+	}
+	return newRankingQuery(bq, ranking, time.Now()), nil
+}
+
+// queryTranslator converts index.Query instances into bleve queries.
+type queryTranslator struct {
+	titleBoost float64
+
+	// language, when set, restricts content matches to the localized
+	// content field of that language. Otherwise, the plain Content field
+	// and the localized content fields of all languages are searched.
+	language string
+}
+
+func (t queryTranslator) matchQuery(q index.Query) (query.Query, error) {
+	switch q.Type {
+	case index.QueryTypePhrase:
+		return t.phraseQuery(index.FieldAny, q.Expression), nil
+	case index.QueryTypeAdvanced:
+		root, err := index.ParseQuery(q.Expression)
+		if err != nil {
+			return nil, xerrors.Errorf("parse query: %w", err)
+		}
+		return t.translateNode(root), nil
+	case index.QueryTypeHybrid:
+		return nil, xerrors.Errorf("hybrid queries require a vector index: %w", index.ErrInvalidQuery)
+	default:
+		if strings.TrimSpace(q.Expression) == "" {
+			return bleve.NewMatchAllQuery(), nil
+		}
+		return t.termQuery(index.FieldAny, q.Expression, query.MatchQueryOperatorOr), nil
+	}
+}
+
+func (t queryTranslator) translateNode(n index.QueryNode) query.Query {
+	switch n := n.(type) {
+	case *index.TermNode:
+		if n.Field == index.FieldSite {
+			return siteQuery(n.Text)
+		}
+		return t.termQuery(n.Field, n.Text, query.MatchQueryOperatorAnd)
+	case *index.PhraseNode:
+		return t.phraseQuery(n.Field, n.Phrase)
+	case *index.AndNode:
+		var must, mustNot []query.Query
+		for _, child := range n.Children {
+			if not, isNot := child.(*index.NotNode); isNot {
+				mustNot = append(mustNot, t.translateNode(not.Child))
+				continue
+			}
+			must = append(must, t.translateNode(child))
+		}
+		return query.NewBooleanQuery(must, nil, mustNot)
+	case *index.OrNode:
+		disjuncts := make([]query.Query, len(n.Children))
+		for i, child := range n.Children {
+			disjuncts[i] = t.translateNode(child)
+		}
+		return query.NewDisjunctionQuery(disjuncts)
+	case *index.NotNode:
+		// A boolean query with only must-not clauses matches all
+		// documents except the excluded ones.
+		return query.NewBooleanQuery(nil, nil, []query.Query{t.translateNode(n.Child)})
+	default:
+		return bleve.NewMatchNoneQuery()
+	}
+}
+
+func (t queryTranslator) termQuery(field index.Field, text string, op query.MatchQueryOperator) query.Query {
+	return t.fieldsQuery(field, func(name string, boost float64) query.Query {
+		mq := bleve.NewMatchQuery(text)
+		mq.SetField(name)
+		mq.SetOperator(op)
+		mq.SetBoost(boost)
+		return mq
+	})
+}
+
+func (t queryTranslator) phraseQuery(field index.Field, phrase string) query.Query {
+	return t.fieldsQuery(field, func(name string, boost float64) query.Query {
+		pq := bleve.NewMatchPhraseQuery(phrase)
+		pq.SetField(name)
+		pq.SetBoost(boost)
+		return pq
+	})
+}
+
+// fieldsQuery uses newQuery to build a query for each text field that is
+// covered by field and returns their disjunction.
+func (t queryTranslator) fieldsQuery(field index.Field, newQuery func(name string, boost float64) query.Query) query.Query {
+	titleQuery := newQuery("Title", t.titleBoost)
+	if field == index.FieldTitle {
+		return titleQuery
+	}
+	if t.language != "" {
+		return query.NewDisjunctionQuery([]query.Query{titleQuery, newQuery(LocalizedContentField(t.language), 1)})
+	}
+
+	// A document has at most one localized content field, so the
+	// disjunction of the localized queries always scales the score of a
+	// match by 1/len(languages); undo that so that it counts as much as a
+	// match on any other field.
+	languages := index.SupportedLanguages()
+	localized := make([]query.Query, len(languages))
+	for i, language := range languages {
+		localized[i] = newQuery(LocalizedContentField(language), 1)
+	}
+	return query.NewDisjunctionQuery([]query.Query{
+		titleQuery,
+		newQuery("Content", 1),
+		newScaledQuery(query.NewDisjunctionQuery(localized), float64(len(localized))),
+	})
+}
+
+func newFilterQueries(f index.Filters) []query.Query {
+	var filters []query.Query
+	if f.Host != "" {
+		filters = append(filters, siteQuery(f.Host))
+	}
+	if f.URLPrefix != "" {
+		pq := bleve.NewPrefixQuery(f.URLPrefix)
+		pq.SetField("URL")
+		filters = append(filters, pq)
+	}
+	if !f.IndexedSince.IsZero() || !f.IndexedBefore.IsZero() {
+		inclusive, exclusive := true, false
+		dq := bleve.NewDateRangeInclusiveQuery(f.IndexedSince, f.IndexedBefore, &inclusive, &exclusive)
+		dq.SetField("IndexedAtDate")
+		filters = append(filters, dq)
+	}
+	if f.MinPageRank > 0 {
+		inclusive := true
+		nq := bleve.NewNumericRangeInclusiveQuery(&f.MinPageRank, nil, &inclusive, nil)
+		nq.SetField("PageRank")
+		filters = append(filters, nq)
+	}
+	if f.Language != "" {
+		lq := bleve.NewTermQuery(f.Language)
+		lq.SetField("Language")
+		filters = append(filters, lq)
+	}
+	if len(f.LinkIDs) != 0 {
+		ids := make([]string, len(f.LinkIDs))
+		for i, linkID := range f.LinkIDs {
+			ids[i] = linkID.String()
+		}
+		filters = append(filters, query.NewDocIDQuery(ids))
+	}
+	return filters
+}
+
+// siteQuery matches documents whose host is either host or one of its
+// subdomains.
+func siteQuery(host string) query.Query {
+	host = strings.ToLower(host)
+	exact := bleve.NewTermQuery(host)
+	exact.SetField("Host")
+	subdomains := bleve.NewWildcardQuery("*." + host)
+	subdomains.SetField("Host")
+	return query.NewDisjunctionQuery([]query.Query{exact, subdomains})
+}
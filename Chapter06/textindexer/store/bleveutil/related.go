@@ -0,0 +1,113 @@
+package bleveutil
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"math"
+	"sort"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// relatedTerm is a term of a document that is a candidate for a
+// more-like-this query.
+type relatedTerm struct {
+	field  string
+	term   string
+	weight float64
+}
+
+// NewRelatedQuery returns a query that matches the documents that share the
+// most characteristic terms of the Title and Content of doc, excluding doc
+// itself, or nil if doc has no terms that other documents could share. If
+// external is set, doc is not stored in idx and is added to the document
+// count and the document frequencies of its terms.
+//
+// bleve does not provide a more-like-this query; the term frequency vectors
+// of the fields of doc are obtained by analyzing their contents and the
+// terms are selected the same way as by elasticsearch, using the parameters
+// defined by the index package and the classic TF-IDF weight
+// tf * (1 + log(numDocs / (docFreq + 1))).
+func NewRelatedQuery(idx bleve.Index, doc *index.Document, external bool) (query.Query, error) {
+	numDocs, err := idx.DocCount()
+	if err != nil {
+		return nil, err
+	}
+	var extraDocs uint64
+	if external {
+		extraDocs = 1
+	}
+	numDocs += extraDocs
+
+	var (
+		m     = idx.Mapping()
+		terms []relatedTerm
+	)
+	for _, field := range []struct{ name, text string }{{"Title", doc.Title}, {"Content", doc.Content}} {
+		analyzer := m.AnalyzerNamed(m.AnalyzerNameForPath(field.name))
+		if analyzer == nil {
+			continue
+		}
+		freqs := make(map[string]int)
+		for _, tok := range analyzer.Analyze([]byte(field.text)) {
+			freqs[string(tok.Term)]++
+		}
+		for term, tf := range freqs {
+			if tf < index.RelatedMinTermFreq {
+				continue
+			}
+			df, err := docFreq(idx, field.name, term)
+			if err != nil {
+				return nil, err
+			}
+			if df += extraDocs; df < index.RelatedMinDocFreq {
+				continue
+			}
+			idf := 1 + math.Log(float64(numDocs)/float64(df+1))
+			terms = append(terms, relatedTerm{field: field.name, term: term, weight: float64(tf) * idf})
+		}
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].weight != terms[j].weight {
+			return terms[i].weight > terms[j].weight
+		}
+		if terms[i].field != terms[j].field {
+			return terms[i].field < terms[j].field
+		}
+		return terms[i].term < terms[j].term
+	})
+	if len(terms) > index.RelatedMaxQueryTerms {
+		terms = terms[:index.RelatedMaxQueryTerms]
+	}
+
+	disjuncts := make([]query.Query, len(terms))
+	for i, t := range terms {
+		tq := bleve.NewTermQuery(t.term)
+		tq.SetField(t.field)
+		disjuncts[i] = tq
+	}
+	dq := bleve.NewDisjunctionQuery(disjuncts...)
+	dq.SetMin(float64(index.RelatedMinShouldMatch(len(terms))))
+
+	bq := bleve.NewBooleanQuery()
+	bq.AddMust(dq)
+	bq.AddMustNot(bleve.NewDocIDQuery([]string{doc.LinkID.String()}))
+	return bq, nil
+}
+
+// docFreq returns the number of documents containing term in field.
+func docFreq(idx bleve.Index, field, term string) (uint64, error) {
+	dict, err := idx.FieldDictRange(field, []byte(term), []byte(term))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = dict.Close() }()
+	entry, err := dict.Next()
+	if err != nil || entry == nil {
+		return 0, err
+	}
+	return entry.Count, nil
+}
@@ -0,0 +1,162 @@
+package bleveutil
+
+import (
+	bleveIndex "github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/numeric"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+	"test_project/Chapter06/textindexer/index"
+	"time"
+)
+
+// scoreFunc updates the score of a document matched by a searcher.
+type scoreFunc func(dm *search.DocumentMatch) error
+
+// rescoringQuery wraps a query and passes each match produced by the wrapped
+// query's searcher through a scoreFunc.
+type rescoringQuery struct {
+	inner query.Query
+
+	// newScoreFunc returns the scoreFunc to use with a particular index
+	// reader.
+	newScoreFunc func(r bleveIndex.IndexReader) (scoreFunc, error)
+
+	// constWeight, when set, makes the searcher report a zero weight so
+	// that the wrapped query does not influence the query norm.
+	constWeight bool
+}
+
+// newConstantScoreQuery returns a query that matches the same documents as q
+// but assigns them a fixed score.
+func newConstantScoreQuery(q query.Query, score float64) query.Query {
+	return &rescoringQuery{
+		inner: q,
+		newScoreFunc: func(bleveIndex.IndexReader) (scoreFunc, error) {
+			return func(dm *search.DocumentMatch) error {
+				dm.Score = score
+				return nil
+			}, nil
+		},
+		constWeight: true,
+	}
+}
+
+// newScaledQuery returns a query that matches the same documents as q but
+// multiplies their scores by factor.
+func newScaledQuery(q query.Query, factor float64) query.Query {
+	return &rescoringQuery{
+		inner: q,
+		newScoreFunc: func(bleveIndex.IndexReader) (scoreFunc, error) {
+			return func(dm *search.DocumentMatch) error {
+				dm.Score *= factor
+				return nil
+			}, nil
+		},
+	}
+}
+
+// newRankingQuery returns a query that matches the same documents as q and
+// scores them according to ranking, using the score calculated by q as the
+// text relevance score and now as the reference time for freshness.
+func newRankingQuery(q query.Query, ranking index.Ranking, now time.Time) query.Query {
+	return &rescoringQuery{
+		inner: q,
+		newScoreFunc: func(r bleveIndex.IndexReader) (scoreFunc, error) {
+			dvReader, err := r.DocValueReader([]string{"PageRank", "IndexedAtDate"})
+			if err != nil {
+				return nil, err
+			}
+
+			return func(dm *search.DocumentMatch) error {
+				var (
+					pageRank  float64
+					indexedAt time.Time
+				)
+				err := dvReader.VisitDocValues(dm.IndexInternalID, func(field string, term []byte) {
+					// Numeric and date fields are indexed using multiple
+					// precisions; only the full precision value is needed.
+					prefixCoded := numeric.PrefixCoded(term)
+					if shift, err := prefixCoded.Shift(); err != nil || shift != 0 {
+						return
+					}
+					i64, err := prefixCoded.Int64()
+					if err != nil {
+						return
+					}
+					switch field {
+					case "PageRank":
+						pageRank = numeric.Int64ToFloat64(i64)
+					case "IndexedAtDate":
+						indexedAt = time.Unix(0, i64)
+					}
+				})
+				if err != nil {
+					return err
+				}
+
+				score := ranking.TextWeight*dm.Score + ranking.PageRankWeight*pageRank
+				if ranking.FreshnessEnabled() && !indexedAt.IsZero() {
+					score += ranking.FreshnessWeight * ranking.Freshness(indexedAt, now)
+				}
+				dm.Score = score
+				return nil
+			}, nil
+		},
+	}
+}
+
+// Searcher implements query.Query.
+func (q *rescoringQuery) Searcher(r bleveIndex.IndexReader, m mapping.IndexMapping, opts search.SearcherOptions) (search.Searcher, error) {
+	s, err := q.inner.Searcher(r, m, opts)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := q.newScoreFunc(r)
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return &rescoringSearcher{Searcher: s, scoreFn: fn, constWeight: q.constWeight}, nil
+}
+
+// rescoringSearcher wraps a search.Searcher and updates the score of each
+// document match that it returns.
+type rescoringSearcher struct {
+	search.Searcher
+	scoreFn     scoreFunc
+	constWeight bool
+}
+
+func (s *rescoringSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.Searcher.Next(ctx)
+	return s.rescore(dm, err)
+}
+
+func (s *rescoringSearcher) Advance(ctx *search.SearchContext, id bleveIndex.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.Searcher.Advance(ctx, id)
+	return s.rescore(dm, err)
+}
+
+func (s *rescoringSearcher) Weight() float64 {
+	if s.constWeight {
+		return 0
+	}
+	return s.Searcher.Weight()
+}
+
+func (s *rescoringSearcher) SetQueryNorm(qnorm float64) {
+	if !s.constWeight {
+		s.Searcher.SetQueryNorm(qnorm)
+	}
+}
+
+func (s *rescoringSearcher) rescore(dm *search.DocumentMatch, err error) (*search.DocumentMatch, error) {
+	if err != nil || dm == nil {
+		return dm, err
+	}
+	if err = s.scoreFn(dm); err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
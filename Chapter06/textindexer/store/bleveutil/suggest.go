@@ -0,0 +1,92 @@
+package bleveutil
+
+import (
+	"context"
+	"github.com/blevesearch/bleve"
+	"test_project/Chapter06/textindexer/index"
+	"unicode/utf8"
+)
+
+// vocabularyFieldName is the name of the field that holds the lowercased
+// terms of the Title and Content of each document.
+const vocabularyFieldName = "Vocabulary"
+
+// vocabularyAnalyzerName is the name of the analyzer for the Vocabulary
+// field and for the expressions passed to Suggest.
+const vocabularyAnalyzerName = "textindexer_vocabulary"
+
+// Suggest returns a spelling correction for expression that is built from
+// the term dictionary of the Vocabulary field of idx or an empty string if
+// no word of expression can be corrected. Each word is replaced by the term
+// with the smallest edit distance to it; ties are broken in favor of the term
+// that occurs in more documents. Indices that were created before the
+// Vocabulary field was introduced never yield any suggestions.
+func Suggest(ctx context.Context, idx bleve.Index, expression string) (string, error) {
+	analyzer := idx.Mapping().AnalyzerNamed(vocabularyAnalyzerName)
+	if analyzer == nil {
+		return "", nil
+	}
+
+	var corrections []index.Correction
+	for _, tok := range analyzer.Analyze([]byte(expression)) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		term, err := suggestTerm(idx, string(tok.Term))
+		if err != nil {
+			return "", err
+		} else if term != "" {
+			corrections = append(corrections, index.Correction{Start: tok.Start, End: tok.End, Term: term})
+		}
+	}
+	if len(corrections) == 0 {
+		return "", nil
+	}
+	return index.ApplyCorrections(expression, corrections), nil
+}
+
+// suggestTerm returns the best correction for word or an empty string if
+// word is indexed or no suitable correction exists.
+func suggestTerm(idx bleve.Index, word string) (string, error) {
+	if utf8.RuneCountInString(word) < index.SuggestMinWordLength {
+		return "", nil
+	}
+
+	var prefixLen int
+	for i := 0; i < index.SuggestPrefixLength; i++ {
+		_, size := utf8.DecodeRuneInString(word[prefixLen:])
+		prefixLen += size
+	}
+	dict, err := idx.FieldDictPrefix(vocabularyFieldName, []byte(word[:prefixLen]))
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = dict.Close() }()
+
+	var (
+		best      string
+		bestDist  int
+		bestCount uint64
+	)
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			return "", err
+		} else if entry == nil {
+			break
+		} else if entry.Term == word {
+			return "", nil
+		}
+
+		// Terms are visited in lexicographic order so the first of
+		// several equally good terms is retained.
+		dist := index.EditDistance(word, entry.Term)
+		if dist > index.SuggestMaxEdits {
+			continue
+		}
+		if best == "" || dist < bestDist || (dist == bestDist && entry.Count > bestCount) {
+			best, bestDist, bestCount = entry.Term, dist, entry.Count
+		}
+	}
+	return best, nil
+}
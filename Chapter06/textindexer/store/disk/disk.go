@@ -0,0 +1,574 @@
+package disk
+
+import (
+	"context"
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/index/scorch"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"sync"
+	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/store/bleveutil"
+	"time"
+)
+
+// The number of documents to scan per request when expiring documents.
+const scanBatchSize = 1000
+
+// Compile-time check for ensuring PersistentBleveIndexer implements Indexer.
+var (
+	_ index.Indexer         = (*PersistentBleveIndexer)(nil)
+	_ index.DuplicateFinder = (*PersistentBleveIndexer)(nil)
+	_ index.Scanner         = (*PersistentBleveIndexer)(nil)
+	_ index.Restorer        = (*PersistentBleveIndexer)(nil)
+	_ index.Suggester       = (*PersistentBleveIndexer)(nil)
+	_ index.Completer       = (*PersistentBleveIndexer)(nil)
+	_ index.RelatedFinder   = (*PersistentBleveIndexer)(nil)
+)
+
+// PersistentBleveIndexer is an index.Indexer implementation that stores
+// documents in an on-disk bleve index. All document fields are stored inside
+// the index so no additional state needs to be kept in memory.
+type PersistentBleveIndexer struct {
+	// mu serializes the read-modify-write sequences used for preserving
+	// PageRank scores across updates.
+	mu  sync.Mutex
+	idx bleve.Index
+}
+
+// bleveDoc is the representation of index.Document that gets stored in the
+// bleve index. IndexedAt is encoded as an RFC3339 string with nanosecond
+// precision so that it survives the round-trip unmodified while Fingerprint
+// is encoded as a hex string.
+type bleveDoc struct {
+	URL              string
+	Host             string
+	Title            string
+	Content          string
+	IndexedAt        string
+	IndexedAtDate    *time.Time
+	Fingerprint      string
+	FingerprintBands []string
+	PageRank         float64
+	Language         string
+	LocalizedContent map[string]string
+}
+
+// NewPersistentBleveIndexer opens the bleve index at path or creates a new
+// one if path does not exist.
+func NewPersistentBleveIndexer(path string) (*PersistentBleveIndexer, error) {
+	return NewPersistentBleveIndexerWithAnalysis(path, index.AnalysisConfig{})
+}
+
+// NewPersistentBleveIndexerWithAnalysis opens the bleve index at path or
+// creates a new one that analyzes the Title and Content of documents
+// according to analysis if path does not exist. Existing indices retain the
+// analysis that they were created with.
+func NewPersistentBleveIndexerWithAnalysis(path string, analysis index.AnalysisConfig) (*PersistentBleveIndexer, error) {
+	idx, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		var m mapping.IndexMapping
+		if m, err = bleveutil.NewIndexMapping(analysis); err == nil {
+			idx, err = bleve.NewUsing(path, m, scorch.Name, scorch.Name, nil)
+		}
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("open index at %q: %w", path, err)
+	}
+
+	return &PersistentBleveIndexer{idx: idx}, nil
+}
+
+func (i *PersistentBleveIndexer) Index(ctx context.Context, doc *index.Document) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("index: %w", err)
+	}
+	if doc.LinkID == uuid.Nil {
+		return xerrors.Errorf("index: %w", index.ErrMissingLinkID)
+	}
+
+	doc.Fingerprint = index.Fingerprint(doc.Content)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	dCopy := copyDoc(doc)
+	if existing, err := i.loadDoc(dCopy.LinkID.String()); err == nil {
+		dCopy.PageRank = existing.PageRank
+	} else if !xerrors.Is(err, index.ErrNotFound) {
+		return xerrors.Errorf("index: %w", err)
+	}
+	if err := i.idx.Index(dCopy.LinkID.String(), makeBleveDoc(dCopy)); err != nil {
+		return xerrors.Errorf("index: %w", err)
+	}
+	return nil
+}
+
+func (i *PersistentBleveIndexer) IndexMany(ctx context.Context, docs []*index.Document) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("index many: %w", err)
+	}
+
+	var (
+		bulkErr index.BulkError
+		pending = make(map[string]*index.Document, len(docs))
+	)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	batch := i.idx.NewBatch()
+	for pos, doc := range docs {
+		if doc.LinkID == uuid.Nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, Err: index.ErrMissingLinkID})
+			continue
+		}
+		doc.Fingerprint = index.Fingerprint(doc.Content)
+		dCopy := copyDoc(doc)
+		key := dCopy.LinkID.String()
+		if prev := pending[key]; prev != nil {
+			dCopy.PageRank = prev.PageRank
+		} else if existing, err := i.loadDoc(key); err == nil {
+			dCopy.PageRank = existing.PageRank
+		} else if !xerrors.Is(err, index.ErrNotFound) {
+			return xerrors.Errorf("index many: %w", err)
+		}
+		if err := batch.Index(key, makeBleveDoc(dCopy)); err != nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, LinkID: dCopy.LinkID, Err: err})
+			continue
+		}
+		pending[key] = dCopy
+	}
+	if err := i.idx.Batch(batch); err != nil {
+		return xerrors.Errorf("index many: %w", err)
+	}
+	if len(bulkErr.Items) != 0 {
+		return xerrors.Errorf("index many: %w", &bulkErr)
+	}
+	return nil
+}
+
+func (i *PersistentBleveIndexer) FindByID(ctx context.Context, linkID uuid.UUID) (*index.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("find by ID: %w", err)
+	}
+	doc, err := i.loadDoc(linkID.String())
+	if err != nil {
+		return nil, xerrors.Errorf("find by ID: %w", err)
+	}
+	return doc, nil
+}
+
+func (i *PersistentBleveIndexer) Search(ctx context.Context, q index.Query) (index.Iterator, error) {
+	bq, err := bleveutil.NewQuery(q)
+	if err != nil {
+		return nil, xerrors.Errorf("search: %w", err)
+	}
+	searchReq := bleve.NewSearchRequest(bq)
+	searchReq.SortBy(bleveutil.SortOrder)
+	searchReq.Fields = []string{"*"}
+	searchReq.Size = q.PageSizeOrDefault()
+	it := &bleveIterator{ctx: ctx, idx: i.idx, searchReq: searchReq}
+	if q.Highlight != nil {
+		searchReq.IncludeLocations = true
+		it.highlighter = bleveutil.NewHighlighter(i.idx, *q.Highlight)
+	}
+	var facetOpts index.FacetOptions
+	if q.Facets != nil {
+		facetOpts = q.Facets.WithDefaults()
+		bleveutil.AddFacets(searchReq, facetOpts)
+	}
+	if q.Collapse != nil {
+		if it.collapser, err = bleveutil.NewCollapser(ctx, i.idx, searchReq, q); err != nil {
+			return nil, xerrors.Errorf("search: %w", err)
+		}
+		it.total = it.collapser.TotalCount()
+		if q.Facets != nil {
+			it.facets = bleveutil.MapFacets(it.collapser.Facets(), facetOpts)
+		}
+		return it, nil
+	}
+	if q.Cursor != "" {
+		if searchReq.SearchAfter, err = bleveutil.SearchAfter(q.Cursor); err != nil {
+			return nil, xerrors.Errorf("search: %w", err)
+		}
+	} else {
+		searchReq.From = int(q.Offset)
+	}
+	rs, err := i.idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, xerrors.Errorf("search: %w", err)
+	}
+	it.rs, it.total = rs, rs.Total
+	if q.Facets != nil {
+		it.facets = bleveutil.MapFacets(rs.Facets, facetOpts)
+		// Facets only need to be calculated once; skip them when
+		// fetching subsequent result pages.
+		searchReq.Facets = nil
+	}
+	return it, nil
+}
+
+func (i *PersistentBleveIndexer) UpdateScore(ctx context.Context, linkID uuid.UUID, score float64) error {
+	if err := i.UpdateScores(ctx, []index.ScoreUpdate{{LinkID: linkID, Score: score}}); err != nil {
+		return xerrors.Errorf("update score: %w", err)
+	}
+	return nil
+}
+
+func (i *PersistentBleveIndexer) UpdateScores(ctx context.Context, updates []index.ScoreUpdate) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("update scores: %w", err)
+	}
+
+	var (
+		bulkErr index.BulkError
+		pending = make(map[string]*index.Document, len(updates))
+	)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	batch := i.idx.NewBatch()
+	for pos, update := range updates {
+		key := update.LinkID.String()
+		doc := pending[key]
+		if doc == nil {
+			existing, err := i.loadDoc(key)
+			if xerrors.Is(err, index.ErrNotFound) {
+				existing, err = &index.Document{LinkID: update.LinkID}, nil
+			}
+			if err != nil {
+				return xerrors.Errorf("update scores: %w", err)
+			}
+			doc = existing
+		}
+		doc.PageRank = update.Score
+		if err := batch.Index(key, makeBleveDoc(doc)); err != nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, LinkID: update.LinkID, Err: err})
+			continue
+		}
+		pending[key] = doc
+	}
+	if err := i.idx.Batch(batch); err != nil {
+		return xerrors.Errorf("update scores: %w", err)
+	}
+	if len(bulkErr.Items) != 0 {
+		return xerrors.Errorf("update scores: %w", &bulkErr)
+	}
+	return nil
+}
+
+func (i *PersistentBleveIndexer) Delete(ctx context.Context, linkID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("delete: %w", err)
+	}
+	key := linkID.String()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, err := i.loadDoc(key); err != nil {
+		return xerrors.Errorf("delete: %w", err)
+	}
+	if err := i.idx.Delete(key); err != nil {
+		return xerrors.Errorf("delete: %w", err)
+	}
+	return nil
+}
+
+func (i *PersistentBleveIndexer) Expire(ctx context.Context, indexedBefore time.Time) (uint64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	searchReq := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	searchReq.SortBy([]string{"_id"})
+	searchReq.Fields = []string{"IndexedAt"}
+	searchReq.Size = scanBatchSize
+
+	var (
+		count uint64
+		batch = i.idx.NewBatch()
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, xerrors.Errorf("expire: %w", err)
+		}
+		rs, err := i.idx.SearchInContext(ctx, searchReq)
+		if err != nil {
+			return count, xerrors.Errorf("expire: %w", err)
+		}
+		for _, hit := range rs.Hits {
+			if indexedAt, _ := parseTime(hit.Fields["IndexedAt"]); indexedAt.Before(indexedBefore) {
+				batch.Delete(hit.ID)
+			}
+		}
+
+		// Deleting the documents of the current page does not affect
+		// the pages that follow it as they are fetched by ID.
+		if batch.Size() >= scanBatchSize || len(rs.Hits) < searchReq.Size {
+			if size := batch.Size(); size != 0 {
+				if err = i.idx.Batch(batch); err != nil {
+					return count, xerrors.Errorf("expire: %w", err)
+				}
+				count += uint64(size)
+				batch.Reset()
+			}
+		}
+		if len(rs.Hits) < searchReq.Size {
+			return count, nil
+		}
+		searchReq.SearchAfter = []string{rs.Hits[len(rs.Hits)-1].ID}
+	}
+}
+
+func (i *PersistentBleveIndexer) FindDuplicates(ctx context.Context, linkID uuid.UUID) ([]*index.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	doc, err := i.loadDoc(linkID.String())
+	if err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	return i.findDuplicates(ctx, doc)
+}
+
+// FindDuplicatesOf returns the near-duplicates of doc, which does not need to
+// be stored in the index. If the Fingerprint of doc is not set, it is
+// computed from its Content.
+func (i *PersistentBleveIndexer) FindDuplicatesOf(ctx context.Context, doc *index.Document) ([]*index.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	dCopy := *doc
+	if dCopy.Fingerprint == 0 {
+		dCopy.Fingerprint = index.Fingerprint(dCopy.Content)
+	}
+	return i.findDuplicates(ctx, &dCopy)
+}
+
+func (i *PersistentBleveIndexer) findDuplicates(ctx context.Context, doc *index.Document) ([]*index.Document, error) {
+	if doc.Fingerprint == 0 {
+		return nil, nil
+	}
+	searchReq := bleve.NewSearchRequest(bleveutil.NewDuplicatesQuery(doc.Fingerprint))
+	searchReq.Fields = []string{"*"}
+	searchReq.Size = bleveutil.MaxDuplicateCandidates
+	rs, err := i.idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	candidates := make([]*index.Document, len(rs.Hits))
+	for j, hit := range rs.Hits {
+		candidates[j] = mapHit(hit.ID, hit.Fields)
+	}
+	return index.NearDuplicates(doc, candidates), nil
+}
+
+func (i *PersistentBleveIndexer) Scan(ctx context.Context) (index.DocumentIterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("scan: %w", err)
+	}
+	searchReq := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	searchReq.SortBy([]string{"_id"})
+	searchReq.Fields = []string{"*"}
+	searchReq.Size = scanBatchSize
+	rs, err := i.idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, xerrors.Errorf("scan: %w", err)
+	}
+	return &scanIterator{ctx: ctx, idx: i.idx, searchReq: searchReq, rs: rs}, nil
+}
+
+func (i *PersistentBleveIndexer) Restore(ctx context.Context, docs []*index.Document) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("restore: %w", err)
+	}
+
+	var bulkErr index.BulkError
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	batch := i.idx.NewBatch()
+	for pos, doc := range docs {
+		if doc.LinkID == uuid.Nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, Err: index.ErrMissingLinkID})
+			continue
+		}
+		dCopy := copyDoc(doc)
+		dCopy.Fingerprint = index.Fingerprint(dCopy.Content)
+		if err := batch.Index(dCopy.LinkID.String(), makeBleveDoc(dCopy)); err != nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, LinkID: dCopy.LinkID, Err: err})
+		}
+	}
+	if err := i.idx.Batch(batch); err != nil {
+		return xerrors.Errorf("restore: %w", err)
+	}
+	if len(bulkErr.Items) != 0 {
+		return xerrors.Errorf("restore: %w", &bulkErr)
+	}
+	return nil
+}
+
+// Suggest corrects the misspelled words of expression using the terms of
+// the indexed Title and Content fields.
+func (i *PersistentBleveIndexer) Suggest(ctx context.Context, expression string) (string, error) {
+	suggestion, err := bleveutil.Suggest(ctx, i.idx, expression)
+	if err != nil {
+		return "", xerrors.Errorf("suggest: %w", err)
+	}
+	return suggestion, nil
+}
+
+func (i *PersistentBleveIndexer) Complete(ctx context.Context, prefix string, limit int) ([]index.Completion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("complete: %w", err)
+	}
+	searchReq := bleveutil.NewCompletionRequest(prefix)
+	if searchReq == nil {
+		return nil, nil
+	}
+	searchReq.Fields = []string{"*"}
+	rs, err := i.idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, xerrors.Errorf("complete: %w", err)
+	}
+	candidates := make([]*index.Document, len(rs.Hits))
+	for j, hit := range rs.Hits {
+		candidates[j] = mapHit(hit.ID, hit.Fields)
+	}
+	return index.MakeCompletions(prefix, candidates, limit), nil
+}
+
+func (i *PersistentBleveIndexer) Related(ctx context.Context, linkID uuid.UUID, n int) (index.Iterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	doc, err := i.loadDoc(linkID.String())
+	if err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	return i.related(ctx, doc, n, false)
+}
+
+// RelatedTo returns the documents that are related to doc, which is treated
+// as if it was not stored in the index: it is counted as an additional
+// document when selecting its terms and any stored document with the same
+// link ID is excluded from the results.
+func (i *PersistentBleveIndexer) RelatedTo(ctx context.Context, doc *index.Document, n int) (index.Iterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	return i.related(ctx, doc, n, true)
+}
+
+func (i *PersistentBleveIndexer) related(ctx context.Context, doc *index.Document, n int, external bool) (index.Iterator, error) {
+	rq, err := bleveutil.NewRelatedQuery(i.idx, doc, external)
+	if err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	it := &bleveIterator{ctx: ctx, idx: i.idx, firstPageOnly: true}
+	if rq == nil {
+		return it, nil
+	}
+	if n <= 0 {
+		n = index.DefaultRelatedLimit
+	}
+	it.searchReq = bleve.NewSearchRequest(rq)
+	it.searchReq.SortBy(bleveutil.SortOrder)
+	it.searchReq.Fields = []string{"*"}
+	it.searchReq.Size = n
+	if it.rs, err = i.idx.SearchInContext(ctx, it.searchReq); err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	it.total = it.rs.Total
+	return it, nil
+}
+
+// Close flushes any pending changes to disk and closes the index.
+func (i *PersistentBleveIndexer) Close() error {
+	return i.idx.Close()
+}
+
+// loadDoc reads the stored fields of the document with the specified ID.
+func (i *PersistentBleveIndexer) loadDoc(linkID string) (*index.Document, error) {
+	stored, err := i.idx.Document(linkID)
+	if err != nil {
+		return nil, err
+	} else if stored == nil {
+		return nil, index.ErrNotFound
+	}
+
+	doc := &index.Document{LinkID: uuid.MustParse(linkID)}
+	for _, field := range stored.Fields {
+		switch f := field.(type) {
+		case *document.TextField:
+			setDocField(doc, f.Name(), string(f.Value()))
+		case *document.NumericField:
+			if f.Name() == "PageRank" {
+				if doc.PageRank, err = f.Number(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return doc, nil
+}
+
+func copyDoc(doc *index.Document) *index.Document {
+	dCopy := &index.Document{}
+	*dCopy = *doc
+	return dCopy
+}
+
+func makeBleveDoc(d *index.Document) bleveDoc {
+	return bleveDoc{
+		URL:              d.URL,
+		Host:             index.URLHost(d.URL),
+		Title:            d.Title,
+		Content:          d.Content,
+		IndexedAt:        d.IndexedAt.UTC().Format(time.RFC3339Nano),
+		IndexedAtDate:    bleveutil.DateField(d.IndexedAt),
+		Fingerprint:      bleveutil.FormatFingerprint(d.Fingerprint),
+		FingerprintBands: bleveutil.FingerprintBands(d.Fingerprint),
+		PageRank:         d.PageRank,
+		Language:         d.Language,
+		LocalizedContent: bleveutil.LocalizedContent(d),
+	}
+}
+
+// mapHit converts a search hit whose stored fields were loaded by the search
+// request into an index.Document.
+func mapHit(id string, fields map[string]interface{}) *index.Document {
+	doc := &index.Document{LinkID: uuid.MustParse(id)}
+	for name, value := range fields {
+		switch v := value.(type) {
+		case string:
+			setDocField(doc, name, v)
+		case float64:
+			if name == "PageRank" {
+				doc.PageRank = v
+			}
+		}
+	}
+	return doc
+}
+
+func setDocField(doc *index.Document, name, value string) {
+	switch name {
+	case "URL":
+		doc.URL = value
+	case "Title":
+		doc.Title = value
+	case "Content":
+		doc.Content = value
+	case "IndexedAt":
+		doc.IndexedAt, _ = parseTime(value)
+	case "Fingerprint":
+		doc.Fingerprint = bleveutil.ParseFingerprint(value)
+	case "Language":
+		doc.Language = value
+	}
+}
+
+func parseTime(v interface{}) (time.Time, error) {
+	s, _ := v.(string)
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
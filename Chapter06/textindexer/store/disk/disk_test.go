@@ -0,0 +1,109 @@
+package disk
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	gc "gopkg.in/check.v1"
+	"path/filepath"
+	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/index/indextest"
+	"testing"
+	"time"
+)
+
+var _ = gc.Suite(new(PersistentBleveTestSuite))
+
+type PersistentBleveTestSuite struct {
+	indextest.SuiteBase
+	idx  *PersistentBleveIndexer
+	path string
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *PersistentBleveTestSuite) SetUpTest(c *gc.C) {
+	s.path = filepath.Join(c.MkDir(), "index")
+	idx, err := NewPersistentBleveIndexer(s.path)
+	c.Assert(err, gc.IsNil)
+	s.SetIndexer(idx)
+	s.SetAnalyzedIndexerFactory(func(cfg index.AnalysisConfig) (index.Indexer, error) {
+		return NewPersistentBleveIndexerWithAnalysis(filepath.Join(c.MkDir(), "analyzed"), cfg)
+	})
+	s.idx = idx
+}
+
+func (s *PersistentBleveTestSuite) TearDownTest(c *gc.C) {
+	c.Assert(s.idx.Close(), gc.IsNil)
+}
+
+func (s *PersistentBleveTestSuite) TestReopenExistingIndex(c *gc.C) {
+	doc := &index.Document{
+		LinkID:    uuid.New(),
+		URL:       "http://example.com",
+		Title:     "Illustrious examples",
+		Content:   "Lorem ipsum dolor",
+		IndexedAt: time.Now().UTC(),
+	}
+	c.Assert(s.idx.Index(context.TODO(), doc), gc.IsNil)
+	c.Assert(s.idx.UpdateScore(context.TODO(), doc.LinkID, 0.5), gc.IsNil)
+	c.Assert(s.idx.Close(), gc.IsNil)
+
+	idx, err := NewPersistentBleveIndexer(s.path)
+	c.Assert(err, gc.IsNil)
+	s.SetIndexer(idx)
+	s.idx = idx
+
+	got, err := idx.FindByID(context.TODO(), doc.LinkID)
+	c.Assert(err, gc.IsNil)
+	doc.PageRank = 0.5
+	c.Assert(got, gc.DeepEquals, doc)
+
+	it, err := idx.Search(context.TODO(), index.Query{Type: index.QueryTypeMatch, Expression: "ipsum"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.Next(), gc.Equals, true)
+	c.Assert(it.Document(), gc.DeepEquals, doc)
+	c.Assert(it.Next(), gc.Equals, false)
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+}
+
+func (s *PersistentBleveTestSuite) TestExpireSpanningSeveralPages(c *gc.C) {
+	var (
+		numDocs  = 2*scanBatchSize + scanBatchSize/2
+		now      = time.Now().UTC()
+		docs     = make([]*index.Document, numDocs)
+		freshIDs = make(map[uuid.UUID]bool)
+	)
+	for i := range docs {
+		docs[i] = &index.Document{LinkID: uuid.New(), IndexedAt: now.Add(-time.Hour)}
+		if i%3 == 0 {
+			docs[i].IndexedAt = now
+			freshIDs[docs[i].LinkID] = true
+		}
+	}
+	c.Assert(s.idx.Restore(context.TODO(), docs), gc.IsNil)
+
+	count, err := s.idx.Expire(context.TODO(), now.Add(-time.Minute))
+	c.Assert(err, gc.IsNil)
+	c.Assert(count, gc.Equals, uint64(numDocs-len(freshIDs)))
+
+	it, err := s.idx.Scan(context.TODO())
+	c.Assert(err, gc.IsNil)
+	var remaining int
+	for it.Next() {
+		c.Assert(freshIDs[it.Document().LinkID], gc.Equals, true)
+		remaining++
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+	c.Assert(remaining, gc.Equals, len(freshIDs))
+
+	// Cancelled contexts abort the expiry.
+	ctx, cancelFn := context.WithCancel(context.Background())
+	cancelFn()
+	_, err = s.idx.Expire(ctx, now.Add(time.Minute))
+	c.Assert(xerrors.Is(err, context.Canceled), gc.Equals, true, gc.Commentf("%v", err))
+}
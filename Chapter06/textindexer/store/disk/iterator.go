@@ -0,0 +1,202 @@
+package disk
+
+import (
+	"context"
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/store/bleveutil"
+)
+
+// bleveIterator implements index.Iterator.
+type bleveIterator struct {
+	ctx        context.Context
+	idx        bleve.Index
+	searchReq  *bleve.SearchRequest
+	rs         *bleve.SearchResult
+	rsIdx      int
+	latchedDoc *index.Document
+	lastErr    error
+
+	// total is the number of matching documents reported by the initial
+	// search request.
+	total         uint64
+	latchedCursor string
+	latchedScore  float64
+
+	// highlighter is only set when the query requested highlighting.
+	highlighter       *bleveutil.Highlighter
+	latchedHighlights *index.Highlights
+
+	// facets is only set when the query requested facets.
+	facets *index.Facets
+
+	// collapser replaces the paging of the search request when the query
+	// requested collapsing.
+	collapser *bleveutil.Collapser
+
+	// firstPageOnly is set when the results are limited to the first
+	// page of the search request.
+	firstPageOnly bool
+}
+
+// Next loads the next document matching the search query.
+// It returns false if no more documents are available.
+func (it *bleveIterator) Next() bool {
+	hit := it.nextHit()
+	if hit == nil {
+		return false
+	}
+	it.latchedDoc = mapHit(hit.ID, hit.Fields)
+	if it.highlighter != nil {
+		if it.latchedHighlights, it.lastErr = it.highlighter.Highlight(hit); it.lastErr != nil {
+			return false
+		}
+	}
+	it.latchedScore = hit.Score
+	if it.collapser != nil {
+		it.latchedCursor = it.collapser.Cursor()
+	} else {
+		it.latchedCursor = bleveutil.HitCursor(hit)
+	}
+	return true
+}
+
+// nextHit returns the next matching document or nil if no more documents are
+// available.
+func (it *bleveIterator) nextHit() *search.DocumentMatch {
+	if it.collapser != nil {
+		if it.lastErr != nil {
+			return nil
+		}
+		if !it.collapser.Next() {
+			it.lastErr = it.collapser.Error()
+			return nil
+		}
+		return it.collapser.Hit()
+	}
+	if it.lastErr != nil || it.rs == nil {
+		return nil
+	}
+	if it.rsIdx >= it.rs.Hits.Len() {
+		// A partial page indicates that there are no more results.
+		if it.firstPageOnly || it.rs.Hits.Len() < it.searchReq.Size {
+			return nil
+		}
+		it.searchReq.From = 0
+		it.searchReq.SearchAfter = bleveutil.HitSearchAfter(it.rs.Hits[it.rsIdx-1])
+		if it.rs, it.lastErr = it.idx.SearchInContext(it.ctx, it.searchReq); it.lastErr != nil {
+			return nil
+		}
+		it.rsIdx = 0
+		if it.rs.Hits.Len() == 0 {
+			return nil
+		}
+	}
+	hit := it.rs.Hits[it.rsIdx]
+	it.rsIdx++
+	return hit
+}
+
+// Document returns the current document from the result set.
+func (it *bleveIterator) Document() *index.Document {
+	return it.latchedDoc
+}
+
+// Highlights returns the highlighted fragments for the current document.
+func (it *bleveIterator) Highlights() *index.Highlights {
+	return it.latchedHighlights
+}
+
+// Facets returns the facet counts for the documents matching the query.
+func (it *bleveIterator) Facets() *index.Facets {
+	return it.facets
+}
+
+// Cursor returns the continuation token for the current document.
+func (it *bleveIterator) Cursor() string {
+	return it.latchedCursor
+}
+
+// Collapsed returns the number of omitted documents from the host of the
+// current document.
+func (it *bleveIterator) Collapsed() uint64 {
+	if it.collapser == nil {
+		return 0
+	}
+	return it.collapser.Collapsed()
+}
+
+// Score returns the relevance score of the current document.
+func (it *bleveIterator) Score() float64 {
+	return it.latchedScore
+}
+
+// TotalCount returns the approximate number of search results.
+func (it *bleveIterator) TotalCount() uint64 {
+	return it.total
+}
+
+// Error returns the last error encountered by the iterator.
+func (it *bleveIterator) Error() error {
+	return it.lastErr
+}
+
+// Close the iterator and release any allocated resources.
+func (it *bleveIterator) Close() error {
+	return nil
+}
+
+// scanIterator implements index.DocumentIterator by paging through all
+// documents in ascending ID order.
+type scanIterator struct {
+	ctx        context.Context
+	idx        bleve.Index
+	searchReq  *bleve.SearchRequest
+	rs         *bleve.SearchResult
+	rsIdx      int
+	latchedDoc *index.Document
+	lastErr    error
+}
+
+// Next loads the next document. It returns false if no more documents are
+// available.
+func (it *scanIterator) Next() bool {
+	if it.lastErr != nil || it.rs == nil {
+		return false
+	}
+	if it.rsIdx >= it.rs.Hits.Len() {
+		// A partial page indicates that there are no more documents.
+		if it.rs.Hits.Len() < it.searchReq.Size {
+			return false
+		}
+		it.searchReq.SearchAfter = []string{it.rs.Hits[it.rsIdx-1].ID}
+		if it.rs, it.lastErr = it.idx.SearchInContext(it.ctx, it.searchReq); it.lastErr != nil {
+			return false
+		}
+		it.rsIdx = 0
+		if it.rs.Hits.Len() == 0 {
+			return false
+		}
+	}
+	hit := it.rs.Hits[it.rsIdx]
+	it.latchedDoc = mapHit(hit.ID, hit.Fields)
+	it.rsIdx++
+	return true
+}
+
+// Document returns the current document.
+func (it *scanIterator) Document() *index.Document {
+	return it.latchedDoc
+}
+
+// Error returns the last error encountered by the iterator.
+func (it *scanIterator) Error() error {
+	return it.lastErr
+}
+
+// Close the iterator and release any allocated resources.
+func (it *scanIterator) Close() error {
+	it.rs = nil
+	return nil
+}
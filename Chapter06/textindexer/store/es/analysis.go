@@ -0,0 +1,120 @@
+package es
+
+import (
+	"test_project/Chapter06/textindexer/index"
+)
+
+// textAnalyzerName is the name of the analyzer for the Title and Content
+// fields of indices created with a custom analysis configuration. The
+// analyzers for the localized content fields are named
+// "<textAnalyzerName>_<language>".
+const textAnalyzerName = "textindexer"
+
+// completionAnalyzerName is the name of the analyzer for the TitleCompletion
+// field, which indexes the leading characters of each word of the Title of
+// documents.
+const completionAnalyzerName = "textindexer_completion"
+
+// shinglesAnalyzerName is the name of the analyzer for the
+// VocabularyShingles field, which indexes each word of the Title and Content
+// of documents along with each pair of adjacent words.
+const shinglesAnalyzerName = "textindexer_shingles"
+
+// localizedContentPrefix is the common prefix of the fields that hold the
+// Content of documents analyzed for their language.
+const localizedContentPrefix = "LocalizedContent."
+
+// localizedContentField returns the name of the field holding the Content of
+// documents in the specified supported language.
+func localizedContentField(language string) string {
+	return localizedContentPrefix + language
+}
+
+// makeAnalysisSettings returns the index analysis settings that define the
+// analyzer for the Title and Content fields, if cfg is not the zero value,
+// the analyzers for the localized content fields and the analyzers for the
+// TitleCompletion and VocabularyShingles fields.
+func makeAnalysisSettings(cfg index.AnalysisConfig) map[string]interface{} {
+	var (
+		filters   = make(map[string]interface{})
+		analyzers = make(map[string]interface{})
+	)
+	if !cfg.IsZero() {
+		analyzers[textAnalyzerName] = addAnalyzer(filters, textAnalyzerName, cfg)
+	}
+	for _, language := range index.SupportedLanguages() {
+		name := textAnalyzerName + "_" + language
+		analyzers[name] = addAnalyzer(filters, name, cfg.ForLanguage(language))
+	}
+	filters[completionAnalyzerName+"_edge_ngram"] = map[string]interface{}{
+		"type":     "edge_ngram",
+		"min_gram": 1,
+		"max_gram": index.MaxCompletionWordLength,
+	}
+	analyzers[completionAnalyzerName] = map[string]interface{}{
+		"type":      "custom",
+		"tokenizer": "standard",
+		"filter":    []interface{}{"lowercase", completionAnalyzerName + "_edge_ngram"},
+	}
+	filters[shinglesAnalyzerName+"_shingle"] = map[string]interface{}{
+		"type":             "shingle",
+		"min_shingle_size": 2,
+		"max_shingle_size": 2,
+		"output_unigrams":  true,
+	}
+	analyzers[shinglesAnalyzerName] = map[string]interface{}{
+		"type":      "custom",
+		"tokenizer": "standard",
+		"filter":    []interface{}{"lowercase", shinglesAnalyzerName + "_shingle"},
+	}
+	return map[string]interface{}{
+		"filter":   filters,
+		"analyzer": analyzers,
+	}
+}
+
+// addAnalyzer adds the token filters for cfg to filters, using name as a
+// prefix for the filter names, and returns the definition of an analyzer
+// that applies them.
+func addAnalyzer(filters map[string]interface{}, name string, cfg index.AnalysisConfig) map[string]interface{} {
+	var (
+		filterNames    = []interface{}{"lowercase"}
+		stopFilterName = name + "_stop"
+		synonymsName   = name + "_synonyms"
+		stemmerName    = name + "_stemmer"
+	)
+	if cfg.RemoveStopWords {
+		stopWords := interface{}("_" + index.LanguageName(cfg.Language) + "_")
+		if len(cfg.StopWords) != 0 {
+			stopWords = cfg.LowercaseStopWords()
+		}
+		filters[stopFilterName] = map[string]interface{}{
+			"type":      "stop",
+			"stopwords": stopWords,
+		}
+		filterNames = append(filterNames, stopFilterName)
+	}
+	if len(cfg.Synonyms) != 0 {
+		// Synonym rules are analyzed by the preceding filters; lenient
+		// mode skips rather than rejects any rules containing stop words.
+		filters[synonymsName] = map[string]interface{}{
+			"type":     "synonym",
+			"synonyms": cfg.SynonymRules(),
+			"lenient":  true,
+		}
+		filterNames = append(filterNames, synonymsName)
+	}
+	if cfg.Stemming {
+		filters[stemmerName] = map[string]interface{}{
+			"type":     "stemmer",
+			"language": index.LanguageName(cfg.Language),
+		}
+		filterNames = append(filterNames, stemmerName)
+	}
+
+	return map[string]interface{}{
+		"type":      "custom",
+		"tokenizer": "standard",
+		"filter":    filterNames,
+	}
+}
@@ -0,0 +1,55 @@
+package es
+
+import (
+	"test_project/Chapter06/textindexer/index"
+)
+
+const (
+	// The name of the inner hits that hold the documents of each group
+	// when collapsing results by host.
+	hostInnerHits = "host"
+
+	// The name of the aggregation that counts the host groups.
+	groupsAgg = "groups"
+
+	// groupsPrecisionThreshold is the number of host groups below which
+	// the groups aggregation is expected to be exact. It is the maximum
+	// that elasticsearch supports.
+	groupsPrecisionThreshold = 40000
+)
+
+// makeEsCollapse returns the collapse section for grouping search results by
+// host according to opts. The top documents of each group are returned as
+// inner hits, optionally with highlights.
+func makeEsCollapse(opts index.CollapseOptions, highlight *index.HighlightOptions) map[string]interface{} {
+	innerHits := map[string]interface{}{
+		"name": hostInnerHits,
+		"size": opts.WithDefaults().MaxPerHost,
+		"sort": esSortOrder,
+	}
+	if highlight != nil {
+		innerHits["highlight"] = makeEsHighlight(*highlight)
+	}
+	return map[string]interface{}{
+		"field":      "Host",
+		"inner_hits": innerHits,
+	}
+}
+
+// makeEsGroupsAgg returns the aggregation for counting the number of host
+// groups. Documents without a host are counted as a separate group, the same
+// way that they are collapsed.
+//
+// The cardinality aggregation is used as counting the groups exactly would
+// require paging through a bucket per host. Its count is approximate: it is
+// expected to be exact for up to groupsPrecisionThreshold groups, beyond
+// which it may deviate from the exact count by a few percent.
+func makeEsGroupsAgg() map[string]interface{} {
+	return map[string]interface{}{
+		"cardinality": map[string]interface{}{
+			"field":               "Host",
+			"missing":             "",
+			"precision_threshold": groupsPrecisionThreshold,
+		},
+	}
+}
@@ -0,0 +1,42 @@
+package es
+
+import (
+	"context"
+	"golang.org/x/xerrors"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// Complete searches the edge n-grams of title words that are indexed in the
+// TitleCompletion field for the candidate documents.
+func (e *ElasticSearchIndexer) Complete(ctx context.Context, prefix string, limit int) ([]index.Completion, error) {
+	words := index.CompletionWords(prefix)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match": map[string]interface{}{
+				"TitleCompletion": map[string]interface{}{
+					"query":    strings.Join(words, " "),
+					"operator": "and",
+				},
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"PageRank": map[string]interface{}{"order": "desc", "missing": "_last"}},
+			map[string]interface{}{"LinkID": "asc"},
+		},
+		"size":    index.MaxCompletionCandidates,
+		"_source": []string{"LinkID", "Title", "PageRank"},
+	}
+	searchRes, err := runSearch(ctx, e.es, e.alias, query)
+	if err != nil {
+		return nil, xerrors.Errorf("complete: %w", err)
+	}
+	candidates := make([]*index.Document, len(searchRes.Hits.HitList))
+	for i, hit := range searchRes.Hits.HitList {
+		candidates[i] = mapEsDoc(&hit.DocSource)
+	}
+	return index.MakeCompletions(prefix, candidates, limit), nil
+}
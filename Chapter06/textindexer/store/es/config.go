@@ -0,0 +1,57 @@
+package es
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// DefaultIndexName is the name of the alias used for accessing the index
+// when the configuration does not specify one.
+const DefaultIndexName = "textindexer"
+
+// Config encapsulates the settings for configuring the elasticsearch-backed
+// indexer.
+type Config struct {
+	// Nodes is the list of elasticsearch nodes to connect to.
+	Nodes []string
+
+	// SyncUpdates, if true, makes writes visible to searches before they
+	// return.
+	SyncUpdates bool
+
+	// IndexName is the name of the alias through which the indexer
+	// accesses its documents. The documents themselves are stored in
+	// versioned physical indices named "<alias>_v<version>". If not
+	// specified, DefaultIndexName will be used.
+	IndexName string
+
+	// IndexPrefix is an optional prefix for the alias and physical index
+	// names that allows multiple deployments to share a cluster.
+	IndexPrefix string
+
+	// Analysis controls the analysis of the Title and Content fields. It
+	// is only applied when creating a physical index; existing indices
+	// pick up changes to it when they are reindexed.
+	Analysis index.AnalysisConfig
+}
+
+func (cfg *Config) validate() error {
+	var err error
+	if len(cfg.Nodes) == 0 {
+		err = multierror.Append(err, xerrors.New("at least one elasticsearch node must be specified"))
+	}
+	if analysisErr := cfg.Analysis.Validate(); analysisErr != nil {
+		err = multierror.Append(err, analysisErr)
+	}
+	if cfg.IndexName == "" {
+		cfg.IndexName = DefaultIndexName
+	}
+
+	return err
+}
+
+// alias returns the name of the alias for accessing the index.
+func (cfg *Config) alias() string {
+	return cfg.IndexPrefix + cfg.IndexName
+}
@@ -9,18 +9,38 @@ import (
 	"github.com/elastic/go-elasticsearch/esapi"
 	"github.com/google/uuid"
 	"golang.org/x/xerrors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"test_project/Chapter06/textindexer/index"
 	"time"
 )
 
-// The name of the elasticsearch index to use.
-const indexName = "textindexer"
+// The maximum number of documents sharing a fingerprint band that are
+// examined when looking for near-duplicates.
+const maxDuplicateCandidates = 1000
 
-// The size of each page of results that is cached locally by the iterator.
-const batchSize = 10
+// The number of documents to fetch per request when scanning the index.
+const scanBatchSize = 1000
 
-var _ index.Indexer = (*ElasticSearchIndexer)(nil)
+// esSortOrder orders search results by descending score with ties broken by
+// ascending link ID so that results can be paged using search_after.
+var esSortOrder = []interface{}{
+	map[string]interface{}{"_score": "desc"},
+	map[string]interface{}{"LinkID": "asc"},
+}
+
+var (
+	_ index.Indexer         = (*ElasticSearchIndexer)(nil)
+	_ index.DuplicateFinder = (*ElasticSearchIndexer)(nil)
+	_ index.Scanner         = (*ElasticSearchIndexer)(nil)
+	_ index.Restorer        = (*ElasticSearchIndexer)(nil)
+	_ index.Suggester       = (*ElasticSearchIndexer)(nil)
+	_ index.Completer       = (*ElasticSearchIndexer)(nil)
+	_ index.RelatedFinder   = (*ElasticSearchIndexer)(nil)
+)
 
 type esError struct {
 	Type   string `json:"type"`
@@ -30,12 +50,22 @@ type esErrorRes struct {
 	Error esError `json:"error"`
 }
 type esDoc struct {
-	LinkID    string    `json:"LinkID"`
-	URL       string    `json:"URL"`
-	Title     string    `json:"Title"`
-	Content   string    `json:"Content"`
-	IndexedAt time.Time `json:"IndexedAt"`
-	PageRank  float64   `json:"PageRank,omitempty"`
+	LinkID           string    `json:"LinkID"`
+	URL              string    `json:"URL"`
+	Host             string    `json:"Host,omitempty"`
+	Title            string    `json:"Title"`
+	Content          string    `json:"Content"`
+	IndexedAt        time.Time `json:"IndexedAt"`
+	Fingerprint      string    `json:"Fingerprint"`
+	FingerprintBands []string  `json:"FingerprintBands"`
+	PageRank         float64   `json:"PageRank,omitempty"`
+	Language         string    `json:"Language"`
+
+	// LocalizedContent holds a copy of Content keyed by the language of
+	// the document. The entries for other languages are explicitly set to
+	// null so that partial updates clear the copy of a previous version
+	// of the document that was written in a different language.
+	LocalizedContent map[string]interface{} `json:"LocalizedContent,omitempty"`
 }
 
 func (e esError) Error() string {
@@ -48,48 +78,110 @@ var esMappings = `
     "properties": {
       "LinkID": {"type": "keyword"},
       "URL": {"type": "keyword"},
-      "Content": {"type": "text"},
-      "Title": {"type": "text"},
+      "Host": {"type": "keyword"},
+      "Content": {"type": "text", "copy_to": ["Vocabulary", "VocabularyShingles"]},
+      "Title": {"type": "text", "copy_to": ["Vocabulary", "VocabularyShingles", "TitleCompletion"]},
+      "Vocabulary": {"type": "text"},
+      "VocabularyShingles": {"type": "text", "analyzer": "textindexer_shingles"},
+      "TitleCompletion": {"type": "text", "analyzer": "textindexer_completion", "search_analyzer": "standard"},
       "IndexedAt": {"type": "date"},
-      "PageRank": {"type": "double"}
+      "Fingerprint": {"type": "keyword", "index": false},
+      "FingerprintBands": {"type": "keyword"},
+      "PageRank": {"type": "double"},
+      "Language": {"type": "keyword"},
+      "LocalizedContent": {"properties": {}}
     }
   }
 }`
 
+// NewElasticSearchIndexer creates a text indexer that uses the default index
+// name on the specified elasticsearch nodes.
 func NewElasticSearchIndexer(esNodes []string, syncUpdates bool) (*ElasticSearchIndexer, error) {
-	cfg := elasticsearch.Config{
-		Addresses: esNodes,
+	return NewElasticSearchIndexerWithConfig(Config{
+		Nodes:       esNodes,
+		SyncUpdates: syncUpdates,
+	})
+}
+
+// NewElasticSearchIndexerWithConfig creates a text indexer using the provided
+// configuration. If the configured index alias does not exist, a new
+// versioned index is created for it.
+func NewElasticSearchIndexerWithConfig(cfg Config) (*ElasticSearchIndexer, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, xerrors.Errorf("elasticsearch indexer: config validation failed: %w", err)
 	}
-	es, err := elasticsearch.NewClient(cfg)
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: cfg.Nodes,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err = ensureIndex(es); err != nil {
-		return nil, err
+	refresh := "false"
+	if cfg.SyncUpdates {
+		refresh = "true"
 	}
 
-	refreshOpt := es.Update.WithRefresh("false")
-	if syncUpdates {
-		refreshOpt = es.Update.WithRefresh("true")
+	idx := &ElasticSearchIndexer{
+		es:       es,
+		alias:    cfg.alias(),
+		refresh:  refresh,
+		analysis: cfg.Analysis,
 	}
-
-	return &ElasticSearchIndexer{
-		es:         es,
-		refreshOpt: refreshOpt,
-	}, nil
+	if err = idx.ensureIndex(context.Background()); err != nil {
+		return nil, err
+	}
+	return idx, nil
 }
 
 type esUpdateRes struct {
-	Result string `json:"result"`
+	Result  string `json:"result"`
+	Index   string `json:"_index"`
+	Version int64  `json:"_version"`
+	Get     *esGet `json:"get,omitempty"`
+}
+
+// esGet holds the source of a document that is returned by a write request
+// asking for it.
+type esGet struct {
+	Source json.RawMessage `json:"_source"`
+}
+
+type esBulkRes struct {
+	Errors bool                    `json:"errors"`
+	Items  []map[string]esBulkItem `json:"items"`
+}
+
+type esBulkItem struct {
+	Index   string   `json:"_index"`
+	ID      string   `json:"_id"`
+	Version int64    `json:"_version"`
+	Status  int      `json:"status"`
+	Error   *esError `json:"error,omitempty"`
+	Get     *esGet   `json:"get,omitempty"`
+}
+
+type esDeleteByQueryRes struct {
+	Deleted uint64 `json:"deleted"`
 }
 
 type ElasticSearchIndexer struct {
-	es         *elasticsearch.Client
-	refreshOpt func(*esapi.UpdateRequest)
+	es *elasticsearch.Client
+
+	// alias is the name of the alias that points to the physical index
+	// holding the documents.
+	alias   string
+	refresh string
+
+	// analysis controls the analysis settings of newly created physical
+	// indices.
+	analysis index.AnalysisConfig
 }
 type esSearchRes struct {
-	Hits esSearchResHits `json:"hits"`
+	Hits         esSearchResHits             `json:"hits"`
+	Aggregations *esAggregations             `json:"aggregations,omitempty"`
+	Suggest      map[string][]esSuggestEntry `json:"suggest,omitempty"`
 }
 
 type esSearchResHits struct {
@@ -101,13 +193,21 @@ type esTotal struct {
 }
 
 type esHitWrapper struct {
-	DocSource esDoc `json:"_source"`
+	DocSource esDoc                  `json:"_source"`
+	Sort      []interface{}          `json:"sort,omitempty"`
+	Highlight map[string][]string    `json:"highlight,omitempty"`
+	InnerHits map[string]esInnerHits `json:"inner_hits,omitempty"`
 }
 
-func (e *ElasticSearchIndexer) Index(doc *index.Document) error {
+type esInnerHits struct {
+	Hits esSearchResHits `json:"hits"`
+}
+
+func (e *ElasticSearchIndexer) Index(ctx context.Context, doc *index.Document) error {
 	if doc.LinkID == uuid.Nil {
 		return xerrors.Errorf("index: %w", index.ErrMissingLinkID)
 	}
+	doc.Fingerprint = index.Fingerprint(doc.Content)
 	var (
 		buf   bytes.Buffer
 		esDoc = makeEsDoc(doc)
@@ -119,18 +219,13 @@ func (e *ElasticSearchIndexer) Index(doc *index.Document) error {
 	if err := json.NewEncoder(&buf).Encode(update); err != nil {
 		return xerrors.Errorf("index: %w", err)
 	}
-	res, err := e.es.Update(indexName, esDoc.LinkID, &buf, e.refreshOpt)
-	if err != nil {
-		return xerrors.Errorf("index: %w", err)
-	}
-	var updateRes esUpdateRes
-	if err = unmarshalResponse(res, &updateRes); err != nil {
+	if err := e.update(ctx, esDoc.LinkID, &buf); err != nil {
 		return xerrors.Errorf("index: %w", err)
 	}
 	return nil
 }
 
-func (e *ElasticSearchIndexer) FindByID(linkID uuid.UUID) (*index.Document, error) {
+func (e *ElasticSearchIndexer) FindByID(ctx context.Context, linkID uuid.UUID) (*index.Document, error) {
 	query := map[string]interface{}{
 		"query": map[string]interface{}{
 			"match": map[string]interface{}{
@@ -140,7 +235,7 @@ func (e *ElasticSearchIndexer) FindByID(linkID uuid.UUID) (*index.Document, erro
 		"from": 0,
 		"size": 1,
 	}
-	searchRes, err := runSearch(e.es, query)
+	searchRes, err := runSearch(ctx, e.es, e.alias, query)
 	if err != nil {
 		return nil, xerrors.Errorf("find by ID: %w", err)
 	}
@@ -150,43 +245,117 @@ func (e *ElasticSearchIndexer) FindByID(linkID uuid.UUID) (*index.Document, erro
 	return mapEsDoc(&searchRes.Hits.HitList[0].DocSource), nil
 }
 
-func (e *ElasticSearchIndexer) Search(q index.Query) (index.Iterator, error) {
-	var qtype string
-	switch q.Type {
-	case index.QueryTypePhrase:
-		qtype = "phrase"
-	default:
-		qtype = "best_fields"
+func (e *ElasticSearchIndexer) FindDuplicates(ctx context.Context, linkID uuid.UUID) ([]*index.Document, error) {
+	doc, err := e.FindByID(ctx, linkID)
+	if err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	return e.findDuplicates(ctx, doc)
+}
+
+// FindDuplicatesOf returns the near-duplicates of doc, which does not need to
+// be stored in the index. If the Fingerprint of doc is not set, it is
+// computed from its Content.
+func (e *ElasticSearchIndexer) FindDuplicatesOf(ctx context.Context, doc *index.Document) ([]*index.Document, error) {
+	dCopy := *doc
+	if dCopy.Fingerprint == 0 {
+		dCopy.Fingerprint = index.Fingerprint(dCopy.Content)
+	}
+	return e.findDuplicates(ctx, &dCopy)
+}
+
+func (e *ElasticSearchIndexer) findDuplicates(ctx context.Context, doc *index.Document) ([]*index.Document, error) {
+	if doc.Fingerprint == 0 {
+		return nil, nil
 	}
 	query := map[string]interface{}{
 		"query": map[string]interface{}{
-			"function_score": map[string]interface{}{
-				"query": map[string]interface{}{
-					"multi_match": map[string]interface{}{
-						"type":   qtype,
-						"query":  q.Expression,
-						"fields": []string{"Title", "Content"},
-					},
-				},
-				"script_score": map[string]interface{}{
-					"script": map[string]interface{}{
-						"source": "_score + doc['PageRank'].value",
-					},
-				},
+			"terms": map[string]interface{}{
+				"FingerprintBands": index.FingerprintBands(doc.Fingerprint),
 			},
 		},
-		"from": q.Offset,
-		"size": batchSize,
+		"size": maxDuplicateCandidates,
 	}
-	searchRes, err := runSearch(e.es, query)
+	searchRes, err := runSearch(ctx, e.es, e.alias, query)
 	if err != nil {
-		return nil, xerrors.Errorf("search: %w", err)
+		return nil, xerrors.Errorf("find duplicates: %w", err)
 	}
-	return &esIterator{es: e.es, searchReq: query, rs: searchRes, cumIdx: q.Offset}, nil
+	candidates := make([]*index.Document, len(searchRes.Hits.HitList))
+	for i, hit := range searchRes.Hits.HitList {
+		candidates[i] = mapEsDoc(&hit.DocSource)
+	}
+	return index.NearDuplicates(doc, candidates), nil
+}
 
+func (e *ElasticSearchIndexer) Search(ctx context.Context, q index.Query) (index.Iterator, error) {
+	esQuery, err := makeEsQuery(q)
+	if err != nil {
+		return nil, xerrors.Errorf("search: %w", err)
+	}
+	query := map[string]interface{}{
+		"query": esQuery,
+		"sort":  esSortOrder,
+		"size":  q.PageSizeOrDefault(),
+	}
+	aggs := make(map[string]interface{})
+	it := &esIterator{ctx: ctx, es: e.es, indexName: e.alias, searchReq: query}
+	switch {
+	case q.Collapse != nil:
+		start := index.GroupCursor{Group: q.Offset}
+		if q.Cursor != "" {
+			if start, err = index.DecodeGroupCursor(q.Cursor); err != nil {
+				return nil, xerrors.Errorf("search: %w", err)
+			}
+		}
+		// Collapsed results cannot be paged using search_after;
+		// offsets refer to host groups instead of documents.
+		query["from"] = start.Group
+		query["collapse"] = makeEsCollapse(*q.Collapse, q.Highlight)
+		aggs[groupsAgg] = makeEsGroupsAgg()
+		it.collapse, it.group, it.groupHitIdx = true, start.Group, int(start.Hit)
+	case q.Cursor != "":
+		c, err := index.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, xerrors.Errorf("search: %w", err)
+		}
+		query["search_after"] = []interface{}{c.Score, c.LinkID.String()}
+	default:
+		query["from"] = q.Offset
+	}
+	if q.Highlight != nil {
+		query["highlight"] = makeEsHighlight(*q.Highlight)
+	}
+	var facetOpts index.FacetOptions
+	if q.Facets != nil {
+		facetOpts = q.Facets.WithDefaults()
+		for name, agg := range makeEsAggs(facetOpts) {
+			aggs[name] = agg
+		}
+	}
+	if len(aggs) != 0 {
+		query["aggs"] = aggs
+	}
+	searchRes, err := runSearch(ctx, e.es, e.alias, query)
+	if err != nil {
+		return nil, xerrors.Errorf("search: %w", err)
+	}
+	it.rs, it.total = searchRes, searchRes.Hits.Total.Count
+	if q.Collapse != nil {
+		it.total = 0
+		if searchRes.Aggregations != nil {
+			it.total = searchRes.Aggregations.Groups.Value
+		}
+	}
+	if q.Facets != nil {
+		it.facets = mapEsAggs(searchRes.Aggregations, facetOpts)
+	}
+	// Aggregations only need to be calculated once; skip them when
+	// fetching subsequent result pages.
+	delete(query, "aggs")
+	return it, nil
 }
 
-func (e ElasticSearchIndexer) UpdateScore(linkID uuid.UUID, score float64) error {
+func (e *ElasticSearchIndexer) UpdateScore(ctx context.Context, linkID uuid.UUID, score float64) error {
 	var buf bytes.Buffer
 	update := map[string]interface{}{
 		"doc": map[string]interface{}{
@@ -198,34 +367,300 @@ func (e ElasticSearchIndexer) UpdateScore(linkID uuid.UUID, score float64) error
 	if err := json.NewEncoder(&buf).Encode(update); err != nil {
 		return xerrors.Errorf("update score: %w", err)
 	}
-	res, err := e.es.Update(indexName, linkID.String(), &buf, e.refreshOpt)
-	if err != nil {
+	if err := e.update(ctx, linkID.String(), &buf); err != nil {
 		return xerrors.Errorf("update score: %w", err)
 	}
+	return nil
+}
+
+// update applies a partial document update to the document with the
+// specified ID and mirrors the resulting document to the index that a running
+// Reindex copies the documents to.
+func (e *ElasticSearchIndexer) update(ctx context.Context, id string, body io.Reader) error {
+	res, err := e.es.Update(
+		e.alias, id, body,
+		e.es.Update.WithContext(ctx),
+		e.es.Update.WithRefresh(e.refresh),
+		e.es.Update.WithSource("true"),
+	)
+	if err != nil {
+		return err
+	}
 	var updateRes esUpdateRes
 	if err = unmarshalResponse(res, &updateRes); err != nil {
-		return xerrors.Errorf("update score: %w", err)
+		return err
+	}
+	written := writtenDoc{index: updateRes.Index, id: id, version: updateRes.Version}
+	if updateRes.Get != nil {
+		written.source = updateRes.Get.Source
+	}
+	return e.mirrorWrites(ctx, []writtenDoc{written})
+}
+func (e *ElasticSearchIndexer) IndexMany(ctx context.Context, docs []*index.Document) error {
+	var (
+		bulkErr index.BulkError
+		updates []bulkUpdate
+	)
+	for pos, doc := range docs {
+		if doc.LinkID == uuid.Nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, Err: index.ErrMissingLinkID})
+			continue
+		}
+		doc.Fingerprint = index.Fingerprint(doc.Content)
+		updates = append(updates, bulkUpdate{
+			pos:    pos,
+			linkID: doc.LinkID,
+			doc:    makeEsDoc(doc),
+		})
+	}
+	if err := e.runBulkUpdate(ctx, updates, &bulkErr); err != nil {
+		return xerrors.Errorf("index many: %w", err)
+	}
+	if len(bulkErr.Items) != 0 {
+		return xerrors.Errorf("index many: %w", &bulkErr)
+	}
+	return nil
+}
+
+func (e *ElasticSearchIndexer) UpdateScores(ctx context.Context, scores []index.ScoreUpdate) error {
+	var (
+		bulkErr index.BulkError
+		updates = make([]bulkUpdate, len(scores))
+	)
+	for pos, score := range scores {
+		updates[pos] = bulkUpdate{
+			pos:    pos,
+			linkID: score.LinkID,
+			doc: map[string]interface{}{
+				"LinkID":   score.LinkID.String(),
+				"PageRank": score.Score,
+			},
+		}
+	}
+	if err := e.runBulkUpdate(ctx, updates, &bulkErr); err != nil {
+		return xerrors.Errorf("update scores: %w", err)
+	}
+	if len(bulkErr.Items) != 0 {
+		return xerrors.Errorf("update scores: %w", &bulkErr)
 	}
 	return nil
 }
-func ensureIndex(es *elasticsearch.Client) error {
-	mappingsReader := strings.NewReader(esMappings)
-	res, err := es.Indices.Create(indexName, es.Indices.Create.WithBody(mappingsReader))
+
+// bulkUpdate describes a partial document update that is submitted as part
+// of a bulk request.
+type bulkUpdate struct {
+	// The position of the update in the input of the bulk operation.
+	pos    int
+	linkID uuid.UUID
+	doc    interface{}
+
+	// replace, if set, replaces the entire document instead of merging
+	// doc into it.
+	replace bool
+}
+
+// runBulkUpdate upserts the provided partial documents using the ES _bulk
+// API. Any updates that could not be applied are appended to bulkErr.
+func (e *ElasticSearchIndexer) runBulkUpdate(ctx context.Context, updates []bulkUpdate, bulkErr *index.BulkError) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, update := range updates {
+		meta := map[string]interface{}{"_index": e.alias, "_id": update.linkID.String()}
+		var action, body map[string]interface{}
+		if update.replace {
+			action = map[string]interface{}{"index": meta}
+		} else {
+			action = map[string]interface{}{"update": meta}
+			body = map[string]interface{}{
+				"doc":           update.doc,
+				"doc_as_upsert": true,
+				"_source":       true,
+			}
+		}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if body == nil {
+			if err := enc.Encode(update.doc); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := enc.Encode(body); err != nil {
+			return err
+		}
+	}
+
+	res, err := e.es.Bulk(&buf, e.es.Bulk.WithContext(ctx), e.es.Bulk.WithRefresh(e.refresh))
 	if err != nil {
-		return xerrors.Errorf("cannot create ES index: %w", err)
-	} else if res.IsError() {
-		err := unmarshalError(res)
-		if esErr, valid := err.(esError); valid && esErr.Type == "resource_already_exists_exception" {
-			return nil
+		return err
+	}
+	var bulkRes esBulkRes
+	if err = unmarshalResponse(res, &bulkRes); err != nil {
+		return err
+	}
+
+	// Items in the response are listed in the same order as the actions
+	// in the request.
+	var written []writtenDoc
+	for i, item := range bulkRes.Items {
+		if i >= len(updates) {
+			break
+		}
+		for _, result := range item {
+			if result.Error != nil {
+				bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: updates[i].pos, LinkID: updates[i].linkID, Err: *result.Error})
+				continue
+			}
+			doc := writtenDoc{index: result.Index, id: result.ID, version: result.Version}
+			if result.Get != nil {
+				doc.source = result.Get.Source
+			} else if doc.source, err = json.Marshal(updates[i].doc); err != nil {
+				return err
+			}
+			written = append(written, doc)
 		}
-		return xerrors.Errorf("cannot create ES index: %w", err)
 	}
+	sort.Slice(bulkErr.Items, func(l, r int) bool { return bulkErr.Items[l].Index < bulkErr.Items[r].Index })
+	return e.mirrorWrites(ctx, written)
+}
 
+func (e *ElasticSearchIndexer) Scan(ctx context.Context) (index.DocumentIterator, error) {
+	query := map[string]interface{}{
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+		"sort":  []interface{}{map[string]interface{}{"LinkID": "asc"}},
+		"size":  scanBatchSize,
+	}
+	searchRes, err := runSearch(ctx, e.es, e.alias, query)
+	if err != nil {
+		return nil, xerrors.Errorf("scan: %w", err)
+	}
+	return &esIterator{ctx: ctx, es: e.es, indexName: e.alias, searchReq: query, rs: searchRes}, nil
+}
+
+func (e *ElasticSearchIndexer) Restore(ctx context.Context, docs []*index.Document) error {
+	var (
+		bulkErr index.BulkError
+		updates []bulkUpdate
+	)
+	for pos, doc := range docs {
+		if doc.LinkID == uuid.Nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, Err: index.ErrMissingLinkID})
+			continue
+		}
+		dCopy := *doc
+		dCopy.Fingerprint = index.Fingerprint(dCopy.Content)
+		esDoc := makeEsDoc(&dCopy)
+		esDoc.PageRank = dCopy.PageRank
+		updates = append(updates, bulkUpdate{
+			pos:     pos,
+			linkID:  doc.LinkID,
+			doc:     esDoc,
+			replace: true,
+		})
+	}
+	if err := e.runBulkUpdate(ctx, updates, &bulkErr); err != nil {
+		return xerrors.Errorf("restore: %w", err)
+	}
+	if len(bulkErr.Items) != 0 {
+		return xerrors.Errorf("restore: %w", &bulkErr)
+	}
 	return nil
 }
-func unmarshalError(res *esapi.Response) error {
-	return unmarshalResponse(res, nil)
+
+func (e *ElasticSearchIndexer) Delete(ctx context.Context, linkID uuid.UUID) error {
+	res, err := e.es.Delete(e.alias, linkID.String(), e.es.Delete.WithContext(ctx), e.es.Delete.WithRefresh(e.refresh))
+	if err != nil {
+		return xerrors.Errorf("delete: %w", err)
+	}
+	if res.StatusCode == http.StatusNotFound {
+		_ = res.Body.Close()
+		return xerrors.Errorf("delete: %w", index.ErrNotFound)
+	}
+	var deleteRes esUpdateRes
+	if err = unmarshalResponse(res, &deleteRes); err != nil {
+		return xerrors.Errorf("delete: %w", err)
+	}
+	written := writtenDoc{index: deleteRes.Index, id: linkID.String(), version: deleteRes.Version}
+	if err = e.mirrorWrites(ctx, []writtenDoc{written}); err != nil {
+		return xerrors.Errorf("delete: %w", err)
+	}
+	return nil
+}
+
+func (e *ElasticSearchIndexer) Expire(ctx context.Context, indexedBefore time.Time) (uint64, error) {
+	// Documents that were created by UpdateScore do not have an IndexedAt
+	// field and are also considered to be expired.
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []map[string]interface{}{
+					{
+						"range": map[string]interface{}{
+							"IndexedAt": map[string]interface{}{
+								"lt": indexedBefore.UTC(),
+							},
+						},
+					},
+					{
+						"bool": map[string]interface{}{
+							"must_not": map[string]interface{}{
+								"exists": map[string]interface{}{"field": "IndexedAt"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	deleted, err := e.deleteByQuery(ctx, e.alias, query)
+	if err != nil {
+		return 0, xerrors.Errorf("expire: %w", err)
+	}
+
+	// Deletions cannot be mirrored document by document, so the expired
+	// documents are also removed from the index that a running Reindex
+	// copies the documents to. Documents that are copied after this point
+	// are removed by the next call to Expire.
+	_, next, err := e.writeTargets(ctx)
+	if err != nil {
+		return deleted, xerrors.Errorf("expire: %w", err)
+	} else if next != "" {
+		if _, err = e.deleteByQuery(ctx, next, query); err != nil {
+			return deleted, xerrors.Errorf("expire: %w", err)
+		}
+	}
+	return deleted, nil
+}
+
+// deleteByQuery removes the documents of indexName that match query and
+// returns the number of removed documents.
+func (e *ElasticSearchIndexer) deleteByQuery(ctx context.Context, indexName string, query map[string]interface{}) (uint64, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+		return 0, err
+	}
+	res, err := e.es.DeleteByQuery(
+		[]string{indexName},
+		&buf,
+		e.es.DeleteByQuery.WithContext(ctx),
+		e.es.DeleteByQuery.WithRefresh(e.refresh == "true"),
+		e.es.DeleteByQuery.WithConflicts("proceed"),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var deleteRes esDeleteByQueryRes
+	if err = unmarshalResponse(res, &deleteRes); err != nil {
+		return 0, err
+	}
+	return deleteRes.Deleted, nil
 }
+
 func unmarshalResponse(res *esapi.Response, to interface{}) error {
 	defer func() { _ = res.Body.Close() }()
 
@@ -241,24 +676,27 @@ func unmarshalResponse(res *esapi.Response, to interface{}) error {
 	return json.NewDecoder(res.Body).Decode(to)
 }
 func mapEsDoc(d *esDoc) *index.Document {
+	fingerprint, _ := strconv.ParseUint(d.Fingerprint, 16, 64)
 	return &index.Document{
-		LinkID:    uuid.MustParse(d.LinkID),
-		URL:       d.URL,
-		Title:     d.Title,
-		Content:   d.Content,
-		IndexedAt: d.IndexedAt.UTC(),
-		PageRank:  d.PageRank,
+		LinkID:      uuid.MustParse(d.LinkID),
+		URL:         d.URL,
+		Title:       d.Title,
+		Content:     d.Content,
+		IndexedAt:   d.IndexedAt.UTC(),
+		Fingerprint: fingerprint,
+		PageRank:    d.PageRank,
+		Language:    d.Language,
 	}
 }
-func runSearch(es *elasticsearch.Client, searchQuery map[string]interface{}) (*esSearchRes, error) {
+func runSearch(ctx context.Context, es *elasticsearch.Client, indexName string, searchQuery map[string]interface{}) (*esSearchRes, error) {
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
-		return nil, xerrors.Errorf("find by ID: %w", err)
+		return nil, xerrors.Errorf("search: %w", err)
 	}
 
 	// Perform the search request.
 	res, err := es.Search(
-		es.Search.WithContext(context.Background()),
+		es.Search.WithContext(ctx),
 		es.Search.WithIndex(indexName),
 		es.Search.WithBody(&buf),
 	)
@@ -274,14 +712,67 @@ func runSearch(es *elasticsearch.Client, searchQuery map[string]interface{}) (*e
 	return &esRes, nil
 }
 
+func makeEsHighlight(opts index.HighlightOptions) map[string]interface{} {
+	opts = opts.WithDefaults()
+	return map[string]interface{}{
+		"fields": map[string]interface{}{
+			"Title":                      map[string]interface{}{},
+			"Content":                    map[string]interface{}{},
+			localizedContentPrefix + "*": map[string]interface{}{},
+		},
+		"fragment_size":       opts.FragmentSize,
+		"number_of_fragments": opts.NumFragments,
+		"pre_tags":            []string{opts.PreTag},
+		"post_tags":           []string{opts.PostTag},
+	}
+}
+
+// mapEsHighlights converts the highlighted fields of a hit. Highlights of the
+// localized content fields are reported as Content highlights.
+func mapEsHighlights(h map[string][]string) *index.Highlights {
+	highlights := &index.Highlights{
+		Title:   h["Title"],
+		Content: h["Content"],
+	}
+	for field, fragments := range h {
+		if strings.HasPrefix(field, localizedContentPrefix) && len(highlights.Content) == 0 {
+			highlights.Content = fragments
+		}
+	}
+	return highlights
+}
+
 func makeEsDoc(d *index.Document) esDoc {
 	// Note: we intentionally skip PageRank as we don't want updates to
-	// overwrite existing PageRank values.
+	// overwrite existing PageRank values. FingerprintBands is always
+	// present so that the bands of a previous version of the document are
+	// cleared when its content becomes empty.
+	bands := []string{}
+	if d.Fingerprint != 0 {
+		bands = index.FingerprintBands(d.Fingerprint)
+	}
 	return esDoc{
-		LinkID:    d.LinkID.String(),
-		URL:       d.URL,
-		Title:     d.Title,
-		Content:   d.Content,
-		IndexedAt: d.IndexedAt.UTC(),
+		LinkID:           d.LinkID.String(),
+		URL:              d.URL,
+		Host:             index.URLHost(d.URL),
+		Title:            d.Title,
+		Content:          d.Content,
+		IndexedAt:        d.IndexedAt.UTC(),
+		Fingerprint:      strconv.FormatUint(d.Fingerprint, 16),
+		FingerprintBands: bands,
+		Language:         d.Language,
+		LocalizedContent: makeLocalizedContent(d),
+	}
+}
+
+// makeLocalizedContent returns the LocalizedContent value for d.
+func makeLocalizedContent(d *index.Document) map[string]interface{} {
+	localized := make(map[string]interface{})
+	for _, language := range index.SupportedLanguages() {
+		localized[language] = nil
+		if language == d.Language {
+			localized[language] = d.Content
+		}
 	}
+	return localized
 }
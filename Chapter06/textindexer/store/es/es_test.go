@@ -1,18 +1,28 @@
 package es
 
 import (
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
 	gc "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"os"
 	"strings"
+	"test_project/Chapter06/textindexer/index"
 	"test_project/Chapter06/textindexer/index/indextest"
 	"testing"
+	"time"
 )
 
 var _ = gc.Suite(new(ElasticsearchTestSuite))
 
 type ElasticsearchTestSuite struct {
 	indextest.SuiteBase
-	idx *ElasticSearchIndexer
+	idx   *ElasticSearchIndexer
+	nodes []string
 }
 
 func Test(t *testing.T) {
@@ -24,17 +34,181 @@ func (s *ElasticsearchTestSuite) SetUpSuite(c *gc.C) {
 	if nodeList == "" {
 		c.Skip("Missing ES_NODES envvar; skipping elasticsearch-backed index test suite")
 	}
-	idx, err := NewElasticSearchIndexer(strings.Split(nodeList, ","), true)
+	s.nodes = strings.Split(nodeList, ",")
+	idx, err := NewElasticSearchIndexer(s.nodes, true)
 	c.Assert(err, gc.IsNil)
 	s.SetIndexer(idx)
+	s.SetAnalyzedIndexerFactory(func(analysis index.AnalysisConfig) (index.Indexer, error) {
+		idx, err := NewElasticSearchIndexerWithConfig(Config{
+			Nodes:       s.nodes,
+			SyncUpdates: true,
+			IndexPrefix: "test_",
+			IndexName:   "analyzed",
+			Analysis:    analysis,
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Start from an empty index that uses the requested analysis.
+		indices, err := idx.aliasedIndices(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		res, err := idx.es.Indices.Delete(indices)
+		if err != nil {
+			return nil, err
+		} else if err = checkResponse(res); err != nil {
+			return nil, err
+		}
+		if err = idx.ensureIndex(context.TODO()); err != nil {
+			return nil, err
+		}
+		return idx, nil
+	})
 	s.idx = idx
 }
 
 func (s *ElasticsearchTestSuite) SetUpTest(c *gc.C) {
 	if s.idx.es != nil {
-		_, err := s.idx.es.Indices.Delete([]string{indexName})
-		c.Assert(err, gc.IsNil)
-		err = ensureIndex(s.idx.es)
-		c.Assert(err, gc.IsNil)
+		deleteAliasedIndices(c, s.idx)
+		c.Assert(s.idx.ensureIndex(context.TODO()), gc.IsNil)
 	}
 }
+
+func (s *ElasticsearchTestSuite) TestReindex(c *gc.C) {
+	doc := &index.Document{
+		LinkID:    uuid.New(),
+		URL:       "http://example.com",
+		Title:     "Illustrious examples",
+		Content:   "Lorem ipsum dolor",
+		IndexedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	c.Assert(s.idx.Index(context.TODO(), doc), gc.IsNil)
+	c.Assert(s.idx.UpdateScore(context.TODO(), doc.LinkID, 0.5), gc.IsNil)
+
+	newIndex, err := s.idx.Reindex(context.TODO())
+	c.Assert(err, gc.IsNil)
+	c.Assert(newIndex, gc.Equals, DefaultIndexName+"_v2")
+
+	indices, err := s.idx.aliasedIndices(context.TODO())
+	c.Assert(err, gc.IsNil)
+	c.Assert(indices, gc.DeepEquals, []string{newIndex})
+
+	got, err := s.idx.FindByID(context.TODO(), doc.LinkID)
+	c.Assert(err, gc.IsNil)
+	doc.PageRank = 0.5
+	c.Assert(got, gc.DeepEquals, doc)
+
+	// The indexer keeps working against the new index.
+	c.Assert(s.idx.UpdateScore(context.TODO(), doc.LinkID, 0.75), gc.IsNil)
+	got, err = s.idx.FindByID(context.TODO(), doc.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.PageRank, gc.Equals, 0.75)
+}
+
+func (s *ElasticsearchTestSuite) TestReindexWithConcurrentWrites(c *gc.C) {
+	cfg := Config{Nodes: s.nodes, SyncUpdates: true, IndexPrefix: "test_", IndexName: "concurrent"}
+	other, err := NewElasticSearchIndexerWithConfig(cfg)
+	c.Assert(err, gc.IsNil)
+	defer deleteAliasedIndices(c, other)
+
+	var (
+		updated = &index.Document{LinkID: uuid.New(), Title: "Updated", Content: "Lorem ipsum"}
+		deleted = &index.Document{LinkID: uuid.New(), Title: "Deleted", Content: "Lorem ipsum"}
+		created = &index.Document{LinkID: uuid.New(), Title: "Created", Content: "Lorem ipsum"}
+	)
+	c.Assert(other.IndexMany(context.TODO(), []*index.Document{updated, deleted}), gc.IsNil)
+
+	// Route the requests of the reindexing instance through a proxy that
+	// lets another instance write to the index after the documents have
+	// been copied but before the alias is swapped.
+	nodeURL, err := url.Parse(s.nodes[0])
+	c.Assert(err, gc.IsNil)
+	node := httputil.NewSingleHostReverseProxy(nodeURL)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/_aliases" {
+			c.Check(other.UpdateScore(context.TODO(), updated.LinkID, 0.9), gc.IsNil)
+			c.Check(other.Delete(context.TODO(), deleted.LinkID), gc.IsNil)
+			c.Check(other.Index(context.TODO(), created), gc.IsNil)
+		}
+		node.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	cfg.Nodes = []string{proxy.URL}
+	idx, err := NewElasticSearchIndexerWithConfig(cfg)
+	c.Assert(err, gc.IsNil)
+	newIndex, err := idx.Reindex(context.TODO())
+	c.Assert(err, gc.IsNil)
+
+	indices, err := other.aliasedIndices(context.TODO())
+	c.Assert(err, gc.IsNil)
+	c.Assert(indices, gc.DeepEquals, []string{newIndex})
+
+	got, err := other.FindByID(context.TODO(), updated.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.PageRank, gc.Equals, 0.9)
+	_, err = other.FindByID(context.TODO(), deleted.LinkID)
+	c.Assert(xerrors.Is(err, index.ErrNotFound), gc.Equals, true, gc.Commentf("%v", err))
+	_, err = other.FindByID(context.TODO(), created.LinkID)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *ElasticsearchTestSuite) TestMigrateUnversionedIndex(c *gc.C) {
+	cfg := Config{Nodes: s.nodes, SyncUpdates: true, IndexPrefix: "test_", IndexName: "legacy"}
+	legacyName := cfg.IndexPrefix + cfg.IndexName
+
+	// Simulate an index created by an older version of the indexer.
+	_, err := s.idx.es.Indices.Delete([]string{legacyName, legacyName + "_v1"})
+	c.Assert(err, gc.IsNil)
+	legacy := &ElasticSearchIndexer{es: s.idx.es, alias: legacyName, refresh: "true"}
+	body, err := legacy.makeIndexBody("", nil)
+	c.Assert(err, gc.IsNil)
+	res, err := s.idx.es.Indices.Create(legacyName, s.idx.es.Indices.Create.WithBody(body))
+	c.Assert(err, gc.IsNil)
+	c.Assert(checkResponse(res), gc.IsNil)
+	linkID := uuid.New()
+	c.Assert(legacy.Index(context.TODO(), &index.Document{LinkID: linkID, Title: "legacy"}), gc.IsNil)
+
+	idx, err := NewElasticSearchIndexerWithConfig(cfg)
+	c.Assert(err, gc.IsNil)
+	defer deleteAliasedIndices(c, idx)
+
+	indices, err := idx.aliasedIndices(context.TODO())
+	c.Assert(err, gc.IsNil)
+	c.Assert(indices, gc.DeepEquals, []string{legacyName + "_v1"})
+	got, err := idx.FindByID(context.TODO(), linkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.Title, gc.Equals, "legacy")
+}
+
+func (s *ElasticsearchTestSuite) TestSuggestUsesNeighbouringWords(c *gc.C) {
+	docs := []*index.Document{
+		{LinkID: uuid.New(), Content: "The quick brown fox"},
+		{LinkID: uuid.New(), Content: "Brawn beats brains"},
+		{LinkID: uuid.New(), Content: "All brawn and no brains"},
+	}
+	c.Assert(s.idx.IndexMany(context.TODO(), docs), gc.IsNil)
+
+	// On its own, the misspelled word is corrected to the equally similar
+	// term that occurs in more documents.
+	got, err := s.idx.Suggest(context.TODO(), "brwn")
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, gc.Equals, "brawn")
+
+	// Next to "quick", the term that follows it in the indexed text wins.
+	got, err = s.idx.Suggest(context.TODO(), "Quick brwn fox")
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, gc.Equals, "Quick brown fox")
+}
+
+func deleteAliasedIndices(c *gc.C, idx *ElasticSearchIndexer) {
+	indices, err := idx.aliasedIndices(context.TODO())
+	c.Assert(err, gc.IsNil)
+	if len(indices) == 0 {
+		return
+	}
+	res, err := idx.es.Indices.Delete(indices)
+	c.Assert(err, gc.IsNil)
+	c.Assert(checkResponse(res), gc.IsNil)
+}
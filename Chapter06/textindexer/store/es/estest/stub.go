@@ -0,0 +1,115 @@
+// Package estest provides a stub elasticsearch node for testing how the
+// elasticsearch-backed indexer handles specific responses, e.g. failures that
+// are hard to provoke on a live cluster.
+//
+// The stub does not implement any elasticsearch behavior: it answers each
+// request with the canned response that was registered for its method and
+// path and records the requests that it receives. The behavior of the indexer
+// itself is tested against a live cluster via the ES_NODES envvar.
+package estest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Request describes a request that was received by a Stub.
+type Request struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// response is a canned response of a Stub.
+type response struct {
+	status int
+	body   string
+}
+
+// Stub is an HTTP server that stands in for an elasticsearch node.
+type Stub struct {
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	responses map[string]response
+	requests  []Request
+}
+
+// NewStub starts a new stub. Callers must invoke Close once the stub is no
+// longer needed.
+func NewStub() *Stub {
+	s := &Stub{responses: make(map[string]response)}
+	s.srv = httptest.NewServer(s)
+	return s
+}
+
+// URL returns the address of the stub in a form that can be passed to the
+// elasticsearch client as a node address.
+func (s *Stub) URL() string {
+	return s.srv.URL
+}
+
+// Close shuts down the stub.
+func (s *Stub) Close() {
+	s.srv.Close()
+}
+
+// Handle registers the status and JSON body of the response to requests with
+// the specified method and path, replacing any previously registered
+// response.
+func (s *Stub) Handle(method, path string, status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[method+" "+path] = response{status: status, body: body}
+}
+
+// HandleError registers an elasticsearch error response with the specified
+// status and error type for requests with the specified method and path.
+func (s *Stub) HandleError(method, path string, status int, errType string) {
+	s.Handle(method, path, status, fmt.Sprintf(
+		`{"error":{"root_cause":[{"type":%q,"reason":"stub"}],"type":%q,"reason":"stub"},"status":%d}`,
+		errType, errType, status,
+	))
+}
+
+// Requests returns the requests received so far in the order of their
+// arrival.
+func (s *Stub) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// ResetRequests forgets the requests received so far.
+func (s *Stub) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// ServeHTTP implements http.Handler. Requests without a registered response
+// fail with an elasticsearch error response.
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Body: string(body)})
+	res, exists := s.responses[r.Method+" "+r.URL.Path]
+	s.mu.Unlock()
+	if !exists {
+		res = response{
+			status: http.StatusBadRequest,
+			body: fmt.Sprintf(
+				`{"error":{"type":"illegal_argument_exception","reason":"no stub response for [%s %s]"},"status":400}`,
+				r.Method, r.URL.Path,
+			),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(res.status)
+	_, _ = w.Write([]byte(res.body))
+}
@@ -0,0 +1,144 @@
+package es
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"test_project/Chapter06/textindexer/index"
+	"time"
+)
+
+type esAggregations struct {
+	Hosts struct {
+		Buckets []esTermBucket `json:"buckets"`
+	} `json:"hosts"`
+	IndexedAt struct {
+		Histogram struct {
+			Buckets []esDateBucket `json:"buckets"`
+		} `json:"histogram"`
+	} `json:"indexedAt"`
+	PageRank struct {
+		Buckets []esRangeBucket `json:"buckets"`
+	} `json:"pageRank"`
+	Groups struct {
+		Value uint64 `json:"value"`
+	} `json:"groups"`
+}
+
+type esTermBucket struct {
+	Key      string `json:"key"`
+	DocCount uint64 `json:"doc_count"`
+}
+
+type esDateBucket struct {
+	// Key is the bucket start time in milliseconds since the epoch.
+	Key      int64  `json:"key"`
+	DocCount uint64 `json:"doc_count"`
+}
+
+type esRangeBucket struct {
+	Key      string `json:"key"`
+	DocCount uint64 `json:"doc_count"`
+}
+
+// makeEsAggs returns the aggregations for calculating the facets described by
+// opts. The options must have their defaults applied and the same options
+// must be passed to mapEsAggs when processing the search results.
+func makeEsAggs(opts index.FacetOptions) map[string]interface{} {
+	dateRanges := opts.DateRanges()
+	pageRankRanges := make([]interface{}, len(opts.PageRankRanges))
+	for i, r := range opts.PageRankRanges {
+		esRange := map[string]interface{}{"key": strconv.Itoa(i), "from": r.Min}
+		if r.Max != 0 {
+			esRange["to"] = r.Max
+		}
+		pageRankRanges[i] = esRange
+	}
+
+	return map[string]interface{}{
+		"hosts": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"field": "Host",
+				// Request an extra host as documents without a URL
+				// have an empty host that gets filtered out.
+				"size": opts.HostSize + 1,
+			},
+		},
+		// Restrict the histogram to the requested buckets so that
+		// documents with old IndexedAt values do not generate a large
+		// number of buckets.
+		"indexedAt": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"range": map[string]interface{}{
+					"IndexedAt": map[string]interface{}{
+						"gte": dateRanges[0].Start,
+						"lt":  dateRanges[len(dateRanges)-1].End,
+					},
+				},
+			},
+			"aggs": map[string]interface{}{
+				"histogram": map[string]interface{}{
+					"date_histogram": map[string]interface{}{
+						"field":          "IndexedAt",
+						"fixed_interval": fmt.Sprintf("%dms", opts.DateInterval/time.Millisecond),
+						"min_doc_count":  1,
+					},
+				},
+			},
+		},
+		// Documents whose score was never updated are stored without a
+		// PageRank field; count them as zero like the bleve indexers do.
+		"pageRank": map[string]interface{}{
+			"range": map[string]interface{}{
+				"field":   "PageRank",
+				"ranges":  pageRankRanges,
+				"missing": 0,
+			},
+		},
+	}
+}
+
+// mapEsAggs converts the aggregation results for a search request prepared
+// by makeEsAggs into an index.Facets instance.
+func mapEsAggs(aggs *esAggregations, opts index.FacetOptions) *index.Facets {
+	facets := &index.Facets{
+		IndexedAt: make([]index.DateCount, 0, opts.DateBuckets),
+		PageRank:  make([]index.PageRankCount, len(opts.PageRankRanges)),
+	}
+	if aggs == nil {
+		aggs = new(esAggregations)
+	}
+
+	hostBuckets := aggs.Hosts.Buckets
+	sort.Slice(hostBuckets, func(i, j int) bool {
+		if hostBuckets[i].DocCount == hostBuckets[j].DocCount {
+			return hostBuckets[i].Key < hostBuckets[j].Key
+		}
+		return hostBuckets[i].DocCount > hostBuckets[j].DocCount
+	})
+	for _, b := range hostBuckets {
+		if b.Key == "" || len(facets.Hosts) == opts.HostSize {
+			continue
+		}
+		facets.Hosts = append(facets.Hosts, index.HostCount{Host: b.Key, Count: b.DocCount})
+	}
+
+	dateCounts := make(map[int64]uint64)
+	for _, b := range aggs.IndexedAt.Histogram.Buckets {
+		dateCounts[b.Key] = b.DocCount
+	}
+	for _, r := range opts.DateRanges() {
+		key := r.Start.UnixNano() / int64(time.Millisecond)
+		facets.IndexedAt = append(facets.IndexedAt, index.DateCount{DateRange: r, Count: dateCounts[key]})
+	}
+
+	pageRankCounts := make(map[string]uint64)
+	for _, b := range aggs.PageRank.Buckets {
+		pageRankCounts[b.Key] = b.DocCount
+	}
+	for i, r := range opts.PageRankRanges {
+		facets.PageRank[i] = index.PageRankCount{PageRankRange: r, Count: pageRankCounts[strconv.Itoa(i)]}
+	}
+
+	return facets
+}
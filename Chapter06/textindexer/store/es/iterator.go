@@ -1,54 +1,141 @@
 package es
 
 import (
+	"context"
 	"github.com/elastic/go-elasticsearch"
+	"github.com/google/uuid"
 	"test_project/Chapter06/textindexer/index"
 )
 
 // esIterator implements index.Iterator.
 type esIterator struct {
+	ctx       context.Context
 	es        *elasticsearch.Client
+	indexName string
 	searchReq map[string]interface{}
 
-	cumIdx uint64
-	rsIdx  int
-	rs     *esSearchRes
+	rsIdx int
+	rs    *esSearchRes
 
-	latchedDoc *index.Document
-	lastErr    error
+	// total is the number of matching documents reported by the initial
+	// search request.
+	total uint64
+
+	latchedDoc        *index.Document
+	latchedHighlights *index.Highlights
+	latchedCursor     string
+	latchedScore      float64
+	lastErr           error
+
+	// facets is only set when the query requested facets.
+	facets *index.Facets
+
+	// When collapsing results by host, each hit of the result pages
+	// holds the documents of a host group as inner hits. group is the
+	// position of the current group and groupHitIdx is the number of its
+	// documents that were returned so far.
+	collapse         bool
+	group            uint64
+	groupHitIdx      int
+	latchedCollapsed uint64
+
+	// firstPageOnly is set when the results are limited to the first
+	// page of the search request.
+	firstPageOnly bool
 }
 
 // Close the iterator and release any allocated resources.
 func (it *esIterator) Close() error {
+	it.ctx = nil
 	it.es = nil
 	it.searchReq = nil
-	it.cumIdx = it.rs.Hits.Total.Count
+	it.rs = nil
 	return nil
 }
 
 // Next loads the next document matching the search query.
 // It returns false if no more documents are available.
 func (it *esIterator) Next() bool {
-	if it.lastErr != nil || it.rs == nil || it.cumIdx >= it.rs.Hits.Total.Count {
+	if it.lastErr != nil || it.rs == nil {
 		return false
 	}
+	if it.collapse {
+		return it.nextCollapsed()
+	}
 
 	// Do we need to fetch the next batch?
 	if it.rsIdx >= len(it.rs.Hits.HitList) {
-		it.searchReq["from"] = it.searchReq["from"].(uint64) + batchSize
-		if it.rs, it.lastErr = runSearch(it.es, it.searchReq); it.lastErr != nil {
+		// A partial page indicates that there are no more results.
+		if it.firstPageOnly || len(it.rs.Hits.HitList) < it.searchReq["size"].(int) {
+			return false
+		}
+		delete(it.searchReq, "from")
+		it.searchReq["search_after"] = it.rs.Hits.HitList[it.rsIdx-1].Sort
+		if !it.fetchPage() {
 			return false
 		}
-
-		it.rsIdx = 0
 	}
 
-	it.latchedDoc = mapEsDoc(&it.rs.Hits.HitList[it.rsIdx].DocSource)
-	it.cumIdx++
+	hit := &it.rs.Hits.HitList[it.rsIdx]
+	it.latchHit(hit)
+	it.latchedCursor = makeHitCursor(hit)
 	it.rsIdx++
 	return true
 }
 
+// nextCollapsed loads the next document of a search that collapses results
+// by host.
+func (it *esIterator) nextCollapsed() bool {
+	for {
+		if it.rsIdx >= len(it.rs.Hits.HitList) {
+			// A partial page indicates that there are no more
+			// groups.
+			if len(it.rs.Hits.HitList) < it.searchReq["size"].(int) {
+				return false
+			}
+			it.searchReq["from"] = it.group
+			if !it.fetchPage() {
+				return false
+			}
+		}
+
+		groupHits := it.rs.Hits.HitList[it.rsIdx].InnerHits[hostInnerHits].Hits
+		if it.groupHitIdx >= len(groupHits.HitList) {
+			it.rsIdx++
+			it.group++
+			it.groupHitIdx = 0
+			continue
+		}
+
+		it.latchHit(&groupHits.HitList[it.groupHitIdx])
+		it.latchedCollapsed = 0
+		if returned := uint64(len(groupHits.HitList)); groupHits.Total.Count > returned {
+			it.latchedCollapsed = groupHits.Total.Count - returned
+		}
+		it.groupHitIdx++
+		it.latchedCursor = index.GroupCursor{Group: it.group, Hit: uint32(it.groupHitIdx)}.Encode()
+		return true
+	}
+}
+
+// fetchPage runs the search request for the next page of results. It returns
+// false if the page is empty or the request failed.
+func (it *esIterator) fetchPage() bool {
+	if it.rs, it.lastErr = runSearch(it.ctx, it.es, it.indexName, it.searchReq); it.lastErr != nil {
+		return false
+	}
+	it.rsIdx = 0
+	return len(it.rs.Hits.HitList) != 0
+}
+
+func (it *esIterator) latchHit(hit *esHitWrapper) {
+	it.latchedDoc = mapEsDoc(&hit.DocSource)
+	it.latchedScore = hitScore(hit)
+	if _, highlight := it.searchReq["highlight"]; highlight {
+		it.latchedHighlights = mapEsHighlights(hit.Highlight)
+	}
+}
+
 // Error returns the last error encountered by the iterator.
 func (it *esIterator) Error() error {
 	return it.lastErr
@@ -59,7 +146,53 @@ func (it *esIterator) Document() *index.Document {
 	return it.latchedDoc
 }
 
-// TotalCount returns the approximate number of search results.
+// Highlights returns the highlighted fragments for the current document.
+func (it *esIterator) Highlights() *index.Highlights {
+	return it.latchedHighlights
+}
+
+// Facets returns the facet counts for the documents matching the query.
+func (it *esIterator) Facets() *index.Facets {
+	return it.facets
+}
+
+// TotalCount returns the approximate number of search results. When
+// collapsing, it returns the number of host groups as approximated by the
+// aggregation returned by makeEsGroupsAgg.
 func (it *esIterator) TotalCount() uint64 {
-	return it.rs.Hits.Total.Count
+	return it.total
+}
+
+// Cursor returns the continuation token for the current document.
+func (it *esIterator) Cursor() string {
+	return it.latchedCursor
+}
+
+// Collapsed returns the number of omitted documents from the host of the
+// current document.
+func (it *esIterator) Collapsed() uint64 {
+	return it.latchedCollapsed
+}
+
+// Score returns the relevance score of the current document.
+func (it *esIterator) Score() float64 {
+	return it.latchedScore
+}
+
+// makeHitCursor returns the cursor token for a hit of a search request sorted
+// by esSortOrder.
+func makeHitCursor(hit *esHitWrapper) string {
+	c := index.Cursor{Score: hitScore(hit)}
+	c.LinkID, _ = uuid.Parse(hit.DocSource.LinkID)
+	return c.Encode()
+}
+
+// hitScore returns the score of a hit of a search request sorted by
+// esSortOrder.
+func hitScore(hit *esHitWrapper) float64 {
+	if len(hit.Sort) == 0 {
+		return 0
+	}
+	score, _ := hit.Sort[0].(float64)
+	return score
 }
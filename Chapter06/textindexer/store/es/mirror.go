@@ -0,0 +1,137 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"golang.org/x/xerrors"
+	"net/http"
+)
+
+// writtenDoc describes the outcome of a write to a single document.
+type writtenDoc struct {
+	// index is the physical index that the write was applied to.
+	index string
+	id    string
+
+	// version is the version of the document after the write and source
+	// its contents. The source of deleted documents is nil.
+	version int64
+	source  json.RawMessage
+}
+
+// nextAlias returns the name of the alias that marks the physical index that
+// a running Reindex copies the documents to.
+func (e *ElasticSearchIndexer) nextAlias() string {
+	return e.alias + "_next"
+}
+
+// writeTargets returns the physical index that the alias points to and the
+// physical index that a running Reindex copies the documents to. Either of
+// them is empty if no such index exists.
+func (e *ElasticSearchIndexer) writeTargets(ctx context.Context) (current, next string, err error) {
+	res, err := e.es.Indices.GetAlias(
+		e.es.Indices.GetAlias.WithContext(ctx),
+		e.es.Indices.GetAlias.WithName(e.alias, e.nextAlias()),
+	)
+	if err != nil {
+		return "", "", xerrors.Errorf("get aliases: %w", err)
+	}
+	// A 404 response lists the indices of the aliases that were found.
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return "", "", xerrors.Errorf("get aliases: %w", checkResponse(res))
+	}
+	var aliasRes map[string]json.RawMessage
+	if err = json.NewDecoder(res.Body).Decode(&aliasRes); err != nil {
+		_ = res.Body.Close()
+		return "", "", xerrors.Errorf("get aliases: %w", err)
+	}
+	_ = res.Body.Close()
+
+	for name, raw := range aliasRes {
+		var indexAliases struct {
+			Aliases map[string]json.RawMessage `json:"aliases"`
+		}
+		if err = json.Unmarshal(raw, &indexAliases); err != nil {
+			// Skip the error description of 404 responses.
+			continue
+		}
+		if _, exists := indexAliases.Aliases[e.alias]; exists {
+			current = name
+		}
+		if _, exists := indexAliases.Aliases[e.nextAlias()]; exists {
+			next = name
+		}
+	}
+	return current, next, nil
+}
+
+// mirrorWrites applies the written documents to the physical index that a
+// running Reindex copies the documents to. If the alias was swapped to a new
+// physical index after the documents were written to the previous one, the
+// documents are applied to the new index instead.
+//
+// The documents are written using external versioning with the versions that
+// they got in the index that they were written to, so the newest version of
+// each document wins regardless of whether the copy or the mirrored write
+// reaches the target first. Conflicts with newer versions are therefore
+// ignored.
+func (e *ElasticSearchIndexer) mirrorWrites(ctx context.Context, docs []writtenDoc) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	current, next, err := e.writeTargets(ctx)
+	if err != nil {
+		return xerrors.Errorf("mirror writes: %w", err)
+	}
+	target := next
+	if target == "" {
+		target = current
+	}
+
+	var (
+		buf      bytes.Buffer
+		enc      = json.NewEncoder(&buf)
+		mirrored int
+	)
+	for _, doc := range docs {
+		if doc.index == "" || target == "" || doc.index == target {
+			continue
+		}
+		meta := map[string]interface{}{
+			"_index":       target,
+			"_id":          doc.id,
+			"version":      doc.version,
+			"version_type": "external_gte",
+		}
+		if doc.source == nil {
+			err = enc.Encode(map[string]interface{}{"delete": meta})
+		} else if err = enc.Encode(map[string]interface{}{"index": meta}); err == nil {
+			err = enc.Encode(doc.source)
+		}
+		if err != nil {
+			return xerrors.Errorf("mirror writes: %w", err)
+		}
+		mirrored++
+	}
+	if mirrored == 0 {
+		return nil
+	}
+
+	res, err := e.es.Bulk(&buf, e.es.Bulk.WithContext(ctx), e.es.Bulk.WithRefresh(e.refresh))
+	if err != nil {
+		return xerrors.Errorf("mirror writes to %q: %w", target, err)
+	}
+	var bulkRes esBulkRes
+	if err = unmarshalResponse(res, &bulkRes); err != nil {
+		return xerrors.Errorf("mirror writes to %q: %w", target, err)
+	}
+	for _, item := range bulkRes.Items {
+		for _, result := range item {
+			if result.Error != nil && result.Status != http.StatusConflict {
+				return xerrors.Errorf("mirror writes to %q: %w", target, *result.Error)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package es
+
+import (
+	"fmt"
+	"golang.org/x/xerrors"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+	"time"
+)
+
+// makeEsQuery translates q into the equivalent elasticsearch query clause.
+// The query scores the matching documents according to the ranking specified
+// by q; filters do not affect the scores.
+func makeEsQuery(q index.Query) (map[string]interface{}, error) {
+	ranking := q.RankingOrDefault()
+	t := queryTranslator{
+		titleBoost:    ranking.EffectiveTitleBoost(),
+		contentFields: contentFields(q.Filters.Language),
+	}
+	matchQuery, err := t.matchQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	boolQuery := map[string]interface{}{
+		"must":  matchQuery,
+		"boost": ranking.TextWeight,
+	}
+	if filters := makeFilterQueries(q.Filters); len(filters) != 0 {
+		boolQuery["filter"] = filters
+	}
+	return map[string]interface{}{
+		"function_score": map[string]interface{}{
+			"query":      map[string]interface{}{"bool": boolQuery},
+			"functions":  makeRankingFunctions(ranking, time.Now()),
+			"score_mode": "sum",
+			"boost_mode": "sum",
+		},
+	}, nil
+}
+
+// makeRankingFunctions returns the function_score functions that add the
+// PageRank and freshness components of ranking to the text relevance score.
+func makeRankingFunctions(ranking index.Ranking, now time.Time) []interface{} {
+	// The PageRank function is always included so that at least one
+	// function matches each document; otherwise elasticsearch would use a
+	// default function score of 1.
+	functions := []interface{}{
+		map[string]interface{}{
+			"field_value_factor": map[string]interface{}{
+				"field":   "PageRank",
+				"factor":  ranking.PageRankWeight,
+				"missing": 0,
+			},
+		},
+	}
+	if ranking.FreshnessEnabled() {
+		functions = append(functions, map[string]interface{}{
+			// Decay functions score documents without a value as 1;
+			// only apply freshness to documents with an IndexedAt value.
+			"filter": map[string]interface{}{
+				"exists": map[string]interface{}{"field": "IndexedAt"},
+			},
+			"exp": map[string]interface{}{
+				"IndexedAt": map[string]interface{}{
+					"origin": now.UTC(),
+					"scale":  fmt.Sprintf("%dms", ranking.FreshnessHalfLife/time.Millisecond),
+					"decay":  0.5,
+				},
+			},
+			"weight": ranking.FreshnessWeight,
+		})
+	}
+	return functions
+}
+
+// queryTranslator converts index.Query instances into elasticsearch queries.
+type queryTranslator struct {
+	titleBoost float64
+
+	// contentFields are the fields that query terms are matched against
+	// for the document content.
+	contentFields []string
+}
+
+// contentFields returns the fields to search for the content of documents
+// written in language. If language is not supported, the plain Content field
+// is searched together with the localized content fields of every supported
+// language so that stemmed forms still match.
+func contentFields(language string) []string {
+	if index.LanguageName(language) != "" {
+		return []string{localizedContentField(language)}
+	}
+	fields := []string{"Content"}
+	for _, language := range index.SupportedLanguages() {
+		fields = append(fields, localizedContentField(language))
+	}
+	return fields
+}
+
+func (t queryTranslator) matchQuery(q index.Query) (map[string]interface{}, error) {
+	switch q.Type {
+	case index.QueryTypeAdvanced:
+		root, err := index.ParseQuery(q.Expression)
+		if err != nil {
+			return nil, xerrors.Errorf("parse query: %w", err)
+		}
+		return t.translateNode(root), nil
+	case index.QueryTypeHybrid:
+		return nil, xerrors.Errorf("hybrid queries require a vector index: %w", index.ErrInvalidQuery)
+	case index.QueryTypePhrase:
+		return makeMultiMatch("phrase", q.Expression, t.fieldNames(index.FieldAny)...), nil
+	default:
+		if strings.TrimSpace(q.Expression) == "" {
+			return map[string]interface{}{"match_all": map[string]interface{}{}}, nil
+		}
+		return makeMultiMatch("best_fields", q.Expression, t.fieldNames(index.FieldAny)...), nil
+	}
+}
+
+func makeFilterQueries(f index.Filters) []interface{} {
+	var filters []interface{}
+	if f.Host != "" {
+		filters = append(filters, makeSiteQuery(f.Host))
+	}
+	if f.URLPrefix != "" {
+		filters = append(filters, map[string]interface{}{
+			"prefix": map[string]interface{}{"URL": f.URLPrefix},
+		})
+	}
+	if !f.IndexedSince.IsZero() || !f.IndexedBefore.IsZero() {
+		dateRange := map[string]interface{}{}
+		if !f.IndexedSince.IsZero() {
+			dateRange["gte"] = f.IndexedSince.UTC()
+		}
+		if !f.IndexedBefore.IsZero() {
+			dateRange["lt"] = f.IndexedBefore.UTC()
+		}
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"IndexedAt": dateRange},
+		})
+	}
+	if f.MinPageRank > 0 {
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{
+				"PageRank": map[string]interface{}{"gte": f.MinPageRank},
+			},
+		})
+	}
+	if f.Language != "" {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"Language": f.Language},
+		})
+	}
+	if len(f.LinkIDs) != 0 {
+		ids := make([]string, len(f.LinkIDs))
+		for i, linkID := range f.LinkIDs {
+			ids[i] = linkID.String()
+		}
+		filters = append(filters, map[string]interface{}{
+			"terms": map[string]interface{}{"LinkID": ids},
+		})
+	}
+	return filters
+}
+
+func (t queryTranslator) translateNode(n index.QueryNode) map[string]interface{} {
+	switch n := n.(type) {
+	case *index.TermNode:
+		if n.Field == index.FieldSite {
+			return makeSiteQuery(n.Text)
+		}
+		mm := makeMultiMatch("best_fields", n.Text, t.fieldNames(n.Field)...)
+		mm["multi_match"].(map[string]interface{})["operator"] = "and"
+		return mm
+	case *index.PhraseNode:
+		return makeMultiMatch("phrase", n.Phrase, t.fieldNames(n.Field)...)
+	case *index.AndNode:
+		var must, mustNot []interface{}
+		for _, child := range n.Children {
+			if not, isNot := child.(*index.NotNode); isNot {
+				mustNot = append(mustNot, t.translateNode(not.Child))
+				continue
+			}
+			must = append(must, t.translateNode(child))
+		}
+		boolQuery := map[string]interface{}{}
+		if len(must) != 0 {
+			boolQuery["must"] = must
+		}
+		if len(mustNot) != 0 {
+			boolQuery["must_not"] = mustNot
+		}
+		return map[string]interface{}{"bool": boolQuery}
+	case *index.OrNode:
+		should := make([]interface{}, len(n.Children))
+		for i, child := range n.Children {
+			should[i] = t.translateNode(child)
+		}
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should":               should,
+				"minimum_should_match": 1,
+			},
+		}
+	case *index.NotNode:
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": []interface{}{t.translateNode(n.Child)},
+			},
+		}
+	default:
+		return map[string]interface{}{"match_none": map[string]interface{}{}}
+	}
+}
+
+func makeMultiMatch(qtype, expr string, fields ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"multi_match": map[string]interface{}{
+			"type":   qtype,
+			"query":  expr,
+			"fields": fields,
+		},
+	}
+}
+
+// makeSiteQuery matches documents whose host is either host or one of its
+// subdomains.
+func makeSiteQuery(host string) map[string]interface{} {
+	host = strings.ToLower(host)
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"Host": host}},
+				map[string]interface{}{"wildcard": map[string]interface{}{"Host": "*." + host}},
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// fieldNames returns the text fields, with their boosts, covered by f.
+func (t queryTranslator) fieldNames(f index.Field) []string {
+	titleField := fmt.Sprintf("Title^%g", t.titleBoost)
+	if f == index.FieldTitle {
+		return []string{titleField}
+	}
+	return append([]string{titleField}, t.contentFields...)
+}
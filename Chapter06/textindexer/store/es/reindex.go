@@ -0,0 +1,323 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/esapi"
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+	"time"
+)
+
+// reindexGCDeletes is the time for which the index that Reindex copies the
+// documents to keeps the tombstones of deleted documents. It must exceed the
+// duration of the copy.
+const reindexGCDeletes = "12h"
+
+// cleanupTimeout bounds the time for removing the index that a failed Reindex
+// copied the documents to.
+const cleanupTimeout = 30 * time.Second
+
+// versionedIndexName returns the name of the physical index for version.
+func (e *ElasticSearchIndexer) versionedIndexName(version int) string {
+	return fmt.Sprintf("%s_v%d", e.alias, version)
+}
+
+// ensureIndex ensures that the alias used by the indexer points to a physical
+// index. If neither the alias nor the physical index exist, a new index is
+// created. If an unversioned index with the same name as the alias exists
+// (e.g. created by an older version of the indexer), its contents are
+// migrated to a versioned index.
+func (e *ElasticSearchIndexer) ensureIndex(ctx context.Context) error {
+	indices, err := e.aliasedIndices(ctx)
+	if err != nil {
+		return xerrors.Errorf("cannot create ES index: %w", err)
+	} else if len(indices) != 0 {
+		return nil
+	}
+
+	res, err := e.es.Indices.Exists([]string{e.alias}, e.es.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return xerrors.Errorf("cannot create ES index: %w", err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		if err = e.reindexInto(ctx, e.alias, e.versionedIndexName(1)); err != nil {
+			return xerrors.Errorf("cannot create ES index: %w", err)
+		}
+		return nil
+	}
+
+	body, err := e.makeIndexBody(e.alias, nil)
+	if err != nil {
+		return xerrors.Errorf("cannot create ES index: %w", err)
+	}
+	res, err = e.es.Indices.Create(
+		e.versionedIndexName(1),
+		e.es.Indices.Create.WithContext(ctx),
+		e.es.Indices.Create.WithBody(body),
+	)
+	if err != nil {
+		return xerrors.Errorf("cannot create ES index: %w", err)
+	} else if err = checkResponse(res); err != nil {
+		if esErr, valid := err.(esError); valid && esErr.Type == "resource_already_exists_exception" {
+			return nil
+		}
+		return xerrors.Errorf("cannot create ES index: %w", err)
+	}
+
+	return nil
+}
+
+// Reindex creates a new physical index that uses the current mapping, copies
+// all documents from the index that the alias currently points to and then
+// atomically swaps the alias to the new index. Reindex returns the name of the
+// new physical index.
+//
+// Searches and writes can proceed while the documents are being copied. The
+// new index is marked with a second alias for the duration of the copy and
+// all indexer instances mirror their writes to it, so writes that are issued
+// by any instance while Reindex runs are carried over. If the copy or the
+// alias swap fails, the new index is removed again. The previous index is
+// deleted once the alias has been swapped; failing to delete it does not fail
+// Reindex as the new index is already in use.
+func (e *ElasticSearchIndexer) Reindex(ctx context.Context) (string, error) {
+	indices, err := e.aliasedIndices(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("reindex: %w", err)
+	} else if len(indices) != 1 {
+		return "", xerrors.Errorf("reindex: expected alias %q to point to a single index; got %v", e.alias, indices)
+	}
+
+	oldIndex := indices[0]
+	version, err := e.indexVersion(oldIndex)
+	if err != nil {
+		return "", xerrors.Errorf("reindex: %w", err)
+	}
+	newIndex := e.versionedIndexName(version + 1)
+	if err = e.reindexInto(ctx, oldIndex, newIndex); err != nil {
+		return "", xerrors.Errorf("reindex: %w", err)
+	}
+
+	if res, err := e.es.Indices.Delete([]string{oldIndex}, e.es.Indices.Delete.WithContext(ctx)); err == nil {
+		_ = checkResponse(res)
+	}
+	return newIndex, nil
+}
+
+// reindexInto creates newIndex, copies all documents from oldIndex into it
+// and atomically points the alias to newIndex. If oldIndex has the same name
+// as the alias, it is removed as part of the alias update. If any step after
+// creating newIndex fails, newIndex is deleted.
+func (e *ElasticSearchIndexer) reindexInto(ctx context.Context, oldIndex, newIndex string) error {
+	// Keep the tombstones of mirrored deletes until the copy completes so
+	// that the copy does not resurrect deleted documents.
+	body, err := e.makeIndexBody(e.nextAlias(), map[string]interface{}{"gc_deletes": reindexGCDeletes})
+	if err != nil {
+		return xerrors.Errorf("create index %q: %w", newIndex, err)
+	}
+	res, err := e.es.Indices.Create(
+		newIndex,
+		e.es.Indices.Create.WithContext(ctx),
+		e.es.Indices.Create.WithBody(body),
+	)
+	if err != nil {
+		return xerrors.Errorf("create index %q: %w", newIndex, err)
+	} else if err = checkResponse(res); err != nil {
+		return xerrors.Errorf("create index %q: %w", newIndex, err)
+	}
+
+	if err = e.copyAndSwap(ctx, oldIndex, newIndex); err != nil {
+		// Use a separate context as ctx may have been cancelled.
+		cleanupCtx, cancelFn := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancelFn()
+		if res, delErr := e.es.Indices.Delete([]string{newIndex}, e.es.Indices.Delete.WithContext(cleanupCtx)); delErr != nil {
+			err = multierror.Append(err, xerrors.Errorf("delete index %q: %w", newIndex, delErr))
+		} else if delErr = checkResponse(res); delErr != nil {
+			err = multierror.Append(err, xerrors.Errorf("delete index %q: %w", newIndex, delErr))
+		}
+		return err
+	}
+
+	// Restore the default tombstone retention; a failure only delays the
+	// removal of tombstones.
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(map[string]interface{}{"index": map[string]interface{}{"gc_deletes": nil}}); err == nil {
+		res, err = e.es.Indices.PutSettings(&buf, e.es.Indices.PutSettings.WithContext(ctx), e.es.Indices.PutSettings.WithIndex(newIndex))
+		if err == nil {
+			_ = checkResponse(res)
+		}
+	}
+	return nil
+}
+
+// copyAndSwap copies all documents from oldIndex to newIndex and atomically
+// points the alias to newIndex, removing the alias that marks newIndex as the
+// target of a running Reindex.
+func (e *ElasticSearchIndexer) copyAndSwap(ctx context.Context, oldIndex, newIndex string) error {
+	if err := e.copyDocs(ctx, oldIndex, newIndex); err != nil {
+		return err
+	}
+
+	var actions []interface{}
+	if oldIndex == e.alias {
+		actions = append(actions, map[string]interface{}{
+			"remove_index": map[string]interface{}{"index": oldIndex},
+		})
+	} else {
+		actions = append(actions, map[string]interface{}{
+			"remove": map[string]interface{}{"index": oldIndex, "alias": e.alias},
+		})
+	}
+	actions = append(actions,
+		map[string]interface{}{
+			"add": map[string]interface{}{"index": newIndex, "alias": e.alias},
+		},
+		map[string]interface{}{
+			"remove": map[string]interface{}{"index": newIndex, "alias": e.nextAlias()},
+		},
+	)
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"actions": actions}); err != nil {
+		return xerrors.Errorf("update aliases: %w", err)
+	}
+	res, err := e.es.Indices.UpdateAliases(&buf, e.es.Indices.UpdateAliases.WithContext(ctx))
+	if err != nil {
+		return xerrors.Errorf("update aliases: %w", err)
+	} else if err = checkResponse(res); err != nil {
+		return xerrors.Errorf("update aliases: %w", err)
+	}
+	return nil
+}
+
+// copyDocs copies all documents from src to dst. Documents are copied using
+// external versioning so that they do not replace newer versions that were
+// mirrored to dst while the copy was in progress.
+func (e *ElasticSearchIndexer) copyDocs(ctx context.Context, src, dst string) error {
+	res, err := e.es.Indices.Refresh(e.es.Indices.Refresh.WithContext(ctx), e.es.Indices.Refresh.WithIndex(src))
+	if err != nil {
+		return xerrors.Errorf("refresh index %q: %w", src, err)
+	} else if err = checkResponse(res); err != nil {
+		return xerrors.Errorf("refresh index %q: %w", src, err)
+	}
+
+	req := map[string]interface{}{
+		"source":    map[string]interface{}{"index": src},
+		"dest":      map[string]interface{}{"index": dst, "version_type": "external"},
+		"conflicts": "proceed",
+	}
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(req); err != nil {
+		return xerrors.Errorf("copy documents: %w", err)
+	}
+	res, err = e.es.Reindex(
+		&buf,
+		e.es.Reindex.WithContext(ctx),
+		e.es.Reindex.WithRefresh(true),
+		e.es.Reindex.WithWaitForCompletion(true),
+	)
+	if err != nil {
+		return xerrors.Errorf("copy documents from %q to %q: %w", src, dst, err)
+	}
+	var reindexRes esReindexRes
+	if err = unmarshalResponse(res, &reindexRes); err != nil {
+		return xerrors.Errorf("copy documents from %q to %q: %w", src, dst, err)
+	} else if len(reindexRes.Failures) != 0 {
+		return xerrors.Errorf("copy documents from %q to %q: %d documents could not be copied", src, dst, len(reindexRes.Failures))
+	}
+	return nil
+}
+
+type esReindexRes struct {
+	Failures []json.RawMessage `json:"failures"`
+}
+
+// aliasedIndices returns the sorted list of physical indices that the alias
+// points to.
+func (e *ElasticSearchIndexer) aliasedIndices(ctx context.Context) ([]string, error) {
+	res, err := e.es.Indices.GetAlias(
+		e.es.Indices.GetAlias.WithContext(ctx),
+		e.es.Indices.GetAlias.WithName(e.alias),
+	)
+	if err != nil {
+		return nil, xerrors.Errorf("get alias %q: %w", e.alias, err)
+	}
+	if res.StatusCode == http.StatusNotFound {
+		_ = res.Body.Close()
+		return nil, nil
+	}
+
+	var aliasRes map[string]json.RawMessage
+	if err = unmarshalResponse(res, &aliasRes); err != nil {
+		return nil, xerrors.Errorf("get alias %q: %w", e.alias, err)
+	}
+	indices := make([]string, 0, len(aliasRes))
+	for name := range aliasRes {
+		indices = append(indices, name)
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
+// indexVersion extracts the version from the name of a physical index.
+func (e *ElasticSearchIndexer) indexVersion(name string) (int, error) {
+	version, err := strconv.Atoi(strings.TrimPrefix(name, e.alias+"_v"))
+	if err != nil || !strings.HasPrefix(name, e.alias+"_v") {
+		return 0, xerrors.Errorf("index %q is not a versioned index for alias %q", name, e.alias)
+	}
+	return version, nil
+}
+
+// makeIndexBody returns the request body for creating a physical index with
+// the current mappings and analysis settings and any additional index
+// settings. If alias is not empty, the alias is pointed to the new index.
+func (e *ElasticSearchIndexer) makeIndexBody(alias string, settings map[string]interface{}) (io.Reader, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(esMappings), &body); err != nil {
+		return nil, err
+	}
+	indexSettings := map[string]interface{}{
+		"analysis": makeAnalysisSettings(e.analysis),
+	}
+	for name, value := range settings {
+		indexSettings[name] = value
+	}
+	body["settings"] = indexSettings
+	props := body["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	if !e.analysis.IsZero() {
+		for _, field := range []string{"Title", "Content"} {
+			props[field].(map[string]interface{})["analyzer"] = textAnalyzerName
+		}
+	}
+	localizedProps := props["LocalizedContent"].(map[string]interface{})["properties"].(map[string]interface{})
+	for _, language := range index.SupportedLanguages() {
+		localizedProps[language] = map[string]interface{}{
+			"type":     "text",
+			"analyzer": textAnalyzerName + "_" + language,
+		}
+	}
+	if alias != "" {
+		body["aliases"] = map[string]interface{}{alias: map[string]interface{}{}}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// checkResponse closes the response body and returns an error if the request
+// was not successful.
+func checkResponse(res *esapi.Response) error {
+	var ignored json.RawMessage
+	return unmarshalResponse(res, &ignored)
+}
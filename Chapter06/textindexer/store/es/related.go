@@ -0,0 +1,78 @@
+package es
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"strconv"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// Related runs a more_like_this query that is liked by the document with the
+// specified link ID. The document itself is excluded by elasticsearch.
+func (e *ElasticSearchIndexer) Related(ctx context.Context, linkID uuid.UUID, n int) (index.Iterator, error) {
+	if _, err := e.FindByID(ctx, linkID); err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	like := map[string]interface{}{"_id": linkID.String()}
+	return e.related(ctx, makeMoreLikeThisQuery(like, index.RelatedMinDocFreq), n)
+}
+
+// RelatedTo runs a more_like_this query that is liked by an artificial
+// document with the Title and Content of doc. As elasticsearch does not count
+// artificial documents when determining the document frequencies of their
+// terms, the minimum document frequency is reduced by one to account for
+// doc. Stored documents with the link ID of doc are excluded explicitly.
+func (e *ElasticSearchIndexer) RelatedTo(ctx context.Context, doc *index.Document, n int) (index.Iterator, error) {
+	like := map[string]interface{}{
+		"doc": map[string]interface{}{"Title": doc.Title, "Content": doc.Content},
+	}
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must": makeMoreLikeThisQuery(like, index.RelatedMinDocFreq-1),
+			"must_not": map[string]interface{}{
+				"term": map[string]interface{}{"LinkID": doc.LinkID.String()},
+			},
+		},
+	}
+	return e.related(ctx, query, n)
+}
+
+func makeMoreLikeThisQuery(like map[string]interface{}, minDocFreq int) map[string]interface{} {
+	return map[string]interface{}{
+		"more_like_this": map[string]interface{}{
+			"fields":               []string{"Title", "Content"},
+			"like":                 []interface{}{like},
+			"min_term_freq":        index.RelatedMinTermFreq,
+			"min_doc_freq":         minDocFreq,
+			"max_query_terms":      index.RelatedMaxQueryTerms,
+			"minimum_should_match": strconv.Itoa(index.RelatedMinShouldMatchPercent) + "%",
+		},
+	}
+}
+
+// related runs a more-like-this query and returns an iterator over the first
+// n results.
+func (e *ElasticSearchIndexer) related(ctx context.Context, mltQuery map[string]interface{}, n int) (index.Iterator, error) {
+	if n <= 0 {
+		n = index.DefaultRelatedLimit
+	}
+	query := map[string]interface{}{
+		"query": mltQuery,
+		"sort":  esSortOrder,
+		"size":  n,
+	}
+	searchRes, err := runSearch(ctx, e.es, e.alias, query)
+	if err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	return &esIterator{
+		ctx:           ctx,
+		es:            e.es,
+		indexName:     e.alias,
+		searchReq:     query,
+		rs:            searchRes,
+		total:         searchRes.Hits.Total.Count,
+		firstPageOnly: true,
+	}, nil
+}
@@ -0,0 +1,156 @@
+package es
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	gc "gopkg.in/check.v1"
+	"net/http"
+	"test_project/Chapter06/textindexer/store/es/estest"
+)
+
+var _ = gc.Suite(new(StubTestSuite))
+
+// StubTestSuite tests how the indexer handles responses that are hard to
+// provoke on a live cluster. It runs against a stub node that answers with
+// canned responses.
+type StubTestSuite struct {
+	stub *estest.Stub
+	cfg  Config
+}
+
+func (s *StubTestSuite) SetUpTest(c *gc.C) {
+	s.stub = estest.NewStub()
+	s.cfg = Config{Nodes: []string{s.stub.URL()}, IndexPrefix: "test_", IndexName: "stub"}
+}
+
+func (s *StubTestSuite) TearDownTest(c *gc.C) {
+	s.stub.Close()
+}
+
+func (s *StubTestSuite) TestConcurrentIndexCreation(c *gc.C) {
+	// Another indexer instance creates the index after this one found
+	// that neither the alias nor an unversioned index exist.
+	s.stub.Handle(http.MethodGet, "/_alias/test_stub", http.StatusNotFound, `{}`)
+	s.stub.Handle(http.MethodHead, "/test_stub", http.StatusNotFound, ``)
+	s.stub.HandleError(http.MethodPut, "/test_stub_v1", http.StatusBadRequest, "resource_already_exists_exception")
+
+	_, err := NewElasticSearchIndexerWithConfig(s.cfg)
+	c.Assert(err, gc.IsNil)
+
+	// Other errors are reported.
+	s.stub.HandleError(http.MethodPut, "/test_stub_v1", http.StatusBadRequest, "illegal_argument_exception")
+	_, err = NewElasticSearchIndexerWithConfig(s.cfg)
+	c.Assert(err, gc.ErrorMatches, "cannot create ES index: illegal_argument_exception: stub")
+}
+
+func (s *StubTestSuite) TestReindexRemovesNewIndexOnFailure(c *gc.C) {
+	idx := s.newReindexingIndexer(c)
+
+	// Copy failure.
+	s.stub.HandleError(http.MethodPost, "/_reindex", http.StatusInternalServerError, "exception")
+	_, err := idx.Reindex(context.TODO())
+	c.Assert(err, gc.NotNil)
+	c.Assert(s.methodsAndPaths(), gc.DeepEquals, []string{
+		"GET /_alias/test_stub",
+		"PUT /test_stub_v2",
+		"POST /test_stub_v1/_refresh",
+		"POST /_reindex",
+		"DELETE /test_stub_v2",
+	})
+
+	// Alias swap failure.
+	s.stub.Handle(http.MethodPost, "/_reindex", http.StatusOK, `{"failures":[]}`)
+	s.stub.HandleError(http.MethodPost, "/_aliases", http.StatusBadRequest, "illegal_argument_exception")
+	_, err = idx.Reindex(context.TODO())
+	c.Assert(err, gc.NotNil)
+	requests := s.methodsAndPaths()
+	c.Assert(requests[len(requests)-2:], gc.DeepEquals, []string{"POST /_aliases", "DELETE /test_stub_v2"})
+
+	// Documents that could not be copied.
+	s.stub.Handle(http.MethodPost, "/_reindex", http.StatusOK, `{"failures":[{"id":"1"}]}`)
+	_, err = idx.Reindex(context.TODO())
+	c.Assert(err, gc.ErrorMatches, `reindex: copy documents from "test_stub_v1" to "test_stub_v2": 1 documents could not be copied`)
+	requests = s.methodsAndPaths()
+	c.Assert(requests[len(requests)-1], gc.Equals, "DELETE /test_stub_v2")
+}
+
+func (s *StubTestSuite) TestReindexIgnoresOldIndexDeletionFailure(c *gc.C) {
+	idx := s.newReindexingIndexer(c)
+	s.stub.Handle(http.MethodPost, "/_reindex", http.StatusOK, `{"failures":[]}`)
+	s.stub.Handle(http.MethodPost, "/_aliases", http.StatusOK, `{"acknowledged":true}`)
+	s.stub.Handle(http.MethodPut, "/test_stub_v2/_settings", http.StatusOK, `{"acknowledged":true}`)
+	s.stub.HandleError(http.MethodDelete, "/test_stub_v1", http.StatusInternalServerError, "exception")
+
+	newIndex, err := idx.Reindex(context.TODO())
+	c.Assert(err, gc.IsNil)
+	c.Assert(newIndex, gc.Equals, "test_stub_v2")
+	requests := s.methodsAndPaths()
+	c.Assert(requests[len(requests)-1], gc.Equals, "DELETE /test_stub_v1")
+}
+
+func (s *StubTestSuite) TestWritesAreMirroredWhileReindexing(c *gc.C) {
+	idx := s.newReindexingIndexer(c)
+	linkID := uuid.New()
+	s.stub.Handle(http.MethodPost, fmt.Sprintf("/test_stub/_doc/%s/_update", linkID), http.StatusOK, fmt.Sprintf(
+		`{"_index":"test_stub_v1","_id":%q,"_version":3,"result":"updated","get":{"_source":{"LinkID":%q,"PageRank":0.5}}}`,
+		linkID, linkID,
+	))
+	s.stub.Handle(http.MethodGet, "/_alias/test_stub,test_stub_next", http.StatusOK,
+		`{"test_stub_v1":{"aliases":{"test_stub":{}}},"test_stub_v2":{"aliases":{"test_stub_next":{}}}}`,
+	)
+	s.stub.Handle(http.MethodPost, "/_bulk", http.StatusOK,
+		`{"errors":true,"items":[{"index":{"_index":"test_stub_v2","status":409,"error":{"type":"version_conflict_engine_exception"}}}]}`,
+	)
+
+	// Conflicts with newer versions of the document are ignored.
+	c.Assert(idx.UpdateScore(context.TODO(), linkID, 0.5), gc.IsNil)
+	requests := s.stub.Requests()
+	mirrored := requests[len(requests)-1]
+	c.Assert(mirrored.Path, gc.Equals, "/_bulk")
+	c.Assert(mirrored.Body, gc.Equals, fmt.Sprintf(
+		`{"index":{"_id":%q,"_index":"test_stub_v2","version":3,"version_type":"external_gte"}}`+"\n"+
+			`{"LinkID":%q,"PageRank":0.5}`+"\n",
+		linkID, linkID,
+	))
+
+	// Other errors are reported.
+	s.stub.Handle(http.MethodPost, "/_bulk", http.StatusOK,
+		`{"errors":true,"items":[{"index":{"_index":"test_stub_v2","status":400,"error":{"type":"mapper_parsing_exception","reason":"stub"}}}]}`,
+	)
+	err := idx.UpdateScore(context.TODO(), linkID, 0.5)
+	c.Assert(err, gc.ErrorMatches, `update score: mirror writes to "test_stub_v2": mapper_parsing_exception: stub`)
+
+	// Without a running Reindex, writes are not mirrored.
+	s.stub.Handle(http.MethodGet, "/_alias/test_stub,test_stub_next", http.StatusOK, `{"test_stub_v1":{"aliases":{"test_stub":{}}}}`)
+	before := len(s.stub.Requests())
+	c.Assert(idx.UpdateScore(context.TODO(), linkID, 0.5), gc.IsNil)
+	c.Assert(s.methodsAndPaths()[before:], gc.DeepEquals, []string{
+		fmt.Sprintf("POST /test_stub/_doc/%s/_update", linkID),
+		"GET /_alias/test_stub,test_stub_next",
+	})
+}
+
+// newReindexingIndexer returns an indexer whose alias points to the first
+// version of the index and registers the responses for creating and
+// removing the second version.
+func (s *StubTestSuite) newReindexingIndexer(c *gc.C) *ElasticSearchIndexer {
+	s.stub.Handle(http.MethodGet, "/_alias/test_stub", http.StatusOK, `{"test_stub_v1":{"aliases":{"test_stub":{}}}}`)
+	s.stub.Handle(http.MethodPut, "/test_stub_v2", http.StatusOK, `{"acknowledged":true}`)
+	s.stub.Handle(http.MethodPost, "/test_stub_v1/_refresh", http.StatusOK, `{}`)
+	s.stub.Handle(http.MethodDelete, "/test_stub_v2", http.StatusOK, `{"acknowledged":true}`)
+	idx, err := NewElasticSearchIndexerWithConfig(s.cfg)
+	c.Assert(err, gc.IsNil)
+	s.stub.ResetRequests()
+	return idx
+}
+
+// methodsAndPaths returns the methods and paths of the requests that were
+// received by the stub.
+func (s *StubTestSuite) methodsAndPaths() []string {
+	var list []string
+	for _, req := range s.stub.Requests() {
+		list = append(list, req.Method+" "+req.Path)
+	}
+	return list
+}
@@ -0,0 +1,130 @@
+package es
+
+import (
+	"context"
+	"golang.org/x/xerrors"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// vocabularySuggestion is the name of the term suggestion that is requested
+// from the Vocabulary field, which holds a copy of the Title and Content of
+// each document analyzed without any stemming or stop word removal.
+const vocabularySuggestion = "vocabulary"
+
+// phraseSuggestion is the name of the phrase suggestion that corrects
+// multi-word expressions as a whole, using the pairs of adjacent words
+// indexed by the VocabularyShingles field to pick the corrections that fit
+// together.
+const phraseSuggestion = "phrase"
+
+type esSuggestEntry struct {
+	Text    string            `json:"text"`
+	Offset  int               `json:"offset"`
+	Length  int               `json:"length"`
+	Options []esSuggestOption `json:"options"`
+}
+
+type esSuggestOption struct {
+	Text  string  `json:"text"`
+	Score float64 `json:"score"`
+	Freq  uint64  `json:"freq"`
+}
+
+// Suggest uses a term suggester on the Vocabulary field to correct the words
+// of expression. For expressions with several words, a phrase suggester
+// picks among the candidate corrections those that most often occur next to
+// the neighbouring words; the term suggestions are used for any words that it
+// leaves uncorrected. Indices that were created before the Vocabulary and
+// VocabularyShingles fields were introduced need to be reindexed before they
+// yield any suggestions.
+func (e *ElasticSearchIndexer) Suggest(ctx context.Context, expression string) (string, error) {
+	generator := map[string]interface{}{
+		"field":           "Vocabulary",
+		"suggest_mode":    "missing",
+		"max_edits":       index.SuggestMaxEdits,
+		"prefix_length":   index.SuggestPrefixLength,
+		"min_word_length": index.SuggestMinWordLength,
+	}
+	termSpec := map[string]interface{}{"sort": "score", "size": 1}
+	for k, v := range generator {
+		termSpec[k] = v
+	}
+	query := map[string]interface{}{
+		"size": 0,
+		"suggest": map[string]interface{}{
+			"text":               expression,
+			vocabularySuggestion: map[string]interface{}{"term": termSpec},
+			phraseSuggestion: map[string]interface{}{
+				"phrase": map[string]interface{}{
+					"field":            "VocabularyShingles",
+					"gram_size":        2,
+					"size":             1,
+					"max_errors":       2,
+					"separator":        " ",
+					"direct_generator": []interface{}{generator},
+				},
+			},
+		},
+	}
+	searchRes, err := runSearch(ctx, e.es, e.alias, query)
+	if err != nil {
+		return "", xerrors.Errorf("suggest: %w", err)
+	}
+
+	var (
+		entries     = searchRes.Suggest[vocabularySuggestion]
+		corrections []index.Correction
+	)
+	phraseTerms := bestPhraseTerms(searchRes.Suggest[phraseSuggestion])
+	if len(phraseTerms) != len(entries) {
+		// The words of the phrase cannot be matched up with the words
+		// of the term suggestion.
+		phraseTerms = nil
+	}
+	for i, entry := range entries {
+		term := ""
+		if phraseTerms != nil && phraseTerms[i] != entry.Text {
+			term = phraseTerms[i]
+		} else if len(entry.Options) != 0 {
+			term = entry.Options[0].Text
+		}
+		if term == "" {
+			continue
+		}
+		start := byteOffset(expression, 0, entry.Offset)
+		corrections = append(corrections, index.Correction{
+			Start: start,
+			End:   byteOffset(expression, start, entry.Length),
+			Term:  term,
+		})
+	}
+	if len(corrections) == 0 {
+		return "", nil
+	}
+	return index.ApplyCorrections(expression, corrections), nil
+}
+
+// bestPhraseTerms returns the words of the top option of a phrase suggestion
+// or nil if the suggestion has no options.
+func bestPhraseTerms(entries []esSuggestEntry) []string {
+	if len(entries) == 0 || len(entries[0].Options) == 0 {
+		return nil
+	}
+	return strings.Split(entries[0].Options[0].Text, " ")
+}
+
+// byteOffset returns the byte offset in s that lies n UTF-16 code units past
+// the byte offset from. Elasticsearch reports the offsets of suggested words
+// in UTF-16 code units.
+func byteOffset(s string, from, n int) int {
+	offset := from
+	for n > 0 && offset < len(s) {
+		r, size := utf8.DecodeRuneInString(s[offset:])
+		n -= utf16.RuneLen(r)
+		offset += size
+	}
+	return offset
+}
@@ -0,0 +1,446 @@
+package federated
+
+import (
+	"bytes"
+	"context"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+	"time"
+)
+
+// Shard is implemented by the indexers that can be combined by a
+// FederatedIndexer. Besides index.Indexer, a shard needs to provide the
+// optional capabilities that the FederatedIndexer offers on top of its shards
+// and be able to look up the near-duplicates and related documents of
+// documents that are stored in other shards.
+type Shard interface {
+	index.Indexer
+	index.DuplicateFinder
+	index.Scanner
+	index.Restorer
+	index.Suggester
+	index.Completer
+	index.RelatedFinder
+
+	// FindDuplicatesOf behaves like FindDuplicates for doc, which does not
+	// need to be stored in the shard. If the Fingerprint of doc is not
+	// set, it is computed from its Content.
+	FindDuplicatesOf(ctx context.Context, doc *index.Document) ([]*index.Document, error)
+
+	// RelatedTo behaves like Related for doc, which is treated as if it
+	// was not stored in the shard: it is counted as an additional
+	// document when selecting its terms and any stored document with the
+	// same link ID is excluded from the results.
+	RelatedTo(ctx context.Context, doc *index.Document, n int) (index.Iterator, error)
+}
+
+var _ Shard = (*FederatedIndexer)(nil)
+
+// FederatedIndexer implements index.Indexer on top of several underlying
+// indexers (shards), e.g. one per region or a bleve and an elasticsearch
+// index during a migration.
+//
+// Writes are routed to the shard chosen by hashing the link ID of each
+// document, so a document is always stored in, and looked up from, the same
+// shard. Searches are sent to all shards and their results are merged by
+// score. As each shard scores documents using its own term statistics, the
+// scores of different shards are only comparable if the shards hold similar
+// documents.
+type FederatedIndexer struct {
+	shards []Shard
+}
+
+// NewFederatedIndexer creates a federated indexer over the provided shards,
+// each of which must implement Shard. The order of the shards determines the
+// routing of link IDs and must not change once documents have been indexed.
+func NewFederatedIndexer(shards ...index.Indexer) (*FederatedIndexer, error) {
+	if len(shards) == 0 {
+		return nil, xerrors.New("federated indexer requires at least one shard")
+	}
+	f := &FederatedIndexer{shards: make([]Shard, len(shards))}
+	for i, shard := range shards {
+		s, ok := shard.(Shard)
+		if !ok {
+			return nil, xerrors.Errorf("federated indexer: shard %d (%T) does not implement federated.Shard", i, shard)
+		}
+		f.shards[i] = s
+	}
+	return f, nil
+}
+
+// shardIndex returns the position of the shard that linkID is routed to.
+func (f *FederatedIndexer) shardIndex(linkID uuid.UUID) int {
+	h := fnv.New32a()
+	_, _ = h.Write(linkID[:])
+	return int(h.Sum32() % uint32(len(f.shards)))
+}
+
+func (f *FederatedIndexer) shardFor(linkID uuid.UUID) Shard {
+	return f.shards[f.shardIndex(linkID)]
+}
+
+// Index stores doc in the shard that its link ID is routed to.
+func (f *FederatedIndexer) Index(ctx context.Context, doc *index.Document) error {
+	return f.shardFor(doc.LinkID).Index(ctx, doc)
+}
+
+// FindByID looks up the document with the specified link ID in the shard
+// that the link ID is routed to.
+func (f *FederatedIndexer) FindByID(ctx context.Context, linkID uuid.UUID) (*index.Document, error) {
+	return f.shardFor(linkID).FindByID(ctx, linkID)
+}
+
+// UpdateScore updates the PageRank score of the document with the specified
+// link ID in the shard that the link ID is routed to.
+func (f *FederatedIndexer) UpdateScore(ctx context.Context, linkID uuid.UUID, score float64) error {
+	return f.shardFor(linkID).UpdateScore(ctx, linkID, score)
+}
+
+// Delete removes the document with the specified link ID from the shard that
+// the link ID is routed to.
+func (f *FederatedIndexer) Delete(ctx context.Context, linkID uuid.UUID) error {
+	return f.shardFor(linkID).Delete(ctx, linkID)
+}
+
+// IndexMany submits the documents to their shards, using a single bulk
+// request per shard.
+func (f *FederatedIndexer) IndexMany(ctx context.Context, docs []*index.Document) error {
+	linkIDs := make([]uuid.UUID, len(docs))
+	for pos, doc := range docs {
+		linkIDs[pos] = doc.LinkID
+	}
+	err := f.routeBatch(linkIDs, func(shard Shard, positions []int) error {
+		batch := make([]*index.Document, len(positions))
+		for i, pos := range positions {
+			batch[i] = docs[pos]
+		}
+		return shard.IndexMany(ctx, batch)
+	})
+	if err != nil {
+		return xerrors.Errorf("index many: %w", err)
+	}
+	return nil
+}
+
+// UpdateScores submits the updates to their shards, using a single bulk
+// request per shard.
+func (f *FederatedIndexer) UpdateScores(ctx context.Context, updates []index.ScoreUpdate) error {
+	linkIDs := make([]uuid.UUID, len(updates))
+	for pos, update := range updates {
+		linkIDs[pos] = update.LinkID
+	}
+	err := f.routeBatch(linkIDs, func(shard Shard, positions []int) error {
+		batch := make([]index.ScoreUpdate, len(positions))
+		for i, pos := range positions {
+			batch[i] = updates[pos]
+		}
+		return shard.UpdateScores(ctx, batch)
+	})
+	if err != nil {
+		return xerrors.Errorf("update scores: %w", err)
+	}
+	return nil
+}
+
+// Restore submits the documents to their shards, using a single bulk request
+// per shard.
+func (f *FederatedIndexer) Restore(ctx context.Context, docs []*index.Document) error {
+	linkIDs := make([]uuid.UUID, len(docs))
+	for pos, doc := range docs {
+		linkIDs[pos] = doc.LinkID
+	}
+	err := f.routeBatch(linkIDs, func(shard Shard, positions []int) error {
+		batch := make([]*index.Document, len(positions))
+		for i, pos := range positions {
+			batch[i] = docs[pos]
+		}
+		return shard.Restore(ctx, batch)
+	})
+	if err != nil {
+		return xerrors.Errorf("restore: %w", err)
+	}
+	return nil
+}
+
+// routeBatch groups the positions of the items of a bulk operation by the
+// shard that their link IDs are routed to and invokes fn for each shard that
+// receives any items. The item errors that fn reports via a *index.BulkError
+// refer to positions within the group; they are mapped back to positions
+// within the original batch and combined into a single *index.BulkError. Any
+// other error aborts the operation.
+func (f *FederatedIndexer) routeBatch(linkIDs []uuid.UUID, fn func(shard Shard, positions []int) error) error {
+	groups := make([][]int, len(f.shards))
+	for pos, linkID := range linkIDs {
+		shardIdx := f.shardIndex(linkID)
+		groups[shardIdx] = append(groups[shardIdx], pos)
+	}
+
+	var bulkErr index.BulkError
+	for shardIdx, positions := range groups {
+		if len(positions) == 0 {
+			continue
+		}
+		err := fn(f.shards[shardIdx], positions)
+		if err == nil {
+			continue
+		}
+		var shardErr *index.BulkError
+		if !xerrors.As(err, &shardErr) {
+			return err
+		}
+		for _, item := range shardErr.Items {
+			item.Index = positions[item.Index]
+			bulkErr.Items = append(bulkErr.Items, item)
+		}
+	}
+	if len(bulkErr.Items) == 0 {
+		return nil
+	}
+	sort.Slice(bulkErr.Items, func(l, r int) bool {
+		return bulkErr.Items[l].Index < bulkErr.Items[r].Index
+	})
+	return &bulkErr
+}
+
+// Expire removes the expired documents from all shards and returns the
+// total number of removed documents.
+func (f *FederatedIndexer) Expire(ctx context.Context, indexedBefore time.Time) (uint64, error) {
+	var total uint64
+	for _, shard := range f.shards {
+		count, err := shard.Expire(ctx, indexedBefore)
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// FindDuplicates looks up the document with the specified link ID in the
+// shard that the link ID is routed to and returns its near-duplicates from
+// all shards.
+func (f *FederatedIndexer) FindDuplicates(ctx context.Context, linkID uuid.UUID) ([]*index.Document, error) {
+	owner := f.shardIndex(linkID)
+	doc, err := f.shards[owner].FindByID(ctx, linkID)
+	if err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	var candidates []*index.Document
+	for shardIdx, shard := range f.shards {
+		var dups []*index.Document
+		if shardIdx == owner {
+			dups, err = shard.FindDuplicates(ctx, linkID)
+		} else {
+			dups, err = shard.FindDuplicatesOf(ctx, doc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, dups...)
+	}
+	return index.NearDuplicates(doc, candidates), nil
+}
+
+// FindDuplicatesOf returns the near-duplicates of doc from all shards.
+func (f *FederatedIndexer) FindDuplicatesOf(ctx context.Context, doc *index.Document) ([]*index.Document, error) {
+	dCopy := *doc
+	if dCopy.Fingerprint == 0 {
+		dCopy.Fingerprint = index.Fingerprint(dCopy.Content)
+	}
+	var candidates []*index.Document
+	for _, shard := range f.shards {
+		dups, err := shard.FindDuplicatesOf(ctx, &dCopy)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, dups...)
+	}
+	return index.NearDuplicates(&dCopy, candidates), nil
+}
+
+// Related looks up the document with the specified link ID in the shard that
+// the link ID is routed to and returns the related documents of all shards.
+// The remaining shards treat the document as an additional document when
+// selecting its terms, like the shard that stores it does.
+//
+// The results of the shards are merged by score like search results. As each
+// shard scores the related documents using its own term statistics, the
+// scores of different shards are only comparable if the shards hold similar
+// documents.
+func (f *FederatedIndexer) Related(ctx context.Context, linkID uuid.UUID, n int) (index.Iterator, error) {
+	owner := f.shardIndex(linkID)
+	doc, err := f.shards[owner].FindByID(ctx, linkID)
+	if err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	return f.related(n, func(shardIdx int, shard Shard) (index.Iterator, error) {
+		if shardIdx == owner {
+			return shard.Related(ctx, linkID, n)
+		}
+		return shard.RelatedTo(ctx, doc, n)
+	})
+}
+
+// RelatedTo returns the documents of all shards that are related to doc,
+// merged like the results of Related.
+func (f *FederatedIndexer) RelatedTo(ctx context.Context, doc *index.Document, n int) (index.Iterator, error) {
+	return f.related(n, func(_ int, shard Shard) (index.Iterator, error) {
+		return shard.RelatedTo(ctx, doc, n)
+	})
+}
+
+// related merges the iterators that relatedFn returns for each shard and
+// returns up to n of the merged results.
+func (f *FederatedIndexer) related(n int, relatedFn func(int, Shard) (index.Iterator, error)) (index.Iterator, error) {
+	if n <= 0 {
+		n = index.DefaultRelatedLimit
+	}
+	merged := &mergeIterator{its: make([]index.Iterator, 0, len(f.shards)), limit: uint64(n)}
+	for shardIdx, shard := range f.shards {
+		it, err := relatedFn(shardIdx, shard)
+		if err != nil {
+			_ = merged.Close()
+			return nil, err
+		}
+		merged.its = append(merged.its, it)
+		merged.total += it.TotalCount()
+	}
+	return merged, nil
+}
+
+// Scan returns an iterator over the documents of all shards ordered by link
+// ID.
+func (f *FederatedIndexer) Scan(ctx context.Context) (index.DocumentIterator, error) {
+	its := make([]index.DocumentIterator, 0, len(f.shards))
+	for _, shard := range f.shards {
+		it, err := shard.Scan(ctx)
+		if err != nil {
+			for _, opened := range its {
+				_ = opened.Close()
+			}
+			return nil, xerrors.Errorf("scan: %w", err)
+		}
+		its = append(its, it)
+	}
+	return &scanIterator{its: its}, nil
+}
+
+// Suggest asks all shards for a spelling correction of expression. As each
+// shard only knows the terms of its own documents, the shards may suggest
+// different corrections; the one that matches the most documents of all
+// shards is returned, with ties broken in favor of the suggestion of the
+// earliest shard.
+func (f *FederatedIndexer) Suggest(ctx context.Context, expression string) (string, error) {
+	var suggestions []string
+	for _, shard := range f.shards {
+		suggestion, err := shard.Suggest(ctx, expression)
+		if err != nil {
+			return "", err
+		}
+		if suggestion != "" && !containsString(suggestions, suggestion) {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	switch len(suggestions) {
+	case 0:
+		return "", nil
+	case 1:
+		return suggestions[0], nil
+	}
+
+	var (
+		best      string
+		bestCount uint64
+	)
+	for _, suggestion := range suggestions {
+		it, err := f.Search(ctx, index.Query{Type: index.QueryTypeMatch, Expression: suggestion, PageSize: 1})
+		if err != nil {
+			return "", xerrors.Errorf("suggest: %w", err)
+		}
+		count := it.TotalCount()
+		if err = it.Close(); err != nil {
+			return "", xerrors.Errorf("suggest: %w", err)
+		}
+		if best == "" || count > bestCount {
+			best, bestCount = suggestion, count
+		}
+	}
+	return best, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete merges the completions of all shards by descending PageRank,
+// dropping completions with the same type and text as a completion that
+// ranks higher, and returns up to limit completions.
+func (f *FederatedIndexer) Complete(ctx context.Context, prefix string, limit int) ([]index.Completion, error) {
+	if limit <= 0 {
+		limit = index.DefaultCompletionLimit
+	}
+	var all []index.Completion
+	for _, shard := range f.shards {
+		completions, err := shard.Complete(ctx, prefix, limit)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, completions...)
+	}
+	sort.SliceStable(all, func(l, r int) bool { return all[l].PageRank > all[r].PageRank })
+
+	type completionKey struct {
+		typ  index.CompletionType
+		text string
+	}
+	var (
+		seen   = make(map[completionKey]bool)
+		merged []index.Completion
+	)
+	for _, completion := range all {
+		if len(merged) == limit {
+			break
+		}
+		key := completionKey{typ: completion.Type, text: strings.ToLower(completion.Text)}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, completion)
+	}
+	return merged, nil
+}
+
+// Close closes all shards that implement io.Closer.
+func (f *FederatedIndexer) Close() error {
+	var err error
+	for _, shard := range f.shards {
+		if closer, ok := shard.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil {
+				err = multierror.Append(err, closeErr)
+			}
+		}
+	}
+	return err
+}
+
+// ranksBefore returns true if a result with score a and link ID aID is
+// ordered before a result with score b and link ID bID, which is the order
+// in which all indexers return search results.
+func ranksBefore(a float64, aID uuid.UUID, b float64, bID uuid.UUID) bool {
+	if a != b {
+		return a > b
+	}
+	return bytes.Compare(aID[:], bID[:]) < 0
+}
@@ -0,0 +1,275 @@
+package federated
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	gc "gopkg.in/check.v1"
+	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/index/indextest"
+	"test_project/Chapter06/textindexer/store/memory"
+	"testing"
+)
+
+var _ = gc.Suite(new(FederatedTestSuite))
+
+type FederatedTestSuite struct {
+	indextest.SuiteBase
+	shards []*memory.InMemoryBleveIndexer
+	idx    *FederatedIndexer
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *FederatedTestSuite) SetUpTest(c *gc.C) {
+	s.shards = make([]*memory.InMemoryBleveIndexer, 3)
+	shards := make([]index.Indexer, len(s.shards))
+	for i := range s.shards {
+		shard, err := memory.NewInMemoryBleveIndexer()
+		c.Assert(err, gc.IsNil)
+		s.shards[i], shards[i] = shard, shard
+	}
+	idx, err := NewFederatedIndexer(shards...)
+	c.Assert(err, gc.IsNil)
+	s.SetIndexer(idx)
+	s.idx = idx
+}
+
+func (s *FederatedTestSuite) TearDownTest(c *gc.C) {
+	c.Assert(s.idx.Close(), gc.IsNil)
+}
+
+func (s *FederatedTestSuite) TestNewWithoutShards(c *gc.C) {
+	_, err := NewFederatedIndexer()
+	c.Assert(err, gc.ErrorMatches, "federated indexer requires at least one shard")
+}
+
+func (s *FederatedTestSuite) TestNewRejectsIndexersThatAreNotShards(c *gc.C) {
+	shard, err := memory.NewInMemoryBleveIndexer()
+	c.Assert(err, gc.IsNil)
+	_, err = NewFederatedIndexer(shard, struct{ index.Indexer }{shard})
+	c.Assert(err, gc.ErrorMatches, `federated indexer: shard 1 \(struct { index.Indexer }\) does not implement federated.Shard`)
+}
+
+func (s *FederatedTestSuite) TestWritesAreRoutedByLinkID(c *gc.C) {
+	for i := 0; i < 30; i++ {
+		linkID := uuid.New()
+		c.Assert(s.idx.Index(context.TODO(), &index.Document{LinkID: linkID, Title: "Gophers"}), gc.IsNil)
+
+		owner := s.idx.shardIndex(linkID)
+		for shardIdx, shard := range s.shards {
+			_, err := shard.FindByID(context.TODO(), linkID)
+			if shardIdx == owner {
+				c.Assert(err, gc.IsNil)
+			} else {
+				c.Assert(xerrors.Is(err, index.ErrNotFound), gc.Equals, true)
+			}
+		}
+	}
+
+	// Each shard should receive some of the documents.
+	for shardIdx, shard := range s.shards {
+		it, err := shard.Scan(context.TODO())
+		c.Assert(err, gc.IsNil)
+		c.Assert(it.Next(), gc.Equals, true, gc.Commentf("shard %d is empty", shardIdx))
+		c.Assert(it.Close(), gc.IsNil)
+	}
+}
+
+func (s *FederatedTestSuite) TestSearchMergesShards(c *gc.C) {
+	numDocs := 30
+	expIDs := make([]uuid.UUID, numDocs)
+	for i := range expIDs {
+		expIDs[i] = uuid.New()
+		c.Assert(s.idx.Index(context.TODO(), &index.Document{
+			LinkID:  expIDs[i],
+			Title:   fmt.Sprintf("Document %d", i),
+			Content: "gophers dig tunnels",
+		}), gc.IsNil)
+		c.Assert(s.idx.UpdateScore(context.TODO(), expIDs[i], float64(numDocs-i)), gc.IsNil)
+	}
+
+	q := index.Query{Type: index.QueryTypeMatch, Expression: "tunnels", PageSize: 4}
+	it, err := s.idx.Search(context.TODO(), q)
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.TotalCount(), gc.Equals, uint64(numDocs))
+	var (
+		got       []uuid.UUID
+		prevScore = -1.0
+	)
+	for it.Next() {
+		got = append(got, it.Document().LinkID)
+		if prevScore >= 0 {
+			c.Assert(it.Score() <= prevScore, gc.Equals, true)
+		}
+		prevScore = it.Score()
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+	c.Assert(got, gc.DeepEquals, expIDs)
+
+	// Offsets refer to the merged results.
+	q.Offset = 13
+	it, err = s.idx.Search(context.TODO(), q)
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.TotalCount(), gc.Equals, uint64(numDocs))
+	c.Assert(it.Next(), gc.Equals, true)
+	c.Assert(it.Document().LinkID, gc.Equals, expIDs[13])
+
+	// Cursors can be passed on to all shards.
+	q.Offset, q.Cursor = 0, it.Cursor()
+	c.Assert(it.Close(), gc.IsNil)
+	it, err = s.idx.Search(context.TODO(), q)
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.Next(), gc.Equals, true)
+	c.Assert(it.Document().LinkID, gc.Equals, expIDs[14])
+	c.Assert(it.Close(), gc.IsNil)
+}
+
+func (s *FederatedTestSuite) TestBulkErrorPositions(c *gc.C) {
+	docs := make([]*index.Document, 10)
+	for i := range docs {
+		docs[i] = &index.Document{LinkID: uuid.New(), Title: "Gophers"}
+	}
+	docs[3].LinkID = uuid.Nil
+	docs[8].LinkID = uuid.Nil
+
+	err := s.idx.IndexMany(context.TODO(), docs)
+	var bulkErr *index.BulkError
+	c.Assert(xerrors.As(err, &bulkErr), gc.Equals, true, gc.Commentf("%v", err))
+	c.Assert(bulkErr.Items, gc.HasLen, 2)
+	c.Assert(bulkErr.Items[0].Index, gc.Equals, 3)
+	c.Assert(bulkErr.Items[1].Index, gc.Equals, 8)
+
+	for pos, doc := range docs {
+		if doc.LinkID == uuid.Nil {
+			continue
+		}
+		_, err = s.idx.FindByID(context.TODO(), doc.LinkID)
+		c.Assert(err, gc.IsNil, gc.Commentf("document %d", pos))
+	}
+}
+
+func (s *FederatedTestSuite) TestCompleteMergesShards(c *gc.C) {
+	titles := []string{"Gophers", "Gopher tunnels", "gophers", "Gopherconf"}
+	for i, title := range titles {
+		linkID := uuid.New()
+		c.Assert(s.idx.Index(context.TODO(), &index.Document{LinkID: linkID, Title: title}), gc.IsNil)
+		c.Assert(s.idx.UpdateScore(context.TODO(), linkID, float64(len(titles)-i)), gc.IsNil)
+	}
+
+	completions, err := s.idx.Complete(context.TODO(), "goph", 4)
+	c.Assert(err, gc.IsNil)
+	var texts []string
+	for _, completion := range completions {
+		texts = append(texts, completion.Text)
+	}
+	c.Assert(texts, gc.DeepEquals, []string{"Gophers", "gophers", "Gopher tunnels", "gopher"})
+}
+
+// TestSearchScores overrides the shared test as scores are only comparable
+// across shards if the shards hold similar documents. Each shard receives a
+// copy of the background document and the matching documents are stored in
+// different shards.
+func (s *FederatedTestSuite) TestSearchScores(c *gc.C) {
+	var docs []*index.Document
+	for shardIdx := range s.shards {
+		docs = append(docs, &index.Document{LinkID: s.linkIDForShard(shardIdx), Title: "Burrows", Content: "mole tunnels"})
+	}
+	ids := []uuid.UUID{s.linkIDForShard(0), s.linkIDForShard(1)}
+	docs = append(docs,
+		&index.Document{LinkID: ids[0], Title: "Burrows", Content: "gopher gopher gopher tunnels"},
+		&index.Document{LinkID: ids[1], Title: "Burrows", Content: "gopher tunnels"},
+	)
+	c.Assert(s.idx.IndexMany(context.TODO(), docs), gc.IsNil)
+
+	it, err := s.idx.Search(context.TODO(), index.Query{Type: index.QueryTypeMatch, Expression: "gopher"})
+	c.Assert(err, gc.IsNil)
+	var (
+		got    []uuid.UUID
+		scores []float64
+	)
+	for it.Next() {
+		got = append(got, it.Document().LinkID)
+		scores = append(scores, it.Score())
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+	c.Assert(got, gc.DeepEquals, ids)
+	c.Assert(scores[0] > scores[1], gc.Equals, true, gc.Commentf("scores: %v", scores))
+	c.Assert(scores[1] > 0, gc.Equals, true, gc.Commentf("scores: %v", scores))
+}
+
+// TestCollapseByHost overrides the shared test as federated indexers reject
+// queries that collapse their results.
+func (s *FederatedTestSuite) TestCollapseByHost(c *gc.C) {
+	c.Assert(s.idx.Index(context.TODO(), &index.Document{LinkID: uuid.New(), URL: "http://a.com/1", Title: "Gophers"}), gc.IsNil)
+
+	_, err := s.idx.Search(context.TODO(), index.Query{Type: index.QueryTypeMatch, Expression: "gophers", Collapse: &index.CollapseOptions{}})
+	c.Assert(xerrors.Is(err, index.ErrInvalidQuery), gc.Equals, true, gc.Commentf("%v", err))
+}
+
+// TestRelated overrides the shared test as the related documents of
+// different shards are scored using different term statistics. The related
+// documents are stored in different shards than the source document, so only
+// their merge order is checked.
+func (s *FederatedTestSuite) TestRelated(c *gc.C) {
+	var (
+		source  = &index.Document{LinkID: s.linkIDForShard(0), Title: "Gopher burrows", Content: "Gophers dig extensive tunnel systems underground with their strong claws"}
+		pocket  = &index.Document{LinkID: s.linkIDForShard(1), Title: "Pocket gophers", Content: "Pocket gophers dig tunnel systems underground"}
+		moles   = &index.Document{LinkID: s.linkIDForShard(2), Title: "Moles", Content: "Moles dig underground with claws"}
+		markets = &index.Document{LinkID: s.linkIDForShard(0), Title: "Markets", Content: "Stock markets rallied today"}
+	)
+	c.Assert(s.idx.IndexMany(context.TODO(), []*index.Document{source, pocket, moles, markets}), gc.IsNil)
+
+	iterate := func(it index.Iterator) []uuid.UUID {
+		var (
+			got       []uuid.UUID
+			prevScore = -1.0
+		)
+		for it.Next() {
+			got = append(got, it.Document().LinkID)
+			if prevScore >= 0 {
+				c.Assert(it.Score() <= prevScore, gc.Equals, true)
+			}
+			prevScore = it.Score()
+		}
+		c.Assert(it.Error(), gc.IsNil)
+		c.Assert(it.Close(), gc.IsNil)
+		return got
+	}
+
+	// The related documents of all shards are merged by descending score
+	// and the source document is excluded.
+	it, err := s.idx.Related(context.TODO(), source.LinkID, 0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.TotalCount(), gc.Equals, uint64(2))
+	got := iterate(it)
+	c.Assert(got, gc.HasLen, 2)
+	c.Assert(map[uuid.UUID]bool{got[0]: true, got[1]: true}, gc.DeepEquals, map[uuid.UUID]bool{pocket.LinkID: true, moles.LinkID: true})
+
+	// At most n documents are returned.
+	it, err = s.idx.Related(context.TODO(), source.LinkID, 1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(iterate(it), gc.DeepEquals, got[:1])
+
+	it, err = s.idx.RelatedTo(context.TODO(), source, 0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(iterate(it), gc.DeepEquals, got)
+
+	_, err = s.idx.Related(context.TODO(), uuid.New(), 0)
+	c.Assert(xerrors.Is(err, index.ErrNotFound), gc.Equals, true, gc.Commentf("%v", err))
+}
+
+// linkIDForShard returns a random link ID that is routed to the specified
+// shard.
+func (s *FederatedTestSuite) linkIDForShard(shardIdx int) uuid.UUID {
+	for {
+		if linkID := uuid.New(); s.idx.shardIndex(linkID) == shardIdx {
+			return linkID
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package federated
+
+import (
+	"bytes"
+	"github.com/hashicorp/go-multierror"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// hit is a search result obtained from a shard.
+type hit struct {
+	doc        *index.Document
+	score      float64
+	highlights *index.Highlights
+}
+
+// mergeIterator implements index.Iterator by merging the results of the
+// shard iterators, each of which returns its results in the order defined by
+// ranksBefore.
+type mergeIterator struct {
+	its []index.Iterator
+
+	// heads holds the next result of each shard iterator or nil if the
+	// iterator is exhausted. It is populated by the first call to Next.
+	heads   []*hit
+	started bool
+
+	// skip is the number of merged results that still need to be skipped
+	// to honor the query offset.
+	skip uint64
+
+	// limit, if positive, is the maximum number of merged results to
+	// return and returned is the number of results returned so far.
+	limit    uint64
+	returned uint64
+
+	total   uint64
+	facets  *index.Facets
+	cur     *hit
+	lastErr error
+}
+
+// Next advances the iterator to the next merged result. It returns false if
+// no more results are available or an error occurred.
+func (it *mergeIterator) Next() bool {
+	if !it.started {
+		it.started = true
+		it.heads = make([]*hit, len(it.its))
+		for i := range it.its {
+			it.advance(i)
+		}
+	}
+	for it.lastErr == nil && (it.limit == 0 || it.returned < it.limit) {
+		best := -1
+		for i, head := range it.heads {
+			if head != nil && (best < 0 || ranksBefore(head.score, head.doc.LinkID, it.heads[best].score, it.heads[best].doc.LinkID)) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return false
+		}
+		it.cur = it.heads[best]
+		it.advance(best)
+		if it.skip > 0 {
+			it.skip--
+			continue
+		}
+		it.returned++
+		return true
+	}
+	return false
+}
+
+// advance loads the next result of the i-th shard iterator.
+func (it *mergeIterator) advance(i int) {
+	shardIt := it.its[i]
+	if !shardIt.Next() {
+		it.heads[i] = nil
+		if err := shardIt.Error(); err != nil && it.lastErr == nil {
+			it.lastErr = err
+		}
+		return
+	}
+	it.heads[i] = &hit{doc: shardIt.Document(), score: shardIt.Score(), highlights: shardIt.Highlights()}
+}
+
+// Document returns the current document.
+func (it *mergeIterator) Document() *index.Document {
+	return it.cur.doc
+}
+
+// Highlights returns the highlighted fragments for the current document.
+func (it *mergeIterator) Highlights() *index.Highlights {
+	return it.cur.highlights
+}
+
+// Facets returns the facet counts summed over all shards.
+func (it *mergeIterator) Facets() *index.Facets {
+	return it.facets
+}
+
+// Cursor returns the continuation token for the current document. The token
+// can be passed on to each shard as it only depends on the score and link
+// ID of the document.
+func (it *mergeIterator) Cursor() string {
+	return index.Cursor{Score: it.cur.score, LinkID: it.cur.doc.LinkID}.Encode()
+}
+
+// Collapsed returns zero as the merged results are not collapsed.
+func (it *mergeIterator) Collapsed() uint64 {
+	return 0
+}
+
+// Score returns the score of the current document.
+func (it *mergeIterator) Score() float64 {
+	return it.cur.score
+}
+
+// TotalCount returns the sum of the total counts of all shards.
+func (it *mergeIterator) TotalCount() uint64 {
+	return it.total
+}
+
+// Error returns the first error encountered by any shard iterator.
+func (it *mergeIterator) Error() error {
+	return it.lastErr
+}
+
+// Close closes all shard iterators.
+func (it *mergeIterator) Close() error {
+	var err error
+	for _, shardIt := range it.its {
+		if closeErr := shardIt.Close(); closeErr != nil {
+			err = multierror.Append(err, closeErr)
+		}
+	}
+	return err
+}
+
+// scanIterator implements index.DocumentIterator by merging the documents of
+// the shard iterators, each of which returns its documents ordered by link
+// ID.
+type scanIterator struct {
+	its     []index.DocumentIterator
+	heads   []*index.Document
+	started bool
+	cur     *index.Document
+	lastErr error
+}
+
+// Next advances the iterator to the document with the next link ID. It
+// returns false if no more documents are available or an error occurred.
+func (it *scanIterator) Next() bool {
+	if !it.started {
+		it.started = true
+		it.heads = make([]*index.Document, len(it.its))
+		for i := range it.its {
+			it.advance(i)
+		}
+	}
+	if it.lastErr != nil {
+		return false
+	}
+	best := -1
+	for i, head := range it.heads {
+		if head != nil && (best < 0 || bytes.Compare(head.LinkID[:], it.heads[best].LinkID[:]) < 0) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return false
+	}
+	it.cur = it.heads[best]
+	it.advance(best)
+	return it.lastErr == nil
+}
+
+// advance loads the next document of the i-th shard iterator.
+func (it *scanIterator) advance(i int) {
+	shardIt := it.its[i]
+	if !shardIt.Next() {
+		it.heads[i] = nil
+		if err := shardIt.Error(); err != nil && it.lastErr == nil {
+			it.lastErr = err
+		}
+		return
+	}
+	it.heads[i] = shardIt.Document()
+}
+
+// Document returns the current document.
+func (it *scanIterator) Document() *index.Document {
+	return it.cur
+}
+
+// Error returns the first error encountered by any shard iterator.
+func (it *scanIterator) Error() error {
+	return it.lastErr
+}
+
+// Close closes all shard iterators.
+func (it *scanIterator) Close() error {
+	var err error
+	for _, shardIt := range it.its {
+		if closeErr := shardIt.Close(); closeErr != nil {
+			err = multierror.Append(err, closeErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package federated
+
+import (
+	"context"
+	"golang.org/x/xerrors"
+	"sort"
+	"sync"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// Search sends the query to all shards in parallel and merges their results
+// by descending score with ties broken by ascending link ID. Offsets and
+// cursors refer to the merged results and TotalCount is the sum of the
+// TotalCount of all shards.
+//
+// Facet counts are summed over all shards. Like elasticsearch does for its
+// own shards, each shard is asked for more hosts than requested so that the
+// merged host counts are accurate unless the hosts are spread very unevenly.
+//
+// Collapsing is not supported as the documents of a host may be stored in any
+// shard, so grouping them would require scanning the matching documents of
+// all shards. Such queries fail with index.ErrInvalidQuery.
+func (f *FederatedIndexer) Search(ctx context.Context, q index.Query) (index.Iterator, error) {
+	if q.Collapse != nil {
+		return nil, xerrors.Errorf("search: federated indexers do not support collapsing: %w", index.ErrInvalidQuery)
+	}
+	shardQuery := q
+	shardQuery.Offset = 0
+
+	var facetOpts index.FacetOptions
+	if q.Facets != nil {
+		facetOpts = q.Facets.WithDefaults()
+		shardFacetOpts := facetOpts
+		shardFacetOpts.HostSize = facetOpts.HostSize*3/2 + 10
+		shardQuery.Facets = &shardFacetOpts
+	}
+
+	if q.Cursor == "" {
+		// Each shard may contribute all of the skipped results.
+		shardQuery.PageSize = int(q.Offset) + q.PageSizeOrDefault()
+	}
+
+	its, err := f.searchShards(ctx, shardQuery)
+	if err != nil {
+		return nil, err
+	}
+	merged := &mergeIterator{its: its}
+	for _, it := range its {
+		merged.total += it.TotalCount()
+	}
+	if q.Facets != nil {
+		merged.facets = mergeFacets(its, facetOpts)
+	}
+	if q.Cursor == "" {
+		merged.skip = q.Offset
+	}
+	return merged, nil
+}
+
+// searchShards runs q against all shards in parallel.
+func (f *FederatedIndexer) searchShards(ctx context.Context, q index.Query) ([]index.Iterator, error) {
+	var (
+		wg   sync.WaitGroup
+		its  = make([]index.Iterator, len(f.shards))
+		errs = make([]error, len(f.shards))
+	)
+	for i, shard := range f.shards {
+		wg.Add(1)
+		go func(i int, shard Shard) {
+			defer wg.Done()
+			its[i], errs[i] = shard.Search(ctx, q)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		for _, it := range its {
+			if it != nil {
+				_ = it.Close()
+			}
+		}
+		return nil, err
+	}
+	return its, nil
+}
+
+// mergeFacets sums the facet counts of the shard iterators. The merged host
+// counts are truncated to the requested number of hosts.
+func mergeFacets(its []index.Iterator, opts index.FacetOptions) *index.Facets {
+	var (
+		merged     = &index.Facets{}
+		hostCounts = make(map[string]uint64)
+	)
+	for _, r := range opts.DateRanges() {
+		merged.IndexedAt = append(merged.IndexedAt, index.DateCount{DateRange: r})
+	}
+	for _, r := range opts.PageRankRanges {
+		merged.PageRank = append(merged.PageRank, index.PageRankCount{PageRankRange: r})
+	}
+
+	for _, it := range its {
+		facets := it.Facets()
+		if facets == nil {
+			continue
+		}
+		for _, hc := range facets.Hosts {
+			hostCounts[hc.Host] += hc.Count
+		}
+		for i := 0; i < len(facets.IndexedAt) && i < len(merged.IndexedAt); i++ {
+			merged.IndexedAt[i].Count += facets.IndexedAt[i].Count
+		}
+		for i := 0; i < len(facets.PageRank) && i < len(merged.PageRank); i++ {
+			merged.PageRank[i].Count += facets.PageRank[i].Count
+		}
+	}
+
+	for host, count := range hostCounts {
+		merged.Hosts = append(merged.Hosts, index.HostCount{Host: host, Count: count})
+	}
+	sort.Slice(merged.Hosts, func(l, r int) bool {
+		if merged.Hosts[l].Count != merged.Hosts[r].Count {
+			return merged.Hosts[l].Count > merged.Hosts[r].Count
+		}
+		return merged.Hosts[l].Host < merged.Hosts[r].Host
+	})
+	if len(merged.Hosts) > opts.HostSize {
+		merged.Hosts = merged.Hosts[:opts.HostSize]
+	}
+	return merged
+}
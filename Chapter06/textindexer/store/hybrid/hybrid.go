@@ -0,0 +1,297 @@
+package hybrid
+
+import (
+	"bytes"
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"io"
+	"sort"
+	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/vector"
+	"time"
+)
+
+// Wrapped is implemented by the indexers that can be wrapped by a
+// HybridIndexer. Besides index.Indexer, they need to provide the optional
+// capabilities that the HybridIndexer delegates to them.
+type Wrapped interface {
+	index.Indexer
+	index.DuplicateFinder
+	index.Scanner
+	index.Restorer
+	index.Suggester
+	index.Completer
+	index.RelatedFinder
+}
+
+// HybridIndexer wraps an indexer and maintains an in-memory vector
+// index with embeddings of the Title and Content of the documents stored in
+// it, which enables QueryTypeHybrid searches. All other queries and
+// operations are delegated to the wrapped indexer.
+type HybridIndexer struct {
+	Wrapped
+
+	vectors *vector.Index
+}
+
+// NewHybridIndexer wraps idx into a HybridIndexer whose embeddings have the
+// specified number of dimensions or vector.DefaultDimensions if dims is not
+// positive. The vector index is not persisted; it is populated by scanning
+// the documents that idx already contains.
+func NewHybridIndexer(ctx context.Context, idx Wrapped, dims int) (*HybridIndexer, error) {
+	h := &HybridIndexer{Wrapped: idx, vectors: vector.NewIndex(dims)}
+	it, err := idx.Scan(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("build vector index: %w", err)
+	}
+	for it.Next() {
+		h.addVector(it.Document())
+	}
+	if err = it.Error(); err != nil {
+		_ = it.Close()
+		return nil, xerrors.Errorf("build vector index: %w", err)
+	}
+	if err = it.Close(); err != nil {
+		return nil, xerrors.Errorf("build vector index: %w", err)
+	}
+	return h, nil
+}
+
+// Index stores doc in the wrapped indexer and updates its embedding.
+func (h *HybridIndexer) Index(ctx context.Context, doc *index.Document) error {
+	if err := h.Wrapped.Index(ctx, doc); err != nil {
+		return err
+	}
+	h.addVector(doc)
+	return nil
+}
+
+// IndexMany stores docs in the wrapped indexer and updates the embeddings of
+// the documents that were indexed successfully.
+func (h *HybridIndexer) IndexMany(ctx context.Context, docs []*index.Document) error {
+	err := h.Wrapped.IndexMany(ctx, docs)
+	h.addVectors(docs, err)
+	return err
+}
+
+// Restore stores docs in the wrapped indexer and updates the embeddings of
+// the documents that were restored successfully.
+func (h *HybridIndexer) Restore(ctx context.Context, docs []*index.Document) error {
+	err := h.Wrapped.Restore(ctx, docs)
+	h.addVectors(docs, err)
+	return err
+}
+
+// Delete removes the document with the specified link ID from the wrapped
+// indexer and the vector index.
+func (h *HybridIndexer) Delete(ctx context.Context, linkID uuid.UUID) error {
+	if err := h.Wrapped.Delete(ctx, linkID); err != nil {
+		return err
+	}
+	h.vectors.Remove(linkID)
+	return nil
+}
+
+// Expire removes the documents that have not been indexed since the
+// specified time from the wrapped indexer and the vector index.
+func (h *HybridIndexer) Expire(ctx context.Context, indexedBefore time.Time) (uint64, error) {
+	count, err := h.Wrapped.Expire(ctx, indexedBefore)
+	if err != nil {
+		return count, err
+	}
+	h.vectors.Expire(indexedBefore)
+	return count, nil
+}
+
+// Close closes the wrapped indexer if it implements io.Closer.
+func (h *HybridIndexer) Close() error {
+	if closer, ok := h.Wrapped.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// addVectors updates the embeddings of the documents that were stored by a
+// bulk operation that returned err.
+func (h *HybridIndexer) addVectors(docs []*index.Document, err error) {
+	var bulkErr *index.BulkError
+	if err != nil && !xerrors.As(err, &bulkErr) {
+		return
+	}
+	failed := make(map[int]bool)
+	if bulkErr != nil {
+		for _, item := range bulkErr.Items {
+			failed[item.Index] = true
+		}
+	}
+	for pos, doc := range docs {
+		if !failed[pos] {
+			h.addVector(doc)
+		}
+	}
+}
+
+func (h *HybridIndexer) addVector(doc *index.Document) {
+	h.vectors.Add(doc.LinkID, doc.Title+"\n"+doc.Content, doc.IndexedAt)
+}
+
+// Search delegates all queries except QueryTypeHybrid ones to the wrapped
+// indexer.
+//
+// Hybrid queries retrieve up to index.MaxHybridCandidates documents that
+// match the expression like a QueryTypeMatch query and up to the same number
+// of documents whose embeddings are most similar to that of the expression
+// with a similarity of at least index.MinHybridSimilarity. The latter are
+// looked up by a search of the wrapped indexer that is restricted to their
+// link IDs and subject to the query filters.
+// Each candidate is scored by index.FuseScores and the iterator returns all
+// candidates ordered by descending fused score. Hybrid queries do not
+// support facets or collapsing.
+func (h *HybridIndexer) Search(ctx context.Context, q index.Query) (index.Iterator, error) {
+	if q.Type != index.QueryTypeHybrid {
+		return h.Wrapped.Search(ctx, q)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("search: %w", err)
+	}
+	weight := q.VectorWeightOrDefault()
+	if weight < 0 || weight > 1 {
+		return nil, xerrors.Errorf("search: vector weight must be between 0 and 1: %w", index.ErrInvalidQuery)
+	}
+	if q.Facets != nil || q.Collapse != nil {
+		return nil, xerrors.Errorf("search: hybrid queries do not support facets or collapsing: %w", index.ErrInvalidQuery)
+	}
+	var start *index.Cursor
+	if q.Cursor != "" {
+		c, err := index.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, xerrors.Errorf("search: %w", err)
+		}
+		start = &c
+	}
+
+	results, err := h.hybridResults(ctx, q, weight)
+	if err != nil {
+		return nil, xerrors.Errorf("search: %w", err)
+	}
+	it := &resultIterator{results: results, total: uint64(len(results))}
+	switch {
+	case start != nil:
+		it.results = results[sort.Search(len(results), func(i int) bool {
+			return ranksBefore(start.Score, start.LinkID, results[i].score, results[i].doc.LinkID)
+		}):]
+	case q.Offset < uint64(len(results)):
+		it.results = results[q.Offset:]
+	default:
+		it.results = nil
+	}
+	return it, nil
+}
+
+// hybridResults returns the scored candidates of a hybrid query ordered by
+// descending fused score with ties broken by ascending link ID.
+func (h *HybridIndexer) hybridResults(ctx context.Context, q index.Query, weight float64) ([]*result, error) {
+	lexicalQuery := q
+	lexicalQuery.Type = index.QueryTypeMatch
+	lexicalQuery.Offset, lexicalQuery.Cursor = 0, ""
+	lexicalQuery.PageSize = index.MaxHybridCandidates
+	it, err := h.Wrapped.Search(ctx, lexicalQuery)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		candidates = make(map[uuid.UUID]*result)
+		maxLexical float64
+	)
+	for len(candidates) < index.MaxHybridCandidates && it.Next() {
+		r := &result{doc: it.Document(), lexical: it.Score(), highlights: it.Highlights()}
+		candidates[r.doc.LinkID] = r
+		if r.lexical > maxLexical {
+			maxLexical = r.lexical
+		}
+	}
+	if err = it.Error(); err != nil {
+		_ = it.Close()
+		return nil, err
+	}
+	if err = it.Close(); err != nil {
+		return nil, err
+	}
+
+	queryVec := h.vectors.Embed(q.Expression)
+	var vectorIDs []uuid.UUID
+	for _, m := range h.vectors.Nearest(queryVec, index.MaxHybridCandidates) {
+		if m.Score < index.MinHybridSimilarity {
+			break
+		}
+		if _, exists := candidates[m.LinkID]; !exists {
+			vectorIDs = append(vectorIDs, m.LinkID)
+		}
+	}
+	if err = h.addVectorCandidates(ctx, q, vectorIDs, candidates); err != nil {
+		return nil, err
+	}
+
+	results := make([]*result, 0, len(candidates))
+	for linkID, r := range candidates {
+		cosine, _ := h.vectors.Similarity(queryVec, linkID)
+		r.score = index.FuseScores(r.lexical, maxLexical, cosine, weight)
+		results = append(results, r)
+	}
+	sort.Slice(results, func(l, r int) bool {
+		return ranksBefore(results[l].score, results[l].doc.LinkID, results[r].score, results[r].doc.LinkID)
+	})
+	return results, nil
+}
+
+// addVectorCandidates looks up the documents with the specified link IDs,
+// which were retrieved via the vector index, and adds the ones that satisfy
+// the filters of q to candidates. The filters are applied by the wrapped
+// indexer so that they behave exactly as they do for the lexical results.
+func (h *HybridIndexer) addVectorCandidates(ctx context.Context, q index.Query, linkIDs []uuid.UUID, candidates map[uuid.UUID]*result) error {
+	if len(q.Filters.LinkIDs) != 0 {
+		allowed := make(map[uuid.UUID]bool, len(q.Filters.LinkIDs))
+		for _, linkID := range q.Filters.LinkIDs {
+			allowed[linkID] = true
+		}
+		filtered := linkIDs[:0]
+		for _, linkID := range linkIDs {
+			if allowed[linkID] {
+				filtered = append(filtered, linkID)
+			}
+		}
+		linkIDs = filtered
+	}
+	if len(linkIDs) == 0 {
+		return nil
+	}
+
+	filterQuery := index.Query{Type: index.QueryTypeMatch, Filters: q.Filters, PageSize: len(linkIDs)}
+	filterQuery.Filters.LinkIDs = linkIDs
+	it, err := h.Wrapped.Search(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		r := &result{doc: it.Document()}
+		if q.Highlight != nil {
+			r.highlights = new(index.Highlights)
+		}
+		candidates[r.doc.LinkID] = r
+	}
+	if err = it.Error(); err != nil {
+		_ = it.Close()
+		return err
+	}
+	return it.Close()
+}
+
+// ranksBefore returns true if a result with score a and link ID aID is
+// ordered before a result with score b and link ID bID.
+func ranksBefore(a float64, aID uuid.UUID, b float64, bID uuid.UUID) bool {
+	if a != b {
+		return a > b
+	}
+	return bytes.Compare(aID[:], bID[:]) < 0
+}
@@ -0,0 +1,185 @@
+package hybrid
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	gc "gopkg.in/check.v1"
+	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/index/indextest"
+	"test_project/Chapter06/textindexer/store/memory"
+	"testing"
+)
+
+var _ = gc.Suite(new(HybridTestSuite))
+
+type HybridTestSuite struct {
+	indextest.SuiteBase
+	inner *memory.InMemoryBleveIndexer
+	idx   *HybridIndexer
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *HybridTestSuite) SetUpTest(c *gc.C) {
+	inner, err := memory.NewInMemoryBleveIndexer()
+	c.Assert(err, gc.IsNil)
+	s.idx, err = NewHybridIndexer(context.TODO(), inner, 0)
+	c.Assert(err, gc.IsNil)
+	s.inner = inner
+	s.SetIndexer(s.idx)
+}
+
+func (s *HybridTestSuite) TearDownTest(c *gc.C) {
+	c.Assert(s.idx.Close(), gc.IsNil)
+}
+
+// indexBikeDocs indexes a set of documents where only the first one matches
+// the terms of the query "bicycle repairs" exactly.
+func (s *HybridTestSuite) indexBikeDocs(c *gc.C) []uuid.UUID {
+	docs := []*index.Document{
+		{URL: "http://shop.example.com/", Title: "Bicycle shop", Content: "Visit our bicycle shop for new bikes."},
+		{URL: "http://blog.example.com/", Title: "Repairing bicycles", Content: "How to repair a flat tyre of your bicycles."},
+		{URL: "http://other.org/", Title: "Baking bread", Content: "Knead the dough and let it rise overnight."},
+	}
+	ids := make([]uuid.UUID, len(docs))
+	for i, doc := range docs {
+		ids[i] = uuid.New()
+		doc.LinkID = ids[i]
+	}
+	c.Assert(s.idx.IndexMany(context.TODO(), docs), gc.IsNil)
+	return ids
+}
+
+func (s *HybridTestSuite) search(c *gc.C, q index.Query) ([]uuid.UUID, []float64) {
+	it, err := s.idx.Search(context.TODO(), q)
+	c.Assert(err, gc.IsNil)
+	var (
+		ids    []uuid.UUID
+		scores []float64
+	)
+	for it.Next() {
+		ids = append(ids, it.Document().LinkID)
+		scores = append(scores, it.Score())
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+	return ids, scores
+}
+
+func (s *HybridTestSuite) TestHybridSearch(c *gc.C) {
+	ids := s.indexBikeDocs(c)
+
+	// A lexical search only finds the document with the exact terms.
+	got, _ := s.search(c, index.Query{Type: index.QueryTypeMatch, Expression: "bicycle repairs"})
+	c.Assert(got, gc.DeepEquals, []uuid.UUID{ids[0]})
+
+	// A hybrid search also finds the document with different
+	// inflections of the terms.
+	got, scores := s.search(c, index.Query{Type: index.QueryTypeHybrid, Expression: "bicycle repairs"})
+	c.Assert(got, gc.DeepEquals, []uuid.UUID{ids[0], ids[1]})
+	c.Assert(scores[0] > scores[1], gc.Equals, true)
+	c.Assert(scores[1] > 0, gc.Equals, true)
+
+	// Favouring the vector similarity ranks the paraphrased document
+	// first.
+	weight := 1.0
+	got, _ = s.search(c, index.Query{Type: index.QueryTypeHybrid, Expression: "repairing a bicycle tyre", VectorWeight: &weight})
+	c.Assert(got[0], gc.Equals, ids[1])
+
+	// A zero weight ranks the results by their lexical score only, so
+	// documents that were only retrieved via the vector index score 0.
+	weight = 0
+	got, scores = s.search(c, index.Query{Type: index.QueryTypeHybrid, Expression: "bicycle repairs", VectorWeight: &weight})
+	c.Assert(got, gc.DeepEquals, []uuid.UUID{ids[0], ids[1]})
+	c.Assert(scores, gc.DeepEquals, []float64{1, 0})
+
+	// Filters also apply to documents retrieved via the vector index.
+	got, _ = s.search(c, index.Query{
+		Type:       index.QueryTypeHybrid,
+		Expression: "bicycle repairs",
+		Filters:    index.Filters{Host: "shop.example.com"},
+	})
+	c.Assert(got, gc.DeepEquals, []uuid.UUID{ids[0]})
+	got, _ = s.search(c, index.Query{
+		Type:       index.QueryTypeHybrid,
+		Expression: "bicycle repairs",
+		Filters:    index.Filters{LinkIDs: []uuid.UUID{ids[1]}},
+	})
+	c.Assert(got, gc.DeepEquals, []uuid.UUID{ids[1]})
+}
+
+func (s *HybridTestSuite) TestHybridSearchPaging(c *gc.C) {
+	s.indexBikeDocs(c)
+	q := index.Query{Type: index.QueryTypeHybrid, Expression: "bicycle repairs"}
+	all, _ := s.search(c, q)
+	c.Assert(len(all) >= 2, gc.Equals, true)
+
+	q.Offset = 1
+	got, _ := s.search(c, q)
+	c.Assert(got, gc.DeepEquals, all[1:])
+
+	q.Offset = 0
+	it, err := s.idx.Search(context.TODO(), q)
+	c.Assert(err, gc.IsNil)
+	c.Assert(it.Next(), gc.Equals, true)
+	c.Assert(it.TotalCount(), gc.Equals, uint64(len(all)))
+	q.Cursor = it.Cursor()
+	c.Assert(it.Close(), gc.IsNil)
+	got, _ = s.search(c, q)
+	c.Assert(got, gc.DeepEquals, all[1:])
+}
+
+func (s *HybridTestSuite) TestHybridSearchHighlights(c *gc.C) {
+	ids := s.indexBikeDocs(c)
+	it, err := s.idx.Search(context.TODO(), index.Query{
+		Type:       index.QueryTypeHybrid,
+		Expression: "bicycle repairs",
+		Highlight:  &index.HighlightOptions{},
+	})
+	c.Assert(err, gc.IsNil)
+	for it.Next() {
+		hl := it.Highlights()
+		c.Assert(hl, gc.NotNil)
+		if it.Document().LinkID == ids[0] {
+			c.Assert(hl.Title, gc.DeepEquals, []string{"<em>Bicycle</em> shop"})
+		}
+	}
+	c.Assert(it.Close(), gc.IsNil)
+}
+
+func (s *HybridTestSuite) TestHybridSearchWithInvalidQuery(c *gc.C) {
+	invalidWeight := 1.5
+	for _, q := range []index.Query{
+		{Type: index.QueryTypeHybrid, Expression: "bicycle", VectorWeight: &invalidWeight},
+		{Type: index.QueryTypeHybrid, Expression: "bicycle", Collapse: &index.CollapseOptions{}},
+		{Type: index.QueryTypeHybrid, Expression: "bicycle", Facets: &index.FacetOptions{}},
+	} {
+		_, err := s.idx.Search(context.TODO(), q)
+		c.Assert(xerrors.Is(err, index.ErrInvalidQuery), gc.Equals, true, gc.Commentf("%v", err))
+	}
+
+	// Indexers without a vector index reject hybrid queries.
+	_, err := s.inner.Search(context.TODO(), index.Query{Type: index.QueryTypeHybrid, Expression: "bicycle"})
+	c.Assert(xerrors.Is(err, index.ErrInvalidQuery), gc.Equals, true, gc.Commentf("%v", err))
+}
+
+func (s *HybridTestSuite) TestVectorIndexFollowsWrites(c *gc.C) {
+	ids := s.indexBikeDocs(c)
+	c.Assert(s.idx.vectors.Len(), gc.Equals, 3)
+
+	c.Assert(s.idx.Delete(context.TODO(), ids[1]), gc.IsNil)
+	got, _ := s.search(c, index.Query{Type: index.QueryTypeHybrid, Expression: "bicycle repairs"})
+	c.Assert(got, gc.DeepEquals, []uuid.UUID{ids[0]})
+
+	// Score-only documents do not have an embedding.
+	c.Assert(s.idx.UpdateScore(context.TODO(), uuid.New(), 0.5), gc.IsNil)
+	c.Assert(s.idx.vectors.Len(), gc.Equals, 2)
+
+	// Wrapping a populated indexer embeds its existing documents.
+	rebuilt, err := NewHybridIndexer(context.TODO(), s.inner, 0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rebuilt.vectors.Len(), gc.Equals, 2)
+}
@@ -0,0 +1,85 @@
+package hybrid
+
+import (
+	"test_project/Chapter06/textindexer/index"
+)
+
+// result is a scored candidate of a hybrid query.
+type result struct {
+	doc        *index.Document
+	highlights *index.Highlights
+
+	// lexical is the score reported by the wrapped indexer or zero if
+	// the document was only retrieved via the vector index. score is the
+	// fused score of the document.
+	lexical float64
+	score   float64
+}
+
+// resultIterator implements index.Iterator over the results of a hybrid
+// query.
+type resultIterator struct {
+	results []*result
+	total   uint64
+	cur     *result
+}
+
+// Next advances the iterator to the next result. It returns false if no more
+// results are available.
+func (it *resultIterator) Next() bool {
+	if len(it.results) == 0 {
+		it.cur = nil
+		return false
+	}
+	it.cur, it.results = it.results[0], it.results[1:]
+	return true
+}
+
+// Document returns the current document.
+func (it *resultIterator) Document() *index.Document {
+	doc := *it.cur.doc
+	return &doc
+}
+
+// Highlights returns the highlighted fragments for the current document.
+// Documents that were only retrieved via the vector index do not have any
+// highlighted fragments.
+func (it *resultIterator) Highlights() *index.Highlights {
+	return it.cur.highlights
+}
+
+// Facets returns nil as hybrid queries do not support facets.
+func (it *resultIterator) Facets() *index.Facets {
+	return nil
+}
+
+// Cursor returns the continuation token for the current document.
+func (it *resultIterator) Cursor() string {
+	return index.Cursor{Score: it.cur.score, LinkID: it.cur.doc.LinkID}.Encode()
+}
+
+// Collapsed returns zero as hybrid queries do not support collapsing.
+func (it *resultIterator) Collapsed() uint64 {
+	return 0
+}
+
+// Score returns the fused score of the current document.
+func (it *resultIterator) Score() float64 {
+	return it.cur.score
+}
+
+// TotalCount returns the number of scored candidates of the query.
+func (it *resultIterator) TotalCount() uint64 {
+	return it.total
+}
+
+// Error returns nil as all results are fetched before iterating.
+func (it *resultIterator) Error() error {
+	return nil
+}
+
+// Close releases the results of the iterator.
+func (it *resultIterator) Close() error {
+	it.results, it.cur = nil, nil
+	return nil
+}
@@ -1,16 +1,26 @@
 package memory
 
 import (
+	"context"
 	"github.com/blevesearch/bleve"
-	"github.com/blevesearch/bleve/search/query"
 	"github.com/google/uuid"
 	"golang.org/x/xerrors"
+	"sort"
 	"sync"
 	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/store/bleveutil"
 	"time"
 )
 
-const batchSize = 10
+var (
+	_ index.Indexer         = (*InMemoryBleveIndexer)(nil)
+	_ index.DuplicateFinder = (*InMemoryBleveIndexer)(nil)
+	_ index.Scanner         = (*InMemoryBleveIndexer)(nil)
+	_ index.Restorer        = (*InMemoryBleveIndexer)(nil)
+	_ index.Suggester       = (*InMemoryBleveIndexer)(nil)
+	_ index.Completer       = (*InMemoryBleveIndexer)(nil)
+	_ index.RelatedFinder   = (*InMemoryBleveIndexer)(nil)
+)
 
 type InMemoryBleveIndexer struct {
 	mu   sync.RWMutex
@@ -19,14 +29,29 @@ type InMemoryBleveIndexer struct {
 	idx bleve.Index
 }
 type bleveDoc struct {
-	Title    string
-	Content  string
-	PageRank float64
+	URL              string
+	Host             string
+	Title            string
+	Content          string
+	IndexedAtDate    *time.Time
+	FingerprintBands []string
+	PageRank         float64
+	Language         string
+	LocalizedContent map[string]string
 }
 
 func NewInMemoryBleveIndexer() (*InMemoryBleveIndexer, error) {
-	mapping := bleve.NewIndexMapping()
-	idx, err := bleve.NewMemOnly(mapping)
+	return NewInMemoryBleveIndexerWithAnalysis(index.AnalysisConfig{})
+}
+
+// NewInMemoryBleveIndexerWithAnalysis creates an in-memory indexer that
+// analyzes the Title and Content of documents according to analysis.
+func NewInMemoryBleveIndexerWithAnalysis(analysis index.AnalysisConfig) (*InMemoryBleveIndexer, error) {
+	m, err := bleveutil.NewIndexMapping(analysis)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := bleve.NewMemOnly(m)
 	if err != nil {
 		return nil, err
 	}
@@ -37,11 +62,15 @@ func NewInMemoryBleveIndexer() (*InMemoryBleveIndexer, error) {
 	}, nil
 }
 
-func (i *InMemoryBleveIndexer) Index(doc *index.Document) error {
+func (i *InMemoryBleveIndexer) Index(ctx context.Context, doc *index.Document) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("index: %w", err)
+	}
 	if doc.LinkID == uuid.Nil {
 		return xerrors.Errorf("index: %w", index.ErrMissingLinkID)
 	}
 	doc.IndexedAt = time.Now()
+	doc.Fingerprint = index.Fingerprint(doc.Content)
 	dCopy := copyDoc(doc)
 	key := dCopy.LinkID.String()
 	i.mu.Lock()
@@ -62,7 +91,10 @@ func copyDoc(doc *index.Document) *index.Document {
 	return dCopy
 }
 
-func (i *InMemoryBleveIndexer) FindByID(linkID uuid.UUID) (*index.Document, error) {
+func (i *InMemoryBleveIndexer) FindByID(ctx context.Context, linkID uuid.UUID) (*index.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("find by ID: %w", err)
+	}
 	return i.findByID(linkID.String())
 }
 
@@ -75,28 +107,61 @@ func (i *InMemoryBleveIndexer) findByID(linkID string) (*index.Document, error)
 	return nil, xerrors.Errorf("find by ID: %w", index.ErrNotFound)
 }
 
-func (i *InMemoryBleveIndexer) Search(q index.Query) (index.Iterator, error) {
+func (i *InMemoryBleveIndexer) Search(ctx context.Context, q index.Query) (index.Iterator, error) {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
-	var bq query.Query
-	switch q.Type {
-	case index.QueryTypeMatch:
-		bq = bleve.NewMatchQuery(q.Expression)
-	case index.QueryTypePhrase:
-		bq = bleve.NewMatchPhraseQuery(q.Expression)
+	bq, err := bleveutil.NewQuery(q)
+	if err != nil {
+		return nil, xerrors.Errorf("search: %w", err)
 	}
 	searchReq := bleve.NewSearchRequest(bq)
-	searchReq.SortBy([]string{"-PageRank", "-_score"})
-	searchReq.Size = batchSize
-	searchReq.From = int(q.Offset)
-	rs, err := i.idx.Search(searchReq)
+	searchReq.SortBy(bleveutil.SortOrder)
+	searchReq.Size = q.PageSizeOrDefault()
+	it := &bleveIterator{ctx: ctx, idx: i, searchReq: searchReq}
+	if q.Highlight != nil {
+		searchReq.IncludeLocations = true
+		it.highlighter = bleveutil.NewHighlighter(i.idx, *q.Highlight)
+	}
+	var facetOpts index.FacetOptions
+	if q.Facets != nil {
+		facetOpts = q.Facets.WithDefaults()
+		bleveutil.AddFacets(searchReq, facetOpts)
+	}
+	if q.Collapse != nil {
+		if it.collapser, err = bleveutil.NewCollapser(ctx, i.idx, searchReq, q); err != nil {
+			return nil, xerrors.Errorf("search: %w", err)
+		}
+		it.total = it.collapser.TotalCount()
+		if q.Facets != nil {
+			it.facets = bleveutil.MapFacets(it.collapser.Facets(), facetOpts)
+		}
+		return it, nil
+	}
+	if q.Cursor != "" {
+		if searchReq.SearchAfter, err = bleveutil.SearchAfter(q.Cursor); err != nil {
+			return nil, xerrors.Errorf("search: %w", err)
+		}
+	} else {
+		searchReq.From = int(q.Offset)
+	}
+	rs, err := i.idx.SearchInContext(ctx, searchReq)
 	if err != nil {
 		return nil, xerrors.Errorf("search: %w", err)
 	}
-	return &bleveIterator{idx: i, searchReq: searchReq, rs: rs, cumIdx: q.Offset}, nil
+	it.rs, it.total = rs, rs.Total
+	if q.Facets != nil {
+		it.facets = bleveutil.MapFacets(rs.Facets, facetOpts)
+		// Facets only need to be calculated once; skip them when
+		// fetching subsequent result pages.
+		searchReq.Facets = nil
+	}
+	return it, nil
 }
 
-func (i *InMemoryBleveIndexer) UpdateScore(linkID uuid.UUID, score float64) error {
+func (i *InMemoryBleveIndexer) UpdateScore(ctx context.Context, linkID uuid.UUID, score float64) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("update score: %w", err)
+	}
 	i.mu.Lock()
 	defer i.mu.Unlock()
 	doc, found := i.docs[linkID.String()]
@@ -111,14 +176,323 @@ func (i *InMemoryBleveIndexer) UpdateScore(linkID uuid.UUID, score float64) erro
 	return nil
 }
 
+func (i *InMemoryBleveIndexer) IndexMany(ctx context.Context, docs []*index.Document) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("index many: %w", err)
+	}
+	var (
+		bulkErr index.BulkError
+		pending = make(map[string]*index.Document, len(docs))
+		now     = time.Now()
+	)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	batch := i.idx.NewBatch()
+	for pos, doc := range docs {
+		if doc.LinkID == uuid.Nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, Err: index.ErrMissingLinkID})
+			continue
+		}
+		doc.IndexedAt = now
+		doc.Fingerprint = index.Fingerprint(doc.Content)
+		dCopy := copyDoc(doc)
+		key := dCopy.LinkID.String()
+		if savedDoc, exists := i.docs[key]; exists {
+			dCopy.PageRank = savedDoc.PageRank
+		}
+		if err := batch.Index(key, makeBleveDoc(dCopy)); err != nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, LinkID: dCopy.LinkID, Err: err})
+			continue
+		}
+		pending[key] = dCopy
+	}
+	if err := i.idx.Batch(batch); err != nil {
+		return xerrors.Errorf("index many: %w", err)
+	}
+	for key, doc := range pending {
+		i.docs[key] = doc
+	}
+	if len(bulkErr.Items) != 0 {
+		return xerrors.Errorf("index many: %w", &bulkErr)
+	}
+	return nil
+}
+
+func (i *InMemoryBleveIndexer) UpdateScores(ctx context.Context, updates []index.ScoreUpdate) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("update scores: %w", err)
+	}
+	var (
+		bulkErr index.BulkError
+		pending = make(map[string]*index.Document, len(updates))
+	)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	batch := i.idx.NewBatch()
+	for pos, update := range updates {
+		key := update.LinkID.String()
+		doc := pending[key]
+		if doc == nil {
+			if savedDoc, found := i.docs[key]; found {
+				doc = copyDoc(savedDoc)
+			} else {
+				doc = &index.Document{LinkID: update.LinkID}
+			}
+		}
+		doc.PageRank = update.Score
+		if err := batch.Index(key, makeBleveDoc(doc)); err != nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, LinkID: update.LinkID, Err: err})
+			continue
+		}
+		pending[key] = doc
+	}
+	if err := i.idx.Batch(batch); err != nil {
+		return xerrors.Errorf("update scores: %w", err)
+	}
+	for key, doc := range pending {
+		i.docs[key] = doc
+	}
+	if len(bulkErr.Items) != 0 {
+		return xerrors.Errorf("update scores: %w", &bulkErr)
+	}
+	return nil
+}
+
+func (i *InMemoryBleveIndexer) Delete(ctx context.Context, linkID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("delete: %w", err)
+	}
+	key := linkID.String()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, found := i.docs[key]; !found {
+		return xerrors.Errorf("delete: %w", index.ErrNotFound)
+	}
+	if err := i.idx.Delete(key); err != nil {
+		return xerrors.Errorf("delete: %w", err)
+	}
+	delete(i.docs, key)
+	return nil
+}
+
+func (i *InMemoryBleveIndexer) Expire(ctx context.Context, indexedBefore time.Time) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, xerrors.Errorf("expire: %w", err)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	batch := i.idx.NewBatch()
+	for key, doc := range i.docs {
+		if doc.IndexedAt.Before(indexedBefore) {
+			batch.Delete(key)
+		}
+	}
+	if batch.Size() == 0 {
+		return 0, nil
+	}
+	if err := i.idx.Batch(batch); err != nil {
+		return 0, xerrors.Errorf("expire: %w", err)
+	}
+	var count uint64
+	for key, doc := range i.docs {
+		if doc.IndexedAt.Before(indexedBefore) {
+			delete(i.docs, key)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (i *InMemoryBleveIndexer) FindDuplicates(ctx context.Context, linkID uuid.UUID) ([]*index.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	doc, err := i.findByID(linkID.String())
+	if err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	return i.findDuplicates(ctx, doc)
+}
+
+// FindDuplicatesOf returns the near-duplicates of doc, which does not need to
+// be stored in the index. If the Fingerprint of doc is not set, it is
+// computed from its Content.
+func (i *InMemoryBleveIndexer) FindDuplicatesOf(ctx context.Context, doc *index.Document) ([]*index.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	dCopy := copyDoc(doc)
+	if dCopy.Fingerprint == 0 {
+		dCopy.Fingerprint = index.Fingerprint(dCopy.Content)
+	}
+	return i.findDuplicates(ctx, dCopy)
+}
+
+func (i *InMemoryBleveIndexer) findDuplicates(ctx context.Context, doc *index.Document) ([]*index.Document, error) {
+	if doc.Fingerprint == 0 {
+		return nil, nil
+	}
+	searchReq := bleve.NewSearchRequest(bleveutil.NewDuplicatesQuery(doc.Fingerprint))
+	searchReq.Size = bleveutil.MaxDuplicateCandidates
+	rs, err := i.idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, xerrors.Errorf("find duplicates: %w", err)
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	candidates := make([]*index.Document, 0, len(rs.Hits))
+	for _, hit := range rs.Hits {
+		if candidate, found := i.docs[hit.ID]; found {
+			candidates = append(candidates, copyDoc(candidate))
+		}
+	}
+	return index.NearDuplicates(doc, candidates), nil
+}
+
+func (i *InMemoryBleveIndexer) Scan(ctx context.Context) (index.DocumentIterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("scan: %w", err)
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	docs := make([]*index.Document, 0, len(i.docs))
+	for _, doc := range i.docs {
+		docs = append(docs, copyDoc(doc))
+	}
+	sort.Slice(docs, func(l, r int) bool {
+		return docs[l].LinkID.String() < docs[r].LinkID.String()
+	})
+	return &docIterator{docs: docs}, nil
+}
+
+func (i *InMemoryBleveIndexer) Restore(ctx context.Context, docs []*index.Document) error {
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("restore: %w", err)
+	}
+	var (
+		bulkErr index.BulkError
+		pending = make(map[string]*index.Document, len(docs))
+	)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	batch := i.idx.NewBatch()
+	for pos, doc := range docs {
+		if doc.LinkID == uuid.Nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, Err: index.ErrMissingLinkID})
+			continue
+		}
+		dCopy := copyDoc(doc)
+		dCopy.Fingerprint = index.Fingerprint(dCopy.Content)
+		key := dCopy.LinkID.String()
+		if err := batch.Index(key, makeBleveDoc(dCopy)); err != nil {
+			bulkErr.Items = append(bulkErr.Items, index.ItemError{Index: pos, LinkID: dCopy.LinkID, Err: err})
+			continue
+		}
+		pending[key] = dCopy
+	}
+	if err := i.idx.Batch(batch); err != nil {
+		return xerrors.Errorf("restore: %w", err)
+	}
+	for key, doc := range pending {
+		i.docs[key] = doc
+	}
+	if len(bulkErr.Items) != 0 {
+		return xerrors.Errorf("restore: %w", &bulkErr)
+	}
+	return nil
+}
+
+// Suggest corrects the misspelled words of expression using the terms of
+// the indexed Title and Content fields.
+func (i *InMemoryBleveIndexer) Suggest(ctx context.Context, expression string) (string, error) {
+	suggestion, err := bleveutil.Suggest(ctx, i.idx, expression)
+	if err != nil {
+		return "", xerrors.Errorf("suggest: %w", err)
+	}
+	return suggestion, nil
+}
+
+func (i *InMemoryBleveIndexer) Complete(ctx context.Context, prefix string, limit int) ([]index.Completion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("complete: %w", err)
+	}
+	searchReq := bleveutil.NewCompletionRequest(prefix)
+	if searchReq == nil {
+		return nil, nil
+	}
+	rs, err := i.idx.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, xerrors.Errorf("complete: %w", err)
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	candidates := make([]*index.Document, 0, len(rs.Hits))
+	for _, hit := range rs.Hits {
+		if candidate, found := i.docs[hit.ID]; found {
+			candidates = append(candidates, copyDoc(candidate))
+		}
+	}
+	return index.MakeCompletions(prefix, candidates, limit), nil
+}
+
+func (i *InMemoryBleveIndexer) Related(ctx context.Context, linkID uuid.UUID, n int) (index.Iterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	doc, err := i.findByID(linkID.String())
+	if err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	return i.related(ctx, doc, n, false)
+}
+
+// RelatedTo returns the documents that are related to doc, which is treated
+// as if it was not stored in the index: it is counted as an additional
+// document when selecting its terms and any stored document with the same
+// link ID is excluded from the results.
+func (i *InMemoryBleveIndexer) RelatedTo(ctx context.Context, doc *index.Document, n int) (index.Iterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	return i.related(ctx, doc, n, true)
+}
+
+func (i *InMemoryBleveIndexer) related(ctx context.Context, doc *index.Document, n int, external bool) (index.Iterator, error) {
+	rq, err := bleveutil.NewRelatedQuery(i.idx, doc, external)
+	if err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	it := &bleveIterator{ctx: ctx, idx: i, firstPageOnly: true}
+	if rq == nil {
+		return it, nil
+	}
+	if n <= 0 {
+		n = index.DefaultRelatedLimit
+	}
+	it.searchReq = bleve.NewSearchRequest(rq)
+	it.searchReq.SortBy(bleveutil.SortOrder)
+	it.searchReq.Size = n
+	if it.rs, err = i.idx.SearchInContext(ctx, it.searchReq); err != nil {
+		return nil, xerrors.Errorf("related: %w", err)
+	}
+	it.total = it.rs.Total
+	return it, nil
+}
+
 func (i *InMemoryBleveIndexer) Close() error {
 	return i.idx.Close()
 }
 
 func makeBleveDoc(d *index.Document) bleveDoc {
 	return bleveDoc{
-		Title:    d.Title,
-		Content:  d.Content,
-		PageRank: d.PageRank,
+		URL:              d.URL,
+		Host:             index.URLHost(d.URL),
+		Title:            d.Title,
+		Content:          d.Content,
+		IndexedAtDate:    bleveutil.DateField(d.IndexedAt),
+		FingerprintBands: bleveutil.FingerprintBands(d.Fingerprint),
+		PageRank:         d.PageRank,
+		Language:         d.Language,
+		LocalizedContent: bleveutil.LocalizedContent(d),
 	}
 }
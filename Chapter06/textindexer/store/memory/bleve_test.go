@@ -1,7 +1,13 @@
 package memory
 
 import (
+	"context"
+	"github.com/google/uuid"
 	gc "gopkg.in/check.v1"
+	"math/rand"
+	"strings"
+	"sync"
+	"test_project/Chapter06/textindexer/index"
 	"test_project/Chapter06/textindexer/index/indextest"
 	"testing"
 )
@@ -21,9 +27,68 @@ func (s *InMemoryBleveTestSuite) SetUpTest(c *gc.C) {
 	idx, err := NewInMemoryBleveIndexer()
 	c.Assert(err, gc.IsNil)
 	s.SetIndexer(idx)
+	s.SetAnalyzedIndexerFactory(func(cfg index.AnalysisConfig) (index.Indexer, error) {
+		return NewInMemoryBleveIndexerWithAnalysis(cfg)
+	})
 	s.idx = idx
 }
 
 func (s *InMemoryBleveTestSuite) TearDownTest(c *gc.C) {
 	c.Assert(s.idx.Close(), gc.IsNil)
 }
+
+// benchmarkDocCount is the number of documents in the index used by
+// BenchmarkComplete.
+const benchmarkDocCount = 20000
+
+var (
+	benchmarkIdxOnce sync.Once
+	benchmarkIdx     *InMemoryBleveIndexer
+	benchmarkIdxErr  error
+)
+
+// completionBenchmarkIndexer returns an indexer holding benchmarkDocCount
+// documents with synthetic titles and PageRank scores. The index is built on
+// first use and shared by all benchmark runs.
+func completionBenchmarkIndexer(b *testing.B) *InMemoryBleveIndexer {
+	benchmarkIdxOnce.Do(func() {
+		if benchmarkIdx, benchmarkIdxErr = NewInMemoryBleveIndexer(); benchmarkIdxErr != nil {
+			return
+		}
+		var (
+			rng       = rand.New(rand.NewSource(42))
+			syllables = []string{"go", "pher", "ro", "u", "tine", "con", "cur", "ren", "cy", "da", "ta", "base", "net", "work", "pro", "gram"}
+			docs      = make([]*index.Document, benchmarkDocCount)
+		)
+		for i := range docs {
+			words := make([]string, 3+rng.Intn(4))
+			for j := range words {
+				var word strings.Builder
+				for k := 1 + rng.Intn(3); k > 0; k-- {
+					word.WriteString(syllables[rng.Intn(len(syllables))])
+				}
+				words[j] = word.String()
+			}
+			docs[i] = &index.Document{LinkID: uuid.New(), Title: strings.Join(words, " "), PageRank: rng.Float64()}
+		}
+		benchmarkIdxErr = benchmarkIdx.Restore(context.TODO(), docs)
+	})
+	if benchmarkIdxErr != nil {
+		b.Fatal(benchmarkIdxErr)
+	}
+	return benchmarkIdx
+}
+
+func BenchmarkComplete(b *testing.B) {
+	idx := completionBenchmarkIndexer(b)
+	for _, prefix := range []string{"g", "go", "gopher", "gopher ro", "con", "concurren"} {
+		b.Run(prefix, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := idx.Complete(context.TODO(), prefix, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,46 +1,131 @@
 package memory
 
 import (
+	"context"
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
 	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/store/bleveutil"
 )
 
 type bleveIterator struct {
+	ctx        context.Context
 	idx        *InMemoryBleveIndexer
 	searchReq  *bleve.SearchRequest
 	rs         *bleve.SearchResult
 	rsIdx      int
-	cumIdx     uint64
 	latchedDoc *index.Document
 	lastErr    error
+
+	// total is the number of matching documents reported by the initial
+	// search request.
+	total         uint64
+	latchedCursor string
+	latchedScore  float64
+
+	// highlighter is only set when the query requested highlighting.
+	highlighter       *bleveutil.Highlighter
+	latchedHighlights *index.Highlights
+
+	// facets is only set when the query requested facets.
+	facets *index.Facets
+
+	// collapser replaces the paging of the search request when the query
+	// requested collapsing.
+	collapser *bleveutil.Collapser
+
+	// firstPageOnly is set when the results are limited to the first
+	// page of the search request.
+	firstPageOnly bool
 }
 
 func (l *bleveIterator) Next() bool {
-	if l.lastErr != nil || l.rs == nil || l.cumIdx >= l.rs.Total {
+	hit := l.nextHit()
+	if hit == nil {
 		return false
 	}
-	if l.rsIdx >= l.rs.Hits.Len() {
-		l.searchReq.From += l.searchReq.Size
-		if l.rs, l.lastErr = l.idx.idx.Search(l.searchReq); l.lastErr != nil {
+	if l.latchedDoc, l.lastErr = l.idx.findByID(hit.ID); l.lastErr != nil {
+		return false
+	}
+	if l.highlighter != nil {
+		if l.latchedHighlights, l.lastErr = l.highlighter.Highlight(hit); l.lastErr != nil {
 			return false
 		}
-		l.rsIdx = 0
 	}
-	nextID := l.rs.Hits[l.rsIdx].ID
-	if l.latchedDoc, l.lastErr = l.idx.findByID(nextID); l.lastErr != nil {
-		return false
+	l.latchedScore = hit.Score
+	if l.collapser != nil {
+		l.latchedCursor = l.collapser.Cursor()
+	} else {
+		l.latchedCursor = bleveutil.HitCursor(hit)
 	}
-	l.rsIdx++
-	l.cumIdx++
 	return true
 }
 
+// nextHit returns the next matching document or nil if no more documents are
+// available.
+func (l *bleveIterator) nextHit() *search.DocumentMatch {
+	if l.collapser != nil {
+		if l.lastErr != nil {
+			return nil
+		}
+		if !l.collapser.Next() {
+			l.lastErr = l.collapser.Error()
+			return nil
+		}
+		return l.collapser.Hit()
+	}
+	if l.lastErr != nil || l.rs == nil {
+		return nil
+	}
+	if l.rsIdx >= l.rs.Hits.Len() {
+		// A partial page indicates that there are no more results.
+		if l.firstPageOnly || l.rs.Hits.Len() < l.searchReq.Size {
+			return nil
+		}
+		l.searchReq.From = 0
+		l.searchReq.SearchAfter = bleveutil.HitSearchAfter(l.rs.Hits[l.rsIdx-1])
+		if l.rs, l.lastErr = l.idx.idx.SearchInContext(l.ctx, l.searchReq); l.lastErr != nil {
+			return nil
+		}
+		l.rsIdx = 0
+		if l.rs.Hits.Len() == 0 {
+			return nil
+		}
+	}
+	hit := l.rs.Hits[l.rsIdx]
+	l.rsIdx++
+	return hit
+}
+
 func (l *bleveIterator) Document() *index.Document {
 	return copyDoc(l.latchedDoc)
 }
 
+func (l *bleveIterator) Highlights() *index.Highlights {
+	return l.latchedHighlights
+}
+
+func (l *bleveIterator) Facets() *index.Facets {
+	return l.facets
+}
+
+func (l *bleveIterator) Cursor() string {
+	return l.latchedCursor
+}
+
+func (l *bleveIterator) Collapsed() uint64 {
+	if l.collapser == nil {
+		return 0
+	}
+	return l.collapser.Collapsed()
+}
+
+func (l *bleveIterator) Score() float64 {
+	return l.latchedScore
+}
+
 func (i bleveIterator) TotalCount() uint64 {
-	return i.rs.Total
+	return i.total
 }
 
 // Error implements graph.LinkIterator.
@@ -52,3 +137,29 @@ func (i *bleveIterator) Error() error {
 func (i *bleveIterator) Close() error {
 	return nil
 }
+
+// docIterator iterates over a snapshot of the indexed documents.
+type docIterator struct {
+	docs   []*index.Document
+	curIdx int
+}
+
+func (i *docIterator) Next() bool {
+	if i.curIdx >= len(i.docs) {
+		return false
+	}
+	i.curIdx++
+	return true
+}
+
+func (i *docIterator) Document() *index.Document {
+	return copyDoc(i.docs[i.curIdx-1])
+}
+
+func (i *docIterator) Error() error {
+	return nil
+}
+
+func (i *docIterator) Close() error {
+	return nil
+}
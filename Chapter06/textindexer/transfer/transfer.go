@@ -0,0 +1,124 @@
+// Package transfer copies documents between text indexers, either directly
+// or via a JSON Lines stream where each line holds an index.Document.
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"golang.org/x/xerrors"
+	"io"
+	"test_project/Chapter06/textindexer/index"
+)
+
+// DefaultBatchSize is the number of documents restored per request when no
+// batch size is specified.
+const DefaultBatchSize = 500
+
+// Export writes every document of idx, including its PageRank and IndexedAt
+// values, to w as JSON Lines. It returns the number of exported documents.
+func Export(ctx context.Context, idx index.Scanner, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	count, err := scan(ctx, idx, func(doc *index.Document) error {
+		return enc.Encode(doc)
+	})
+	if err != nil {
+		return count, xerrors.Errorf("export: %w", err)
+	}
+	return count, nil
+}
+
+// Import reads the documents written by Export from r and restores them into
+// idx in batches of batchSize documents, preserving their PageRank and
+// IndexedAt values. If batchSize is not positive, DefaultBatchSize will be
+// used. Import stops at the first error and returns the number of documents
+// that were restored up to that point.
+func Import(ctx context.Context, idx index.Restorer, r io.Reader, batchSize int) (int, error) {
+	var (
+		b   = newBatcher(ctx, idx, batchSize)
+		dec = json.NewDecoder(r)
+	)
+	for pos := 0; ; pos++ {
+		doc := new(index.Document)
+		if err := dec.Decode(doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return b.restored, xerrors.Errorf("import: decode document %d: %w", pos, err)
+		}
+		if err := b.add(doc); err != nil {
+			return b.restored, xerrors.Errorf("import: %w", err)
+		}
+	}
+	if err := b.flush(); err != nil {
+		return b.restored, xerrors.Errorf("import: %w", err)
+	}
+	return b.restored, nil
+}
+
+// Migrate copies every document of src into dst in batches of batchSize
+// documents, preserving their PageRank and IndexedAt values. If batchSize is
+// not positive, DefaultBatchSize will be used. It returns the number of
+// copied documents.
+func Migrate(ctx context.Context, src index.Scanner, dst index.Restorer, batchSize int) (int, error) {
+	b := newBatcher(ctx, dst, batchSize)
+	if _, err := scan(ctx, src, b.add); err != nil {
+		return b.restored, xerrors.Errorf("migrate: %w", err)
+	}
+	if err := b.flush(); err != nil {
+		return b.restored, xerrors.Errorf("migrate: %w", err)
+	}
+	return b.restored, nil
+}
+
+// scan invokes visit for every document of idx and returns the number of
+// visited documents.
+func scan(ctx context.Context, idx index.Scanner, visit func(*index.Document) error) (int, error) {
+	it, err := idx.Scan(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = it.Close() }()
+
+	var count int
+	for it.Next() {
+		if err = visit(it.Document()); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, it.Error()
+}
+
+// batcher accumulates documents and restores them in batches.
+type batcher struct {
+	ctx       context.Context
+	idx       index.Restorer
+	batchSize int
+	pending   []*index.Document
+	restored  int
+}
+
+func newBatcher(ctx context.Context, idx index.Restorer, batchSize int) *batcher {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &batcher{ctx: ctx, idx: idx, batchSize: batchSize}
+}
+
+func (b *batcher) add(doc *index.Document) error {
+	if b.pending = append(b.pending, doc); len(b.pending) < b.batchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+func (b *batcher) flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	if err := b.idx.Restore(b.ctx, b.pending); err != nil {
+		return xerrors.Errorf("restore documents %d-%d: %w", b.restored, b.restored+len(b.pending)-1, err)
+	}
+	b.restored += len(b.pending)
+	b.pending = b.pending[:0]
+	return nil
+}
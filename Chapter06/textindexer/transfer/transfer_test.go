@@ -0,0 +1,125 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	gc "gopkg.in/check.v1"
+	"io/ioutil"
+	"os"
+	"strings"
+	"test_project/Chapter06/textindexer/index"
+	"test_project/Chapter06/textindexer/store/disk"
+	"test_project/Chapter06/textindexer/store/memory"
+	"testing"
+	"time"
+)
+
+var _ = gc.Suite(new(TransferTestSuite))
+
+func Test(t *testing.T) { gc.TestingT(t) }
+
+type TransferTestSuite struct {
+	src *memory.InMemoryBleveIndexer
+}
+
+func (s *TransferTestSuite) SetUpTest(c *gc.C) {
+	var err error
+	s.src, err = memory.NewInMemoryBleveIndexer()
+	c.Assert(err, gc.IsNil)
+
+	for i := 0; i < 7; i++ {
+		doc := &index.Document{
+			LinkID:    uuid.New(),
+			URL:       fmt.Sprintf("http://example.com/%d", i),
+			Title:     fmt.Sprintf("Page %d", i),
+			Content:   fmt.Sprintf("Gophers dig tunnel number %d", i),
+			IndexedAt: time.Now().Add(-time.Duration(i) * time.Hour).UTC(),
+		}
+		c.Assert(s.src.Index(context.TODO(), doc), gc.IsNil)
+		c.Assert(s.src.UpdateScore(context.TODO(), doc.LinkID, float64(i)/10), gc.IsNil)
+	}
+}
+
+func (s *TransferTestSuite) TearDownTest(c *gc.C) {
+	c.Assert(s.src.Close(), gc.IsNil)
+}
+
+func (s *TransferTestSuite) TestExportImport(c *gc.C) {
+	var buf bytes.Buffer
+	n, err := Export(context.TODO(), s.src, &buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 7)
+	c.Assert(strings.Count(buf.String(), "\n"), gc.Equals, 7)
+
+	dst, err := memory.NewInMemoryBleveIndexer()
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(dst.Close(), gc.IsNil) }()
+
+	n, err = Import(context.TODO(), dst, &buf, 3)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 7)
+	c.Assert(scanAll(c, dst), gc.DeepEquals, scanAll(c, s.src))
+}
+
+func (s *TransferTestSuite) TestMigrateToDisk(c *gc.C) {
+	tmpDir, err := ioutil.TempDir("", "transfer-test")
+	c.Assert(err, gc.IsNil)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	dst, err := disk.NewPersistentBleveIndexer(tmpDir + "/index")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(dst.Close(), gc.IsNil) }()
+
+	n, err := Migrate(context.TODO(), s.src, dst, 2)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 7)
+	c.Assert(scanAll(c, dst), gc.DeepEquals, scanAll(c, s.src))
+}
+
+func (s *TransferTestSuite) TestImportMalformedInput(c *gc.C) {
+	var buf bytes.Buffer
+	_, err := Export(context.TODO(), s.src, &buf)
+	c.Assert(err, gc.IsNil)
+	lines := strings.SplitAfter(buf.String(), "\n")
+
+	dst, err := memory.NewInMemoryBleveIndexer()
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(dst.Close(), gc.IsNil) }()
+
+	// Documents that precede the malformed one in full batches are
+	// restored.
+	input := strings.Join(lines[:4], "") + "{not json}\n" + strings.Join(lines[4:], "")
+	n, err := Import(context.TODO(), dst, strings.NewReader(input), 2)
+	c.Assert(err, gc.ErrorMatches, "import: decode document 4: .*")
+	c.Assert(n, gc.Equals, 4)
+}
+
+func (s *TransferTestSuite) TestImportMissingLinkID(c *gc.C) {
+	dst, err := memory.NewInMemoryBleveIndexer()
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(dst.Close(), gc.IsNil) }()
+
+	_, err = Import(context.TODO(), dst, strings.NewReader(`{"URL": "http://example.com"}`), 0)
+	var bulkErr *index.BulkError
+	c.Assert(err, gc.ErrorMatches, "import: restore documents 0-0: .*")
+	c.Assert(xerrors.As(err, &bulkErr), gc.Equals, true)
+}
+
+func scanAll(c *gc.C, idx index.Scanner) []*index.Document {
+	it, err := idx.Scan(context.TODO())
+	c.Assert(err, gc.IsNil)
+	var docs []*index.Document
+	for it.Next() {
+		// The in-memory indexer keeps the local time zone of the
+		// IndexedAt values that it assigns.
+		doc := it.Document()
+		doc.IndexedAt = doc.IndexedAt.UTC()
+		docs = append(docs, doc)
+	}
+	c.Assert(it.Error(), gc.IsNil)
+	c.Assert(it.Close(), gc.IsNil)
+	return docs
+}
@@ -0,0 +1,91 @@
+package vector
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultDimensions is the number of dimensions of the embeddings produced by
+// an Index that does not specify its dimensions.
+const DefaultDimensions = 256
+
+// ngramSize is the length of the character n-grams that are extracted from
+// each word in addition to the word itself. Sharing n-grams allows different
+// inflections of a word, e.g. "repair" and "repairing", to contribute to the
+// similarity of two texts.
+const ngramSize = 3
+
+// Vector is a dense, L2-normalized embedding of a text.
+type Vector []float32
+
+// Dot returns the dot product of v and other, which for normalized vectors
+// is their cosine similarity. Vectors of different dimensions have no
+// similarity.
+func (v Vector) Dot(other Vector) float64 {
+	if len(v) != len(other) {
+		return 0
+	}
+	var sum float64
+	for i := range v {
+		sum += float64(v[i]) * float64(other[i])
+	}
+	return sum
+}
+
+// Features returns the hashed features of text together with the number of
+// times each feature occurs. The features of a text are its lowercase words
+// and the character n-grams of each word padded with boundary markers.
+func Features(text string) map[uint64]int {
+	counts := make(map[uint64]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isWordSeparator) {
+		counts[hashFeature("w:"+word)]++
+
+		padded := []rune("<" + word + ">")
+		for i := 0; i+ngramSize <= len(padded); i++ {
+			counts[hashFeature("g:"+string(padded[i:i+ngramSize]))]++
+		}
+	}
+	return counts
+}
+
+// project accumulates the TF-IDF weights of the features into a vector with
+// the specified number of dimensions using the hashing trick: each feature is
+// added to a single dimension, chosen by its hash, with a sign that is also
+// derived from its hash so that collisions tend to cancel out. idf returns
+// the inverse document frequency of a feature. The returned vector is
+// normalized to unit length; texts without features yield a zero vector.
+func project(features map[uint64]int, dims int, idf func(uint64) float64) Vector {
+	v := make(Vector, dims)
+	for feature, tf := range features {
+		weight := (1 + math.Log(float64(tf))) * idf(feature)
+		if feature>>63 == 1 {
+			weight = -weight
+		}
+		v[feature%uint64(dims)] += float32(weight)
+	}
+
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] = float32(float64(v[i]) / norm)
+	}
+	return v
+}
+
+func hashFeature(feature string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(feature))
+	return h.Sum64()
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+}
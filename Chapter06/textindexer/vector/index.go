@@ -0,0 +1,205 @@
+package vector
+
+import (
+	"bytes"
+	"container/heap"
+	"github.com/google/uuid"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Match is an indexed document whose embedding is similar to a query vector.
+type Match struct {
+	LinkID uuid.UUID
+
+	// Score is the cosine similarity between the query vector and the
+	// embedding of the document.
+	Score float64
+}
+
+// entry holds the embedding of an indexed document together with the
+// distinct features it was computed from, which are needed for maintaining
+// the document frequencies when the document is replaced or removed.
+type entry struct {
+	vec       Vector
+	features  []uint64
+	indexedAt time.Time
+}
+
+// Index is an in-memory vector index that embeds documents using a hashed
+// TF-IDF projection of their words and character n-grams and answers
+// nearest-neighbour queries by cosine similarity. Embeddings are computed
+// locally and do not require any external model.
+//
+// The inverse document frequencies of the features are derived from the
+// documents in the index at the time each document is embedded, so the
+// embeddings of earlier documents do not reflect later changes to the corpus.
+// Index is safe for concurrent use.
+type Index struct {
+	mu      sync.RWMutex
+	dims    int
+	docs    map[uuid.UUID]*entry
+	docFreq map[uint64]int
+}
+
+// NewIndex creates an empty index whose embeddings have the specified number
+// of dimensions or DefaultDimensions if dims is not positive.
+func NewIndex(dims int) *Index {
+	if dims <= 0 {
+		dims = DefaultDimensions
+	}
+	return &Index{
+		dims:    dims,
+		docs:    make(map[uuid.UUID]*entry),
+		docFreq: make(map[uint64]int),
+	}
+}
+
+// Dimensions returns the number of dimensions of the embeddings.
+func (i *Index) Dimensions() int {
+	return i.dims
+}
+
+// Len returns the number of documents in the index.
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.docs)
+}
+
+// Add embeds text and stores the embedding for the document with the
+// specified link ID, replacing any existing embedding. indexedAt is recorded
+// for expiring the document via Expire. If text does not contain any words,
+// the document is removed from the index instead.
+func (i *Index) Add(linkID uuid.UUID, text string, indexedAt time.Time) {
+	features := Features(text)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.remove(linkID)
+	if len(features) == 0 {
+		return
+	}
+	e := &entry{features: make([]uint64, 0, len(features)), indexedAt: indexedAt}
+	for feature := range features {
+		e.features = append(e.features, feature)
+		i.docFreq[feature]++
+	}
+	i.docs[linkID] = e
+	e.vec = project(features, i.dims, i.idf)
+}
+
+// Remove deletes the embedding of the document with the specified link ID.
+// It returns false if the document is not in the index.
+func (i *Index) Remove(linkID uuid.UUID) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.remove(linkID)
+}
+
+// Expire removes all documents that were added with an indexedAt time before
+// the specified time and returns their number.
+func (i *Index) Expire(indexedBefore time.Time) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var count int
+	for linkID, e := range i.docs {
+		if e.indexedAt.Before(indexedBefore) {
+			i.remove(linkID)
+			count++
+		}
+	}
+	return count
+}
+
+func (i *Index) remove(linkID uuid.UUID) bool {
+	e, found := i.docs[linkID]
+	if !found {
+		return false
+	}
+	for _, feature := range e.features {
+		if i.docFreq[feature]--; i.docFreq[feature] <= 0 {
+			delete(i.docFreq, feature)
+		}
+	}
+	delete(i.docs, linkID)
+	return true
+}
+
+// Embed returns the embedding of a query text, weighting its features by
+// their current inverse document frequencies.
+func (i *Index) Embed(text string) Vector {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return project(Features(text), i.dims, i.idf)
+}
+
+// idf returns the smoothed inverse document frequency of a feature. The
+// caller must hold the lock.
+func (i *Index) idf(feature uint64) float64 {
+	return 1 + math.Log(float64(1+len(i.docs))/float64(1+i.docFreq[feature]))
+}
+
+// Similarity returns the cosine similarity between v and the embedding of
+// the document with the specified link ID. It returns false if the document
+// is not in the index.
+func (i *Index) Similarity(v Vector, linkID uuid.UUID) (float64, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	e, found := i.docs[linkID]
+	if !found {
+		return 0, false
+	}
+	return v.Dot(e.vec), true
+}
+
+// Nearest returns up to k documents whose embeddings have a positive cosine
+// similarity with v, ordered by descending similarity with ties broken by
+// ascending link ID. The index is searched exhaustively.
+func (i *Index) Nearest(v Vector, k int) []Match {
+	if k <= 0 {
+		return nil
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	var h matchHeap
+	for linkID, e := range i.docs {
+		m := Match{LinkID: linkID, Score: v.Dot(e.vec)}
+		if m.Score <= 0 {
+			continue
+		}
+		if len(h) < k {
+			heap.Push(&h, m)
+		} else if better(m, h[0]) {
+			h[0] = m
+			heap.Fix(&h, 0)
+		}
+	}
+	matches := []Match(h)
+	sort.Slice(matches, func(l, r int) bool { return better(matches[l], matches[r]) })
+	return matches
+}
+
+// better returns true if a ranks before b.
+func better(a, b Match) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return bytes.Compare(a.LinkID[:], b.LinkID[:]) < 0
+}
+
+// matchHeap is a heap of matches whose root is the worst match.
+type matchHeap []Match
+
+func (h matchHeap) Len() int            { return len(h) }
+func (h matchHeap) Less(l, r int) bool  { return better(h[r], h[l]) }
+func (h matchHeap) Swap(l, r int)       { h[l], h[r] = h[r], h[l] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(Match)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
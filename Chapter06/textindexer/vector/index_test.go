@@ -0,0 +1,117 @@
+package vector
+
+import (
+	"github.com/google/uuid"
+	gc "gopkg.in/check.v1"
+	"math"
+	"testing"
+	"time"
+)
+
+var _ = gc.Suite(new(IndexTestSuite))
+
+type IndexTestSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *IndexTestSuite) TestFeatures(c *gc.C) {
+	features := Features("Go, go GOPHERS!")
+	c.Assert(features[hashFeature("w:go")], gc.Equals, 2)
+	c.Assert(features[hashFeature("w:gophers")], gc.Equals, 1)
+	c.Assert(features[hashFeature("g:<go")], gc.Equals, 3)
+	c.Assert(features[hashFeature("g:rs>")], gc.Equals, 1)
+	c.Assert(Features(" ,;! "), gc.HasLen, 0)
+}
+
+func (s *IndexTestSuite) TestEmbed(c *gc.C) {
+	idx := NewIndex(0)
+	c.Assert(idx.Dimensions(), gc.Equals, DefaultDimensions)
+
+	v := idx.Embed("bicycle repair shop")
+	c.Assert(v, gc.HasLen, DefaultDimensions)
+	assertCloseTo(c, v.Dot(v), 1)
+	assertCloseTo(c, v.Dot(idx.Embed("Bicycle REPAIR shop")), 1)
+
+	// Texts without words do not have a direction.
+	assertCloseTo(c, idx.Embed("").Dot(v), 0)
+	assertCloseTo(c, Vector{1, 0}.Dot(Vector{1, 0, 0}), 0)
+}
+
+func (s *IndexTestSuite) TestNearest(c *gc.C) {
+	var (
+		idx   = NewIndex(0)
+		now   = time.Now()
+		ids   = []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+		texts = []string{
+			"Repairing bicycles: how to fix a flat tyre",
+			"Baking sourdough bread at home",
+			"Our bicycle repair shop fixes every bike",
+		}
+	)
+	for i, text := range texts {
+		idx.Add(ids[i], text, now)
+	}
+	c.Assert(idx.Len(), gc.Equals, 3)
+
+	q := idx.Embed("bicycle repairs")
+	matches := idx.Nearest(q, 2)
+	c.Assert(matches, gc.HasLen, 2)
+	c.Assert(matches[0].LinkID, gc.Equals, ids[2])
+	c.Assert(matches[1].LinkID, gc.Equals, ids[0])
+	c.Assert(matches[0].Score >= matches[1].Score, gc.Equals, true)
+
+	sim, found := idx.Similarity(q, ids[2])
+	c.Assert(found, gc.Equals, true)
+	assertCloseTo(c, sim, matches[0].Score)
+	_, found = idx.Similarity(q, uuid.New())
+	c.Assert(found, gc.Equals, false)
+
+	c.Assert(idx.Nearest(q, 0), gc.HasLen, 0)
+	c.Assert(idx.Nearest(idx.Embed(""), 10), gc.HasLen, 0)
+}
+
+func (s *IndexTestSuite) TestAddReplacesEmbedding(c *gc.C) {
+	var (
+		idx = NewIndex(64)
+		id  = uuid.New()
+	)
+	idx.Add(id, "baking sourdough bread", time.Now())
+	idx.Add(id, "bicycle repair shop", time.Now())
+	c.Assert(idx.Len(), gc.Equals, 1)
+
+	matches := idx.Nearest(idx.Embed("bicycle repair shop"), 10)
+	c.Assert(matches, gc.HasLen, 1)
+	assertCloseTo(c, matches[0].Score, 1)
+
+	// Adding a text without words removes the embedding.
+	idx.Add(id, "", time.Now())
+	c.Assert(idx.Len(), gc.Equals, 0)
+	c.Assert(idx.docFreq, gc.HasLen, 0)
+}
+
+func (s *IndexTestSuite) TestRemoveAndExpire(c *gc.C) {
+	var (
+		idx = NewIndex(0)
+		now = time.Now()
+		ids = []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	)
+	idx.Add(ids[0], "old news", now.Add(-2*time.Hour))
+	idx.Add(ids[1], "older news", now.Add(-3*time.Hour))
+	idx.Add(ids[2], "fresh news", now)
+
+	c.Assert(idx.Remove(ids[0]), gc.Equals, true)
+	c.Assert(idx.Remove(ids[0]), gc.Equals, false)
+	c.Assert(idx.Expire(now.Add(-time.Hour)), gc.Equals, 1)
+	c.Assert(idx.Len(), gc.Equals, 1)
+
+	_, found := idx.Similarity(idx.Embed("news"), ids[2])
+	c.Assert(found, gc.Equals, true)
+	c.Assert(idx.Remove(ids[2]), gc.Equals, true)
+	c.Assert(idx.docFreq, gc.HasLen, 0)
+}
+
+func assertCloseTo(c *gc.C, got, exp float64) {
+	c.Assert(math.Abs(got-exp) < 1e-5, gc.Equals, true, gc.Commentf("got %v, expected %v", got, exp))
+}
@@ -2,12 +2,19 @@ package crawler
 
 import (
 	"context"
+	"github.com/hashicorp/go-multierror"
+	"log"
 	"net/http"
 	"test_project/Chapter06/linkgraph/graph"
 	"test_project/Chapter06/textindexer/index"
 	"test_project/Chapter07/pipeline"
+	"time"
 )
 
+// flushTimeout bounds the time for submitting the documents that are still
+// buffered by the text indexer once the pipeline is done.
+const flushTimeout = 30 * time.Second
+
 type linkSource struct {
 	linkIt graph.LinkIterator
 }
@@ -45,12 +52,22 @@ type PrivateNetworkDetector interface {
 }
 
 type Crawler struct {
-	p *pipeline.Pipeline
+	p           *pipeline.Pipeline
+	textIndexer *textIndexer
 }
 type Indexer interface {
 	// Index inserts a new document to the index or updates the index entry
 	// for and existing document.
-	Index(doc *index.Document) error
+	Index(ctx context.Context, doc *index.Document) error
+}
+
+// BulkIndexer is optionally implemented by Indexer instances that can index
+// multiple documents with a single request.
+type BulkIndexer interface {
+	Indexer
+
+	// IndexMany inserts or updates a batch of documents.
+	IndexMany(ctx context.Context, docs []*index.Document) error
 }
 
 type Config struct {
@@ -59,9 +76,19 @@ type Config struct {
 	Graph                  graph.Graph
 	Indexer                Indexer
 	FetchWorkers           int
+
+	// IndexBatchSize, if greater than 1 and Indexer implements
+	// BulkIndexer, causes the crawler to buffer up to IndexBatchSize
+	// documents and submit them with a single bulk request.
+	IndexBatchSize int
+
+	// Logger receives the documents of bulk requests that the Indexer
+	// rejected individually; such documents are skipped. If not
+	// specified, the standard logger will be used.
+	Logger *log.Logger
 }
 
-func assembleCrawlerPipeline(cfg Config) *pipeline.Pipeline {
+func assembleCrawlerPipeline(cfg Config, textIndexer *textIndexer) *pipeline.Pipeline {
 	return pipeline.New(
 		pipeline.FixedWorkerPool(
 			newLinkFetcher(cfg.URLGetter, cfg.PrivateNetworkDetector),
@@ -71,20 +98,35 @@ func assembleCrawlerPipeline(cfg Config) *pipeline.Pipeline {
 		pipeline.FIFO(newTextExtractor()),
 		pipeline.Broadcast(
 			newGraphUpdater(cfg.Graph),
-			newTextIndexer(cfg.Indexer),
+			textIndexer,
 		),
 	)
 }
 
 func NewCrawler(cfg Config) *Crawler {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	textIndexer := newTextIndexer(cfg.Indexer, cfg.IndexBatchSize, logger)
 	return &Crawler{
-		p: assembleCrawlerPipeline(cfg),
+		p:           assembleCrawlerPipeline(cfg, textIndexer),
+		textIndexer: textIndexer,
 	}
 }
 
 func (c *Crawler) Crawl(ctx context.Context, linkIt graph.LinkIterator) (int, error) {
 	sink := new(countingSink)
 	err := c.p.Process(ctx, &linkSource{linkIt: linkIt}, sink)
+
+	// Submit any documents still buffered by the text indexer. As ctx is
+	// usually done by now, a separate context is used for the final
+	// request.
+	flushCtx, cancelFn := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelFn()
+	if flushErr := c.textIndexer.flush(flushCtx); flushErr != nil {
+		err = multierror.Append(err, flushErr)
+	}
 	return sink.getCount(), err
 }
 
@@ -20,6 +20,10 @@ type crawlerPayload struct {
 	Links         []string
 	Title         string
 	TextContent   string
+
+	// Language is the ISO 639-1 code of the detected language of
+	// TextContent or empty if it could not be determined.
+	Language string
 }
 
 func (c *crawlerPayload) Clone() pipeline.Payload {
@@ -31,6 +35,7 @@ func (c *crawlerPayload) Clone() pipeline.Payload {
 	newP.Links = append([]string(nil), c.Links...)
 	newP.Title = c.Title
 	newP.TextContent = c.TextContent
+	newP.Language = c.Language
 	_, err := io.Copy(&newP.RawContent, &c.RawContent)
 	if err != nil {
 		panic(fmt.Sprintf("[BUG] error cloning payload raw content: %v", err))
@@ -45,6 +50,7 @@ func (c *crawlerPayload) MarkAsProcessed() {
 	c.Links = c.Links[:0]
 	c.Title = c.Title[:0]
 	c.TextContent = c.TextContent[:0]
+	c.Language = c.Language[:0]
 	payloadPool.Put(c)
 }
 
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"test_project/Chapter06/textindexer/index"
 	"test_project/Chapter07/pipeline"
 )
 
@@ -43,6 +44,7 @@ func (te *textExtractor) Process(ctx context.Context, p pipeline.Payload) (pipel
 		policy.SanitizeReader(&payload.RawContent).String(), " ",
 	)))
 	te.policyPool.Put(policy)
+	payload.Language = index.DetectLanguage(payload.TextContent)
 
 	return payload, nil
 }
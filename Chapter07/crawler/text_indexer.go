@@ -2,6 +2,9 @@ package crawler
 
 import (
 	"context"
+	"golang.org/x/xerrors"
+	"log"
+	"sync"
 	"test_project/Chapter06/textindexer/index"
 	"test_project/Chapter07/pipeline"
 	"time"
@@ -9,12 +12,28 @@ import (
 
 type textIndexer struct {
 	indexer Indexer
+
+	// When bulkIndexer is set, documents are buffered and submitted in
+	// batches of batchSize.
+	bulkIndexer BulkIndexer
+	batchSize   int
+	mu          sync.Mutex
+	pending     []*index.Document
+
+	// logger receives the documents that were rejected by bulk requests.
+	logger *log.Logger
 }
 
-func newTextIndexer(indexer Indexer) *textIndexer {
-	return &textIndexer{
+func newTextIndexer(indexer Indexer, batchSize int, logger *log.Logger) *textIndexer {
+	ti := &textIndexer{
 		indexer: indexer,
+		logger:  logger,
+	}
+	if bulkIndexer, ok := indexer.(BulkIndexer); ok && batchSize > 1 {
+		ti.bulkIndexer = bulkIndexer
+		ti.batchSize = batchSize
 	}
+	return ti
 }
 
 func (i *textIndexer) Process(ctx context.Context, p pipeline.Payload) (pipeline.Payload, error) {
@@ -26,10 +45,68 @@ func (i *textIndexer) Process(ctx context.Context, p pipeline.Payload) (pipeline
 		Title:     payload.Title,
 		Content:   payload.TextContent,
 		IndexedAt: time.Now(),
+		Language:  payload.Language,
 	}
-	if err := i.indexer.Index(doc); err != nil {
+	if i.bulkIndexer != nil {
+		if err := i.enqueue(ctx, doc); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	if err := i.indexer.Index(ctx, doc); err != nil {
 		return nil, err
 	}
 
 	return p, nil
 }
+
+// enqueue buffers doc and submits the buffered documents once the batch is
+// full.
+func (i *textIndexer) enqueue(ctx context.Context, doc *index.Document) error {
+	i.mu.Lock()
+	i.pending = append(i.pending, doc)
+	if len(i.pending) < i.batchSize {
+		i.mu.Unlock()
+		return nil
+	}
+	batch := i.pending
+	i.pending = nil
+	i.mu.Unlock()
+
+	return i.indexBatch(ctx, batch)
+}
+
+// flush submits any buffered documents.
+func (i *textIndexer) flush(ctx context.Context) error {
+	if i.bulkIndexer == nil {
+		return nil
+	}
+	i.mu.Lock()
+	batch := i.pending
+	i.pending = nil
+	i.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return i.indexBatch(ctx, batch)
+}
+
+// indexBatch submits batch with a single bulk request. Documents that the
+// indexer rejects individually are logged and skipped so that a single bad
+// document does not abort the crawl; any other error is returned.
+func (i *textIndexer) indexBatch(ctx context.Context, batch []*index.Document) error {
+	err := i.bulkIndexer.IndexMany(ctx, batch)
+	var bulkErr *index.BulkError
+	if !xerrors.As(err, &bulkErr) {
+		return err
+	}
+	for _, item := range bulkErr.Items {
+		var url string
+		if item.Index >= 0 && item.Index < len(batch) {
+			url = batch[item.Index].URL
+		}
+		i.logger.Printf("crawler: skipping document for %q (link ID %s): %v", url, item.LinkID, item.Err)
+	}
+	return nil
+}